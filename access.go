@@ -0,0 +1,75 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"time"
+)
+
+// prepareVehicleAccess prepares the legs to and from transit, if the vehicle is parked or the traveller is dropped off.
+// Returns the origins to start the transit search from.
+func (b *Bifrost) prepareVehicleAccess(rounds *Rounds, origins []SourceKey, dest *fptf.Location, destKey uint64, vehicle VehicleType) ([]SourceKey, error) {
+	if b.parksVehicle(vehicle) {
+		return b.driveToParkings(rounds, origins, destKey, vehicle)
+	}
+
+	if !b.dropsOff(vehicle) {
+		return origins, nil
+	}
+
+	err := b.driveFromStops(rounds, origins[0].StopKey, dest, origins[0].Departure)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.driveToStops(rounds, origins, destKey)
+}
+
+// runAccessSearch runs a street search with the vehicle from the origins and keeps its labels in rounds.Access.
+func (b *Bifrost) runAccessSearch(rounds *Rounds, origins []SourceKey, destKey uint64, vehicle VehicleType, noTransferCap bool) {
+	access := b.searchRounds(rounds, &rounds.accessSearch)
+
+	for _, origin := range origins {
+		departure := timeToMs(origin.Departure)
+
+		if ea, ok := access.EarliestArrivals.Get(origin.StopKey); ok && ea <= departure {
+			continue
+		}
+
+		access.Rounds[0].Set(origin.StopKey, StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << vehicle})
+		access.MarkedStopsForTransfer.Add(origin.StopKey)
+		access.EarliestArrivals.Set(origin.StopKey, departure)
+	}
+
+	b.runTransferRound(access, destKey, 0, vehicle, noTransferCap)
+
+	rounds.Access = access.Rounds[1]
+}
+
+// getAccessTrip returns the drive or cycle to the vertex, at which the journey was started, or nil if the journey
+// started at one of the origins. The trip ends before the departure of the origin by the time needed to park, which
+// may be later than its arrival in range queries.
+func (b *Bifrost) getAccessTrip(rounds *Rounds, origin uint64) (*fptf.Trip, error) {
+	arrival, ok := rounds.Access.Get(origin)
+	if !ok || arrival.Trip == TripIdNoChange {
+		return nil, nil
+	}
+
+	trip, _, err := GetTripFromTransfer(b.Data, rounds.Access, origin, arrival.Trip)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := b.ParkingMs
+	if arrival.Trip == TripIdCar && b.dropsOff(VehicleTypeCar) {
+		delay = 0
+		b.setCarLegMode(trip)
+	}
+
+	start, _ := rounds.Rounds[0].Get(origin)
+	departure := start.Arrival
+	shift := time.Duration(int64(departure)-int64(delay)-int64(arrival.Arrival)) * time.Millisecond
+
+	shiftJourney(&fptf.Journey{Trips: []*fptf.Trip{trip}}, shift)
+
+	return trip, nil
+}
@@ -0,0 +1,317 @@
+package bifrost
+
+import (
+	"fmt"
+	"time"
+)
+
+// names of the cause and effect enums of GTFS-RT alerts, by their value
+var (
+	alertCauses = []string{"", "UNKNOWN_CAUSE", "OTHER_CAUSE", "TECHNICAL_PROBLEM", "STRIKE", "DEMONSTRATION",
+		"ACCIDENT", "HOLIDAY", "WEATHER", "MAINTENANCE", "CONSTRUCTION", "POLICE_ACTIVITY", "MEDICAL_EMERGENCY"}
+	alertEffects = []string{"", "NO_SERVICE", "REDUCED_SERVICE", "SIGNIFICANT_DELAYS", "DETOUR", "ADDITIONAL_SERVICE",
+		"MODIFIED_SERVICE", "OTHER_EFFECT", "UNKNOWN_EFFECT", "STOP_MOVED", "NO_EFFECT", "ACCESSIBILITY_ISSUE"}
+)
+
+const rtEffectNoService = 1
+
+// Alert is a GTFS-RT service alert. It is attached to the meta of the legs it affects, see RealtimeMeta.
+type Alert struct {
+	Id            string        `json:"id"`
+	Cause         string        `json:"cause"`
+	Effect        string        `json:"effect"`
+	Header        string        `json:"header,omitempty"`
+	Description   string        `json:"description,omitempty"`
+	Url           string        `json:"url,omitempty"`
+	ActivePeriods []AlertPeriod `json:"activePeriods,omitempty"` // always active, if empty
+
+	noService bool
+}
+
+// AlertPeriod is an active period of an alert in unix ms. Open ends are 0.
+type AlertPeriod struct {
+	Start uint64 `json:"start,omitempty"`
+	End   uint64 `json:"end,omitempty"`
+}
+
+// Alerts is an index of GTFS-RT service alerts by the entities they inform about. Like Realtime, it is never changed
+// after it was read. See RoutingData.WithAlerts.
+type Alerts struct {
+	Timestamp uint64 // header timestamp of the feed in unix ms
+
+	// selectors by their most specific field, so only few of them have to be checked for a trip
+	byTrip      map[string][]*alertSelector // gtfs trip id
+	byRoute     map[string][]*alertSelector // gtfs route id
+	byStop      map[string][]*alertSelector // gtfs stop id
+	byAgency    map[string][]*alertSelector // gtfs agency id
+	byRouteType map[int][]*alertSelector    // gtfs route type
+}
+
+// alertSelector is an informed entity of an alert. All fields that are set must match.
+type alertSelector struct {
+	Alert        *Alert
+	AgencyId     string
+	RouteId      string
+	RouteType    int
+	HasRouteType bool
+	TripId       string
+	Day          uint32 // only set if HasDay
+	HasDay       bool
+	StopId       string
+}
+
+// WithAlerts returns a shallow copy of the routing data, that attaches the alerts to legs. Pass nil to route without
+// alerts.
+func (r *RoutingData) WithAlerts(alerts *Alerts) *RoutingData {
+	data := *r
+	data.Alerts = alerts
+	return &data
+}
+
+// ReadAlerts reads a GTFS-RT feed of service alerts from a file or a http(s) url. feedId is the id of the gtfs feed
+// the alerts refer to, as given to AddGtfs.
+func ReadAlerts(source string, feedId string) (*Alerts, error) {
+	data, err := readRealtimeSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading alerts: %w", err)
+	}
+
+	return ParseAlerts(data, feedId)
+}
+
+// ParseAlerts builds an alert index from a protobuf encoded GTFS-RT feed. Informed entities are matched by their gtfs
+// ids, entities without any supported field are ignored.
+func ParseAlerts(data []byte, feedId string) (*Alerts, error) {
+	feed, err := decodeFeedMessage(data, feedId)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := &Alerts{
+		Timestamp:   feed.Timestamp * 1000,
+		byTrip:      make(map[string][]*alertSelector),
+		byRoute:     make(map[string][]*alertSelector),
+		byStop:      make(map[string][]*alertSelector),
+		byAgency:    make(map[string][]*alertSelector),
+		byRouteType: make(map[int][]*alertSelector),
+	}
+
+	if alerts.Timestamp == 0 {
+		alerts.Timestamp = uint64(time.Now().UnixMilli())
+	}
+
+	count := 0
+
+	for _, entity := range feed.Entities {
+		if entity.IsDeleted || entity.Alert == nil {
+			continue
+		}
+
+		alert := newAlert(entity.Id, entity.Alert)
+		count++
+
+		for _, informed := range entity.Alert.InformedEntities {
+			alerts.add(alert, informed)
+		}
+	}
+
+	fmt.Println("Read", count, "alerts")
+
+	return alerts, nil
+}
+
+func newAlert(id string, rt *rtAlert) *Alert {
+	alert := &Alert{
+		Id:          id,
+		Cause:       alertCauses[1],
+		Effect:      alertEffects[8],
+		Header:      rt.HeaderText,
+		Description: rt.DescriptionText,
+		Url:         rt.Url,
+		noService:   rt.Effect == rtEffectNoService,
+	}
+
+	if rt.Cause > 0 && rt.Cause < len(alertCauses) {
+		alert.Cause = alertCauses[rt.Cause]
+	}
+
+	if rt.Effect > 0 && rt.Effect < len(alertEffects) {
+		alert.Effect = alertEffects[rt.Effect]
+	}
+
+	for _, period := range rt.ActivePeriods {
+		alert.ActivePeriods = append(alert.ActivePeriods, AlertPeriod{
+			Start: period.Start * 1000,
+			End:   period.End * 1000,
+		})
+	}
+
+	return alert
+}
+
+// add indexes an informed entity of the alert.
+func (a *Alerts) add(alert *Alert, informed rtEntitySelector) {
+	selector := &alertSelector{
+		Alert:        alert,
+		AgencyId:     informed.AgencyId,
+		RouteId:      informed.RouteId,
+		RouteType:    informed.RouteType,
+		HasRouteType: informed.HasRouteType,
+		StopId:       informed.StopId,
+	}
+
+	if informed.Trip != nil {
+		selector.TripId = informed.Trip.TripId
+		if selector.RouteId == "" {
+			selector.RouteId = informed.Trip.RouteId
+		}
+
+		if informed.Trip.StartDate != "" {
+			date, err := time.Parse("20060102", informed.Trip.StartDate)
+			if err == nil {
+				selector.Day = uint32(date.Unix() / int64(DayInMs/1000))
+				selector.HasDay = true
+			}
+		}
+	}
+
+	switch {
+	case selector.TripId != "":
+		a.byTrip[selector.TripId] = append(a.byTrip[selector.TripId], selector)
+	case selector.RouteId != "":
+		a.byRoute[selector.RouteId] = append(a.byRoute[selector.RouteId], selector)
+	case selector.StopId != "":
+		a.byStop[selector.StopId] = append(a.byStop[selector.StopId], selector)
+	case selector.AgencyId != "":
+		a.byAgency[selector.AgencyId] = append(a.byAgency[selector.AgencyId], selector)
+	case selector.HasRouteType:
+		a.byRouteType[selector.RouteType] = append(a.byRouteType[selector.RouteType], selector)
+	}
+}
+
+// activeBetween returns true, if one of the active periods of the alert overlaps with the time span.
+func (a *Alert) activeBetween(start uint64, end uint64) bool {
+	if len(a.ActivePeriods) == 0 {
+		return true
+	}
+
+	for _, period := range a.ActivePeriods {
+		if (period.Start == 0 || period.Start <= end) && (period.End == 0 || start <= period.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches returns true, if the selector informs about the trip on the given day. The stop is only checked, if
+// the selector names one. Pass an empty stop id to match selectors without a stop only.
+func (s *alertSelector) matches(route *RouteInformation, trip *TripInformation, day uint32, stopId string) bool {
+	if s.TripId != "" && (s.TripId != trip.TripId || (s.HasDay && s.Day != day)) {
+		return false
+	}
+
+	if s.RouteId != "" && s.RouteId != route.RouteId {
+		return false
+	}
+
+	if s.AgencyId != "" && s.AgencyId != route.AgencyId {
+		return false
+	}
+
+	if s.HasRouteType && s.RouteType != route.Type {
+		return false
+	}
+
+	return s.StopId == stopId
+}
+
+// rangeCandidates calls fn with the selectors, that may match the trip at one of the stops.
+func (a *Alerts) rangeCandidates(route *RouteInformation, trip *TripInformation, stopIds []string, fn func(selector *alertSelector)) {
+	lists := [][]*alertSelector{
+		a.byTrip[trip.TripId],
+		a.byRoute[route.RouteId],
+		a.byAgency[route.AgencyId],
+		a.byRouteType[route.Type],
+	}
+
+	for _, stopId := range stopIds {
+		lists = append(lists, a.byStop[stopId])
+	}
+
+	for _, list := range lists {
+		for _, selector := range list {
+			fn(selector)
+		}
+	}
+}
+
+// legAlerts returns the alerts informing about the trip between enterKey and exitKey, that are active between
+// departure and arrival.
+func (r *RoutingData) legAlerts(tripKey uint32, day uint32, enterKey int, exitKey int, departure uint64, arrival uint64) []*Alert {
+	if r.Alerts == nil {
+		return nil
+	}
+
+	route := r.Routes[r.tripRoute(tripKey)]
+	routeInfo := r.RouteInformation[r.tripGtfsRoute(tripKey)]
+	tripInfo := r.tripInformation(tripKey)
+
+	stopIds := make([]string, 0, exitKey-enterKey+1)
+	for i := enterKey; i <= exitKey; i++ {
+		stopIds = append(stopIds, r.stopId(route.Stops[i]))
+	}
+
+	var alerts []*Alert
+	seen := make(map[*Alert]bool)
+
+	r.Alerts.rangeCandidates(routeInfo, tripInfo, stopIds, func(selector *alertSelector) {
+		if seen[selector.Alert] || !selector.Alert.activeBetween(departure, arrival) {
+			return
+		}
+
+		matches := selector.StopId == "" && selector.matches(routeInfo, tripInfo, day, "")
+		for i := 0; !matches && selector.StopId != "" && i < len(stopIds); i++ {
+			matches = selector.matches(routeInfo, tripInfo, day, stopIds[i])
+		}
+
+		if matches {
+			seen[selector.Alert] = true
+			alerts = append(alerts, selector.Alert)
+		}
+	})
+
+	return alerts
+}
+
+// noService returns true, if an active NO_SERVICE alert informs about the trip on the given day at the stop.
+func (r *RoutingData) noService(route *Route, tripKey uint32, day uint32, stopSeqKey uint32, time uint64) bool {
+	if r.Alerts == nil {
+		return false
+	}
+
+	routeInfo := r.RouteInformation[r.tripGtfsRoute(tripKey)]
+	tripInfo := r.tripInformation(tripKey)
+	stopId := r.stopId(route.Stops[stopSeqKey])
+
+	noService := false
+
+	r.Alerts.rangeCandidates(routeInfo, tripInfo, []string{stopId}, func(selector *alertSelector) {
+		if noService || !selector.Alert.noService || !selector.Alert.activeBetween(time, time) {
+			return
+		}
+
+		noService = selector.matches(routeInfo, tripInfo, day, "") || selector.matches(routeInfo, tripInfo, day, stopId)
+	})
+
+	return noService
+}
+
+// stopId returns the gtfs stop id of a vertex, or an empty string for street vertices.
+func (r *RoutingData) stopId(vertex uint64) string {
+	stop := r.Vertices[vertex].Stop
+	if stop == nil {
+		return ""
+	}
+	return stop.Id
+}
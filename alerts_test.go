@@ -0,0 +1,71 @@
+package bifrost
+
+import (
+	"testing"
+)
+
+func alertEntity(id string, effect uint64, header string, start uint64, end uint64, informed ...[]byte) []byte {
+	translation := appendField(nil, 1, []byte(header))
+	text := appendField(nil, 1, translation)
+
+	period := appendVarintField(nil, 1, start)
+	period = appendVarintField(period, 2, end)
+
+	alert := appendField(nil, 1, period)
+	for _, selector := range informed {
+		alert = appendField(alert, 5, selector)
+	}
+	alert = appendVarintField(alert, 7, effect)
+	alert = appendField(alert, 10, text)
+
+	entity := appendField(nil, 1, []byte(id))
+	return appendField(entity, 5, alert)
+}
+
+func TestParseAlerts(t *testing.T) {
+	day := uint64(19000)
+	dayStart := day * uint64(DayInMs) / 1000
+
+	routeAtStop := appendField(nil, 2, []byte("r"))
+	routeAtStop = appendField(routeAtStop, 5, []byte("b"))
+
+	busses := appendVarintField(nil, 3, 3)
+
+	feed := appendField(nil, 2, alertEntity("closed", rtEffectNoService, "Stop b closed", dayStart, dayStart+12*60*60, routeAtStop))
+	feed = appendField(feed, 2, alertEntity("strike", 4, "Strike", dayStart+20*60*60, 0, busses))
+
+	alerts, err := ParseAlerts(feed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bifrost{Data: newRealtimeTestData().WithAlerts(alerts)}
+	route := b.Data.Routes[0]
+	trip := b.Data.Trips[0]
+
+	leg := b.Data.getTransitTrip(0, 0, 2, day)
+	meta, ok := leg.Meta.(*RealtimeMeta)
+	if !ok || len(meta.Alerts) != 1 || meta.Alerts[0].Header != "Stop b closed" || meta.Alerts[0].Effect != "NO_SERVICE" {
+		t.Fatalf("expected only the active alert of stop b, got %+v", leg.Meta)
+	}
+
+	leg = b.Data.getTransitTrip(0, 1, 2, day+1)
+	meta, ok = leg.Meta.(*RealtimeMeta)
+	if !ok || len(meta.Alerts) != 1 || meta.Alerts[0].Id != "strike" {
+		t.Fatalf("expected only the strike of all busses on the next day, got %+v", leg.Meta)
+	}
+
+	if !b.canLeave(route, trip, 0, uint32(day), 1) {
+		t.Fatal("expected stop b to be usable without AvoidNoService")
+	}
+
+	b.AvoidNoService = true
+
+	if b.canLeave(route, trip, 0, uint32(day), 1) {
+		t.Fatal("expected stop b not to be usable with AvoidNoService")
+	}
+
+	if !b.canLeave(route, trip, 0, uint32(day), 2) {
+		t.Fatal("expected stop c to be usable")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/Vector-Hector/fptf"
 	util "github.com/Vector-Hector/goutil"
+	"math"
 	"time"
 )
 
@@ -21,7 +22,10 @@ type dijkstraNode struct {
 	Vertex       uint64
 	TransferTime uint32 // time in ms to walk or cycle to this stop
 	Score        uint64
-	Index        int // Index of the node in the heap
+	Shared       *SharingStation // station the shared vehicle was rented at, nil if not riding one
+	SharedFrom   uint64          // vertex the shared vehicle was rented at
+	SharedTime   uint32          // time in ms riding the shared vehicle
+	Index        int             // Index of the node in the heap
 }
 
 type priorityQueue []*dijkstraNode
@@ -43,7 +47,9 @@ func (pq *priorityQueue) Swap(i, j int) {
 }
 
 func (pq *priorityQueue) Push(x interface{}) {
-	*pq = append(*pq, x.(*dijkstraNode))
+	node := x.(*dijkstraNode)
+	node.Index = len(*pq)
+	*pq = append(*pq, node)
 }
 
 func (pq *priorityQueue) Pop() interface{} {
@@ -55,6 +61,52 @@ func (pq *priorityQueue) Pop() interface{} {
 	return x
 }
 
+// streetSearch holds the queue and the nodes of the street searches of a Rounds object. They are reused by every
+// transfer round instead of being allocated per round, as most of the allocations of a query used to be nodes.
+type streetSearch struct {
+	queue  priorityQueue
+	nodes  []*dijkstraNode // nodes handed out by newNode since the last reset come first
+	used   int
+	queued *IndexMap[*dijkstraNode] // vertex -> node, only valid while the node is in the queue
+	shared *IndexMap[*dijkstraNode] // vertex -> node riding a shared vehicle, only valid while it is in the queue
+}
+
+func newStreetSearch(vertices int) *streetSearch {
+	return &streetSearch{
+		queued: newIndexMap[*dijkstraNode](vertices),
+		shared: newIndexMap[*dijkstraNode](vertices),
+	}
+}
+
+// reset empties the queue and takes back all nodes. It must only be called once no search uses them anymore.
+func (s *streetSearch) reset() {
+	s.queue = s.queue[:0]
+	s.used = 0
+	s.queued.Reset()
+	s.shared.Reset()
+}
+
+// newNode returns a node with the given values, allocating nodes in chunks if all were handed out.
+func (s *streetSearch) newNode(node dijkstraNode) *dijkstraNode {
+	if s.used == len(s.nodes) {
+		chunk := make([]dijkstraNode, len(s.nodes)+64)
+		for i := range chunk {
+			s.nodes = append(s.nodes, &chunk[i])
+		}
+	}
+
+	n := s.nodes[s.used]
+	s.used++
+	*n = node
+	return n
+}
+
+// queuedNode returns the node of the vertex in nodes, if it is still in the queue.
+func queuedNode(nodes *IndexMap[*dijkstraNode], vertex uint64) (*dijkstraNode, bool) {
+	node, ok := nodes.Get(vertex)
+	return node, ok && node.Index >= 0
+}
+
 func (pq *priorityQueue) update(node *dijkstraNode, arrival uint64, targetWalkTime uint32) {
 	node.Arrival = arrival
 	node.TransferTime = targetWalkTime
@@ -62,6 +114,15 @@ func (pq *priorityQueue) update(node *dijkstraNode, arrival uint64, targetWalkTi
 }
 
 func (b *Bifrost) RouteOnlyTimeIndependent(rounds *Rounds, origins []SourceKey, destKey uint64, vehicle VehicleType, debug bool) (*fptf.Journey, error) {
+	if _, err := b.GetMinAvgSpeed(vehicle); err != nil {
+		return nil, err
+	}
+
+	err := checkDepartures(origins)
+	if err != nil {
+		return nil, err
+	}
+
 	t := time.Now()
 
 	rounds.NewSession()
@@ -85,9 +146,9 @@ func (b *Bifrost) RouteOnlyTimeIndependent(rounds *Rounds, origins []SourceKey,
 
 	for _, origin := range origins {
 		departure := timeToMs(origin.Departure)
-		rounds.Rounds[0][origin.StopKey] = StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << vehicle}
-		rounds.MarkedStopsForTransfer[origin.StopKey] = true
-		rounds.EarliestArrivals[origin.StopKey] = departure
+		rounds.Rounds[0].Set(origin.StopKey, StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << vehicle})
+		rounds.MarkedStopsForTransfer.Add(origin.StopKey)
+		rounds.EarliestArrivals.Set(origin.StopKey, departure)
 	}
 
 	b.runTransferRound(rounds, destKey, 0, vehicle, true)
@@ -96,12 +157,15 @@ func (b *Bifrost) RouteOnlyTimeIndependent(rounds *Rounds, origins []SourceKey,
 		fmt.Println("Getting transfer times took", time.Since(t))
 	}
 
-	_, ok := rounds.EarliestArrivals[destKey]
+	ok := rounds.EarliestArrivals.Has(destKey)
 	if !ok {
-		panic(NoRouteError(true))
+		return nil, NoRouteError(true)
 	}
 
-	journey := b.ReconstructJourney(destKey, 1, rounds)
+	journey, err := b.ReconstructJourney(destKey, 1, rounds)
+	if err != nil {
+		return nil, err
+	}
 
 	if debug {
 		dep := journey.GetDeparture()
@@ -123,43 +187,58 @@ func (b *Bifrost) runTransferRound(rounds *Rounds, target uint64, current int, v
 	round := rounds.Rounds[current]
 	next := rounds.Rounds[current+1]
 
-	for stop, t := range round {
-		next[stop] = StopArrival{
+	for i := 0; i < round.Len(); i++ {
+		stop, t := round.Entry(i)
+		if existing, ok := next.Get(stop); ok && existing.Arrival <= t.Arrival {
+			continue // keep better labels of earlier range runs
+		}
+
+		next.Set(stop, StopArrival{
 			Arrival:  t.Arrival,
 			Trip:     TripIdNoChange,
 			Vehicles: t.Vehicles,
-		}
+		})
 	}
 
-	queue := make(priorityQueue, 0)
-	heap.Init(&queue)
+	search := rounds.street
+	search.reset()
+	queue := &search.queue
 
 	targetVertex := &b.Data.Vertices[target]
 
+	shared := vehicle == VehicleTypeWalking && b.SharedMobility && len(b.Data.SharingStations) > 0
+
+	heuristicVehicle := vehicle
+	if shared {
+		heuristicVehicle = VehicleTypeBicycle // riding a shared vehicle is faster than walking
+	}
+
+	speed, err := b.GetMinAvgSpeed(heuristicVehicle)
+	if err != nil {
+		return // no arc can be used by an invalid vehicle either, see arcDistance
+	}
+
 	// perform dijkstra on street graph
-	for stop, marked := range rounds.MarkedStopsForTransfer {
-		if !marked {
-			continue
-		}
-		sa, ok := next[stop]
+	rounds.MarkedStopsForTransfer.Each(func(stop uint64) {
+		sa, ok := next.Get(stop)
 
 		if !ok {
-			continue
+			return
 		}
 
 		if sa.Vehicles&(1<<vehicle) == 0 && vehicle != VehicleTypeWalking { // foot is always allowed
-			continue
+			return
 		}
 
-		heap.Push(&queue, &dijkstraNode{
+		heap.Push(queue, search.newNode(dijkstraNode{
 			Arrival:      sa.Arrival,
 			Vertex:       stop,
 			TransferTime: sa.TransferTime,
-			Score:        sa.Arrival + b.HeuristicMs(&b.Data.Vertices[stop], targetVertex, vehicle),
-		})
+			Score:        sa.Arrival + heuristicMs(&b.Data.Vertices[stop], targetVertex, speed),
+		}))
 
-		delete(rounds.MarkedStopsForTransfer, stop)
-	}
+		rounds.MarkedStopsForTransfer.Remove(stop)
+	})
 
 	tripType := TripIdWalk
 	if vehicle == VehicleTypeBicycle {
@@ -168,26 +247,56 @@ func (b *Bifrost) runTransferRound(rounds *Rounds, target uint64, current int, v
 		tripType = TripIdCar
 	}
 
-	nodeMap := make(map[uint64]*dijkstraNode)
+	push := func(update dijkstraNode) {
+		nodes := search.queued
+		if update.Shared != nil {
+			nodes = search.shared // vertices reached riding a shared vehicle
+		}
 
-	for queue.Len() > 0 {
-		node := heap.Pop(&queue).(*dijkstraNode)
-		delete(nodeMap, node.Vertex)
+		node, ok := queuedNode(nodes, update.Vertex)
+		if ok {
+			node.Shared = update.Shared
+			node.SharedFrom = update.SharedFrom
+			node.SharedTime = update.SharedTime
+			queue.update(node, update.Arrival, update.TransferTime)
+			return
+		}
+
+		update.Score = update.Arrival + heuristicMs(&b.Data.Vertices[update.Vertex], targetVertex, speed)
+		node = search.newNode(update)
+		nodes.Set(update.Vertex, node)
+
+		heap.Push(queue, node)
+	}
+
+	for settled := 0; queue.Len() > 0; settled++ {
+		if settled%cancelCheckInterval == 0 && rounds.cancelled() {
+			return
+		}
+
+		node := heap.Pop(queue).(*dijkstraNode)
+
+		if node.Shared != nil {
+			b.rideSharedVehicle(rounds, target, current, node, push)
+			continue
+		}
+
+		if shared {
+			b.pickUpSharedVehicle(rounds, target, current, node, push)
+		}
 
 		arcs := b.Data.StreetGraph[node.Vertex]
 		for _, arc := range arcs {
-			dist := arc.WalkDistance
-			if vehicle == VehicleTypeBicycle {
-				dist = arc.CycleDistance
-			}
-			if vehicle == VehicleTypeCar {
-				dist = arc.CarDistance
-			}
+			dist := b.arcDistance(&arc, vehicle)
 
 			if dist == 0 {
 				continue
 			}
 
+			if b.Wheelchair && arc.Inaccessible && vehicle == VehicleTypeWalking {
+				continue
+			}
+
 			targetTransferTime := node.TransferTime + dist
 
 			if !noTransferCap && vehicle == VehicleTypeWalking && targetTransferTime > b.MaxWalkingMs {
@@ -198,46 +307,185 @@ func (b *Bifrost) runTransferRound(rounds *Rounds, target uint64, current int, v
 				continue
 			}
 
+			if !noTransferCap && vehicle == VehicleTypeCar && targetTransferTime > b.MaxCarAccessMs {
+				continue
+			}
+
 			arrival := node.Arrival + uint64(dist)
 
-			ea, ok := rounds.EarliestArrivals[arc.Target]
-			targetEa, targetOk := rounds.EarliestArrivals[target]
+			ea, ok := rounds.EarliestArrivals.Get(arc.Target)
+			targetEa, targetOk := rounds.EarliestArrivals.Get(target)
 
 			if (ok && ea <= arrival) || (targetOk && targetEa <= arrival) {
 				continue
 			}
 
-			next[arc.Target] = StopArrival{
+			next.Set(arc.Target, StopArrival{
 				Arrival:      arrival,
 				Trip:         tripType,
 				EnterKey:     node.Vertex,
 				Departure:    node.Arrival,
 				TransferTime: targetTransferTime,
 				Vehicles:     1 << vehicle,
+			})
+			rounds.MarkedStops.Add(arc.Target)
+			rounds.EarliestArrivals.Set(arc.Target, arrival)
+
+			push(dijkstraNode{
+				Arrival:      arrival,
+				Vertex:       arc.Target,
+				TransferTime: targetTransferTime,
+			})
+		}
+	}
+}
+
+// runTransferRoundReverse is the arrive-by counterpart of runTransferRound. It walks the incoming arcs of the street
+// graph and propagates latest departures instead of earliest arrivals.
+func (b *Bifrost) runTransferRoundReverse(rounds *Rounds, target uint64, current int, vehicle VehicleType, noTransferCap bool) {
+	round := rounds.Rounds[current]
+	next := rounds.Rounds[current+1]
+
+	for i := 0; i < round.Len(); i++ {
+		stop, t := round.Entry(i)
+		next.Set(stop, StopArrival{
+			Arrival:  t.Arrival,
+			Trip:     TripIdNoChange,
+			Vehicles: t.Vehicles,
+		})
+	}
+
+	search := rounds.street
+	search.reset()
+	queue := &search.queue
+
+	targetVertex := &b.Data.Vertices[target]
+
+	speed, err := b.GetMinAvgSpeed(vehicle)
+	if err != nil {
+		return // no arc can be used by an invalid vehicle either, see arcDistance
+	}
+
+	rounds.MarkedStopsForTransfer.Each(func(stop uint64) {
+		sa, ok := next.Get(stop)
+
+		if !ok {
+			return
+		}
+
+		if sa.Vehicles&(1<<vehicle) == 0 && vehicle != VehicleTypeWalking { // foot is always allowed
+			return
+		}
+
+		heap.Push(queue, search.newNode(dijkstraNode{
+			Arrival:      sa.Arrival,
+			Vertex:       stop,
+			TransferTime: sa.TransferTime,
+			Score:        reverseScore(sa.Arrival, heuristicMs(&b.Data.Vertices[stop], targetVertex, speed)),
+		}))
+
+		rounds.MarkedStopsForTransfer.Remove(stop)
+	})
+
+	tripType := TripIdWalk
+	if vehicle == VehicleTypeBicycle {
+		tripType = TripIdCycle
+	} else if vehicle == VehicleTypeCar {
+		tripType = TripIdCar
+	}
+
+	for settled := 0; queue.Len() > 0; settled++ {
+		if settled%cancelCheckInterval == 0 && rounds.cancelled() {
+			return
+		}
+
+		node := heap.Pop(queue).(*dijkstraNode)
+
+		arcs := b.Data.ReverseStreetGraph[node.Vertex]
+		for _, arc := range arcs {
+			dist := b.arcDistance(&arc, vehicle)
+
+			if dist == 0 || uint64(dist) > node.Arrival {
+				continue
 			}
-			rounds.MarkedStops[arc.Target] = true
-			rounds.EarliestArrivals[arc.Target] = arrival
 
-			targetNode, ok := nodeMap[arc.Target]
+			if b.Wheelchair && arc.Inaccessible && vehicle == VehicleTypeWalking {
+				continue
+			}
+
+			targetTransferTime := node.TransferTime + dist
+
+			if !noTransferCap && vehicle == VehicleTypeWalking && targetTransferTime > b.MaxWalkingMs {
+				continue
+			}
+
+			if !noTransferCap && vehicle == VehicleTypeBicycle && targetTransferTime > b.MaxCyclingMs {
+				continue
+			}
+
+			if !noTransferCap && vehicle == VehicleTypeCar && targetTransferTime > b.MaxCarAccessMs {
+				continue
+			}
+
+			departure := node.Arrival - uint64(dist)
+
+			ld, ok := rounds.EarliestArrivals.Get(arc.Target)
+			targetLd, targetOk := rounds.EarliestArrivals.Get(target)
+
+			if (ok && ld >= departure) || (targetOk && targetLd >= departure) {
+				continue
+			}
+
+			next.Set(arc.Target, StopArrival{
+				Arrival:      departure,
+				Trip:         tripType,
+				EnterKey:     node.Vertex,
+				Departure:    node.Arrival,
+				TransferTime: targetTransferTime,
+				Vehicles:     1 << vehicle,
+			})
+			rounds.MarkedStops.Add(arc.Target)
+			rounds.EarliestArrivals.Set(arc.Target, departure)
+
+			score := reverseScore(departure, heuristicMs(&b.Data.Vertices[arc.Target], targetVertex, speed))
+
+			targetNode, ok := queuedNode(search.queued, arc.Target)
 			if ok {
-				queue.update(targetNode, arrival, targetTransferTime)
+				targetNode.Score = score
+				queue.update(targetNode, departure, targetTransferTime)
 				continue
 			}
 
-			targetNode = &dijkstraNode{
-				Arrival:      arrival,
+			targetNode = search.newNode(dijkstraNode{
+				Arrival:      departure,
 				Vertex:       arc.Target,
 				TransferTime: targetTransferTime,
-				Score:        arrival + b.HeuristicMs(&b.Data.Vertices[arc.Target], targetVertex, vehicle),
-			}
+				Score:        score,
+			})
 
-			nodeMap[arc.Target] = targetNode
+			search.queued.Set(arc.Target, targetNode)
 
-			heap.Push(&queue, targetNode)
+			heap.Push(queue, targetNode)
 		}
 	}
 }
 
-func (b *Bifrost) HeuristicMs(from, to *Vertex, vehicle VehicleType) uint64 {
-	return uint64(b.DistanceMs(from, to, vehicle))
+// reverseScore orders nodes of a backwards search by their latest possible departure at the target, latest first.
+func reverseScore(departure uint64, heuristic uint64) uint64 {
+	if heuristic > departure {
+		return math.MaxUint64
+	}
+
+	return math.MaxUint64 - (departure - heuristic)
+}
+
+// HeuristicMs estimates the time in ms to travel between the vertices with the vehicle, which is used as the heuristic
+// of the street searches. Returns an error, if the vehicle type is invalid.
+func (b *Bifrost) HeuristicMs(from, to *Vertex, vehicle VehicleType) (uint64, error) {
+	dist, err := b.DistanceMs(from, to, vehicle)
+	return uint64(dist), err
+}
+
+func heuristicMs(from, to *Vertex, speed float64) uint64 {
+	return uint64(distanceMs(from, to, speed))
 }
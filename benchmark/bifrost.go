@@ -11,23 +11,23 @@ import (
 )
 
 type JourneyRequest struct {
-	Origin      *fptf.Location      `json:"origin"`
-	Destination *fptf.Location      `json:"destination"`
-	Departure   time.Time           `json:"departure"`
-	Mode        bifrost.RoutingMode `json:"mode"`
+	Origin      *fptf.Location `json:"origin"`
+	Destination *fptf.Location `json:"destination"`
+	Departure   time.Time      `json:"departure"`
+	Modes       []fptf.Mode    `json:"modes"`
 }
 
 func RouteBifrost(from *fptf.Location, to *fptf.Location, date time.Time, onlyWalk bool) (*fptf.Journey, time.Duration, error) {
-	mode := bifrost.ModeTransit
+	modes := bifrost.ModeTransit
 	if onlyWalk {
-		mode = bifrost.ModeFoot
+		modes = []fptf.Mode{fptf.ModeWalking}
 	}
 
 	req := &JourneyRequest{
 		Origin:      from,
 		Destination: to,
 		Departure:   date,
-		Mode:        mode,
+		Modes:       modes,
 	}
 
 	data, err := json.Marshal(req)
@@ -43,12 +43,16 @@ func RouteBifrost(from *fptf.Location, to *fptf.Location, date time.Time, onlyWa
 		return nil, 0, err
 	}
 
-	var journey fptf.Journey
-	err = json.NewDecoder(resp.Body).Decode(&journey)
+	var journeys []*fptf.Journey
+	err = json.NewDecoder(resp.Body).Decode(&journeys)
 	if err != nil {
 		return nil, 0, err
 	}
 	reqDuration := time.Since(reqStart)
 
-	return &journey, reqDuration, nil
+	if len(journeys) == 0 {
+		return nil, 0, fmt.Errorf("no journey returned")
+	}
+
+	return journeys[0], reqDuration, nil
 }
@@ -13,6 +13,8 @@ const (
 	TripIdCar      uint32 = 0xfffffffd
 	TripIdNoChange uint32 = 0xfffffffc
 	TripIdOrigin   uint32 = 0xfffffffb
+	TripIdEgress   uint32 = 0xfffffffa // drive from a vertex near the last stop to the destination
+	TripIdShared   uint32 = 0xfffffff9 // ride on a shared vehicle, returned at this vertex
 
 	ArrivalTimeNotReached uint64 = 0xffffffffffffffff
 )
@@ -27,6 +29,18 @@ type Bifrost struct {
 	MaxWalkingMs              uint32  // duration of walks not allowed to be higher than this per transfer
 	MaxCyclingMs              uint32  // duration of cycles not allowed to be higher than this per transfer
 	MaxStopsConnectionSeconds uint32  // max length of added arcs between stops and street graph in deciseconds
+	WalkingCriterion          bool    // use walking time as third criterion in RoutePareto, approximated by repeated searches
+	AllowPhoneAgencyStops     bool    // allow entering and leaving trips at stops, where the agency must be phoned first
+	Wheelchair                bool    // only use stops, trips and street arcs, that are not known to be inaccessible
+	BikeAndRide               bool    // park the bicycle at a bicycle parking instead of taking it on board of transit
+	ParkingMs                 uint64  // time needed to park a car or bicycle before taking transit
+	MaxCarAccessMs            uint32  // duration of car legs not allowed to be higher than this when dropped off, picked up or taking a taxi
+	SharedMobility            bool    // rent shared vehicles of GBFS feeds on walks
+	SharingMs                 uint64  // time needed to rent or return a shared vehicle
+	AvoidNoService            bool    // do not enter or leave trips at stops, that a NO_SERVICE alert informs about
+
+	bikeOnBoard bool          // the bicycle is taken on board of transit, set per query by the modes
+	carAccess   carAccessMode // how the car is used to reach transit, set per query by the modes
 
 	Data *RoutingData
 }
@@ -41,28 +55,48 @@ var DefaultBifrost = &Bifrost{
 	MaxWalkingMs:              60 * 1000 * 15,
 	MaxCyclingMs:              60 * 1000 * 30,
 	MaxStopsConnectionSeconds: 60 * 1000 * 5,
+	ParkingMs:                 60 * 1000 * 3,
+	MaxCarAccessMs:            60 * 1000 * 20,
+	SharingMs:                 60 * 1000,
 }
 
 type RoutingData struct {
 	MaxTripDayLength uint32 `json:"maxTripDayLength"` // number of days to go backwards in time (for trips that end after midnight or multiple days later than the start)
 
-	Services []*Service `json:"services"`
+	Services  []*Service  `json:"services"`
+	Timezones []*Timezone `json:"timezones"` // agency timezone of each gtfs feed, see Service.Timezone
 
 	Routes       []*Route          `json:"routes"`
 	StopToRoutes [][]StopRoutePair `json:"stopToRoutes"`
 	Trips        []*Trip           `json:"trips"`
 	StreetGraph  [][]Arc           `json:"streetGraph"`
 
+	// incoming arcs of each vertex, used for arrive-by searches. rebuilt by RebuildReverseStreetGraph
+	ReverseStreetGraph [][]Arc `json:"-"`
+
 	Reorders map[uint64][]uint32 `json:"reorders"`
 
+	Transfers map[uint64][]TransferRule `json:"transfers"` // to stop vertex -> transfer rules from transfers.txt
+
+	// trips that a vehicle continues as, so travellers can stay seated
+	BlockNext     map[uint32]uint32 `json:"blockNext"`     // trip index -> next trip index
+	BlockPrevious map[uint32]uint32 `json:"blockPrevious"` // trip index -> previous trip index
+
+	Parkings map[uint64]uint8 `json:"parkings"` // street vertex -> bitmask of vehicles, that can be parked there before taking transit
+
+	SharingStations map[uint64]*SharingStation `json:"sharingStations"` // vertex -> shared mobility station or vehicle, added by AddGBFS
+
+	Realtime *Realtime `json:"-"` // realtime overlay of the trips, see WithRealtime
+	Alerts   *Alerts   `json:"-"` // service alerts attached to legs, see WithAlerts
+
 	// for reconstructing journeys after routing
-	Vertices         []Vertex            `json:"vertices"`
-	StopsIndex       map[string]uint64   `json:"stopsIndex"`     // gtfs stop id -> vertex index
-	NodesIndex       map[int64]uint64    `json:"nodesIndex"`     // csv vertex id -> vertex index
-	GtfsRouteIndex   []uint32            `json:"gtfsRouteIndex"` // route index -> gtfs route index
-	RouteInformation []*RouteInformation `json:"routeInformation"`
-	TripInformation  []*TripInformation  `json:"tripInformation"`
-	TripToRoute      []uint32            `json:"tripToRoute"` // trip index -> route index
+	Vertices         []Vertex              `json:"vertices"`
+	StopsIndex       map[string]uint64     `json:"stopsIndex"`     // gtfs stop id -> vertex index
+	NodesIndex       map[OsmSegment]uint64 `json:"nodesIndex"`     // osm segment -> vertex index
+	GtfsRouteIndex   []uint32              `json:"gtfsRouteIndex"` // route index -> gtfs route index
+	RouteInformation []*RouteInformation   `json:"routeInformation"`
+	TripInformation  []*TripInformation    `json:"tripInformation"`
+	TripToRoute      []uint32              `json:"tripToRoute"` // trip index -> route index
 
 	// for finding vertices by location. points are GeoPoint
 	WalkableVertexTree  *kdtree.KDTree `json:"-"`
@@ -77,6 +111,10 @@ func (r *RoutingData) PrintStats() {
 	fmt.Println("transfer graph", len(r.StreetGraph))
 	fmt.Println("stop to routes", len(r.StopToRoutes))
 	fmt.Println("reorders", len(r.Reorders))
+	fmt.Println("stops with transfer rules", len(r.Transfers))
+	fmt.Println("trips continuing as another trip", len(r.BlockNext))
+	fmt.Println("parking facilities", len(r.Parkings))
+	fmt.Println("shared mobility stations", len(r.SharingStations))
 	fmt.Println("services", len(r.Services))
 	fmt.Println("max trip day length", r.MaxTripDayLength)
 }
@@ -133,11 +171,53 @@ func (r *RoutingData) RebuildVertexTree() {
 	r.CarableVertexTree = kdtree.New(carable)
 }
 
+// RebuildReverseStreetGraph builds the ReverseStreetGraph from the StreetGraph. Each arc in the reverse graph points
+// to the origin of the original arc and keeps its distances.
+func (r *RoutingData) RebuildReverseStreetGraph() {
+	counts := make([]int, len(r.StreetGraph))
+	for _, arcs := range r.StreetGraph {
+		for _, arc := range arcs {
+			counts[arc.Target]++
+		}
+	}
+
+	reverse := make([][]Arc, len(r.StreetGraph))
+	for i, count := range counts {
+		reverse[i] = make([]Arc, 0, count)
+	}
+
+	for origin, arcs := range r.StreetGraph {
+		for _, arc := range arcs {
+			reverse[arc.Target] = append(reverse[arc.Target], Arc{
+				Target:        uint64(origin),
+				WalkDistance:  arc.WalkDistance,
+				CycleDistance: arc.CycleDistance,
+				CarDistance:   arc.CarDistance,
+				Inaccessible:  arc.Inaccessible,
+			})
+		}
+	}
+
+	r.ReverseStreetGraph = reverse
+}
+
 type StopContext struct {
-	Id   string
-	Name string
+	Id         string
+	Name       string
+	Wheelchair Accessibility // gtfs wheelchair_boarding, inherited from the parent station
+	Timezone   string        // gtfs stop_timezone, inherited from the parent station, or the agency timezone
+	Feed       uint32        // index of the gtfs feed of the stop, the same as of its timezone in RoutingData.Timezones
 }
 
+// Accessibility is the wheelchair_boarding of a stop or the wheelchair_accessible or bikes_allowed of a trip.
+type Accessibility uint8
+
+const (
+	AccessibilityUnknown Accessibility = iota
+	AccessibilityYes
+	AccessibilityNo
+)
+
 type Vertex struct {
 	Longitude float64
 	Latitude  float64
@@ -183,21 +263,34 @@ func (s *GeoPoint) Dimension(i int) float64 {
 }
 
 type Stopover struct {
-	Arrival   uint32 // ms time since start of day
-	Departure uint32 // ms time since start of day
+	Arrival   uint32   // ms time since start of day
+	Departure uint32   // ms time since start of day
+	Pickup    StopType // whether travellers may enter the trip at this stop
+	DropOff   StopType // whether travellers may leave the trip at this stop
 }
 
-func (s Stopover) ArrivalAtDay(day uint64) uint64 {
-	return uint64(s.Arrival) + day*uint64(DayInMs)
+// StopType is the pickup_type or drop_off_type of a stop time.
+type StopType uint8
+
+const (
+	StopTypeRegular StopType = iota
+	StopTypeNone
+	StopTypePhoneAgency
+	StopTypeCoordinateWithDriver
+)
+
+func (s Stopover) ArrivalAt(dayStart uint64) uint64 {
+	return uint64(s.Arrival) + dayStart
 }
 
-func (s Stopover) DepartureAtDay(day uint64) uint64 {
-	return uint64(s.Departure) + day*uint64(DayInMs)
+func (s Stopover) DepartureAt(dayStart uint64) uint64 {
+	return uint64(s.Departure) + dayStart
 }
 
 type Route struct {
 	Stops []uint64
 	Trips []uint32
+	Mode  TransitMode
 }
 
 type StopRoutePair struct {
@@ -206,8 +299,10 @@ type StopRoutePair struct {
 }
 
 type Trip struct {
-	Service   uint32
-	StopTimes []Stopover
+	Service    uint32
+	Wheelchair Accessibility
+	Bikes      Accessibility
+	StopTimes  []Stopover
 }
 
 type Arc struct {
@@ -215,6 +310,31 @@ type Arc struct {
 	WalkDistance  uint32 // in ms
 	CycleDistance uint32 // in ms
 	CarDistance   uint32 // in ms
+	Inaccessible  bool   // not usable with a wheelchair, for example steps or high kerbs
+}
+
+type TransferType uint8
+
+// transfer types as defined in transfers.txt
+const (
+	TransferTypeRecommended TransferType = iota
+	TransferTypeTimed
+	TransferTypeMinTime
+	TransferTypeForbidden
+	TransferTypeInSeat
+	TransferTypeInSeatForbidden
+)
+
+const TransferAny uint32 = 0xffffffff // wildcard for routes and trips of a TransferRule
+
+type TransferRule struct {
+	FromStop  uint64 // vertex key of the stop the previous trip is left at
+	FromRoute uint32 // gtfs route index or TransferAny
+	ToRoute   uint32 // gtfs route index or TransferAny
+	FromTrip  uint32 // trip key or TransferAny
+	ToTrip    uint32 // trip key or TransferAny
+	Type      TransferType
+	MinTimeMs uint32 // only used by TransferTypeMinTime
 }
 
 type Service struct {
@@ -224,11 +344,15 @@ type Service struct {
 
 	AddedExceptions   []uint32 // unix days
 	RemovedExceptions []uint32 // unix days
+
+	Timezone uint32 // index of the agency timezone in RoutingData.Timezones
 }
 
 type RouteInformation struct {
 	ShortName string
 	RouteId   string
+	AgencyId  string
+	Type      int // gtfs route_type, including extended route types
 }
 
 type TripInformation struct {
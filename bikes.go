@@ -0,0 +1,44 @@
+package bifrost
+
+// withBikeOnBoard returns a copy of b, that cycles to and from stops and takes the bicycle on board of transit. Only
+// trips allowing bicycles are used then.
+func (b *Bifrost) withBikeOnBoard() *Bifrost {
+	query := *b
+	query.bikeOnBoard = true
+	return &query
+}
+
+// transitVehicle returns the vehicle used to reach stops and to transfer between trips.
+func (b *Bifrost) transitVehicle() VehicleType {
+	if b.bikeOnBoard {
+		return VehicleTypeBicycle
+	}
+
+	return VehicleTypeWalking
+}
+
+// arcDistance returns the time in ms to traverse the arc with the vehicle or 0, if the vehicle can't use it. A
+// bicycle taken on board is pushed along arcs, that can only be walked, for example the connections to stops.
+func (b *Bifrost) arcDistance(arc *Arc, vehicle VehicleType) uint32 {
+	switch vehicle {
+	case VehicleTypeBicycle:
+		if arc.CycleDistance == 0 && b.bikeOnBoard {
+			return arc.WalkDistance
+		}
+
+		return arc.CycleDistance
+	case VehicleTypeCar:
+		return arc.CarDistance
+	default:
+		return arc.WalkDistance
+	}
+}
+
+// tripVehicles returns the vehicles, that are still available after riding the trip with the given vehicles.
+func tripVehicles(trip *Trip, vehicles uint8) uint8 {
+	if trip.Bikes != AccessibilityYes {
+		vehicles &^= 1 << VehicleTypeBicycle
+	}
+
+	return vehicles &^ (1 << VehicleTypeCar) // cars are never taken on board
+}
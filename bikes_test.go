@@ -0,0 +1,42 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"testing"
+)
+
+func TestGetVehicleTypeBikeOnBoard(t *testing.T) {
+	vehicle, isTransit := getVehicleType([]fptf.Mode{fptf.ModeBicycle, fptf.ModeTrain})
+	if !isTransit || vehicle != VehicleTypeBicycle {
+		t.Fatalf("expected bicycle on transit, got %d %v", vehicle, isTransit)
+	}
+
+	vehicle, isTransit = getVehicleType([]fptf.Mode{fptf.ModeTrain})
+	if !isTransit || vehicle != VehicleTypeWalking {
+		t.Fatalf("expected walking on transit, got %d %v", vehicle, isTransit)
+	}
+}
+
+func TestBikeOnBoard(t *testing.T) {
+	b := (&Bifrost{}).withBikeOnBoard()
+
+	route := &Route{Stops: []uint64{0, 1}}
+	stopTimes := []Stopover{{}, {}}
+
+	if b.canEnter(route, &Trip{StopTimes: stopTimes}, 0, 0, 0) {
+		t.Fatal("expected trip without bikes_allowed to be rejected")
+	}
+
+	if !b.canEnter(route, &Trip{Bikes: AccessibilityYes, StopTimes: stopTimes}, 0, 0, 0) {
+		t.Fatal("expected trip allowing bicycles to be entered")
+	}
+
+	if b.arcDistance(&Arc{WalkDistance: 1000}, VehicleTypeBicycle) != 1000 {
+		t.Fatal("expected bicycle to be pushed along walking arcs")
+	}
+
+	vehicles := tripVehicles(&Trip{}, 1<<VehicleTypeBicycle|1<<VehicleTypeWalking)
+	if vehicles != 1<<VehicleTypeWalking {
+		t.Fatalf("expected bicycle to be left behind, got %b", vehicles)
+	}
+}
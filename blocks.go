@@ -0,0 +1,209 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+)
+
+// maximum number of trips followed, when staying seated in a vehicle
+const maxBlockLength = 50
+
+// continueInSeat follows the vehicle of a trip, that continues as another trip of its block. The stops of the following
+// trips are labelled in the same round, as staying seated is not a transfer.
+func (b *Bifrost) continueInSeat(rounds *Rounds, next *Round, target uint64, tripKey uint32, day uint32, vehicles uint8) {
+	prev := b.Data.tripAt(tripKey, day)
+
+	for i := 0; i < maxBlockLength; i++ {
+		nextKey, ok := b.Data.BlockNext[tripKey]
+		if !ok {
+			return
+		}
+
+		trip := b.Data.tripOnDay(nextKey, day)
+		if trip == nil {
+			return
+		}
+
+		if trip.StopTimes[0].DepartureAt(b.Data.dayStart(trip, uint64(day))) < prev.StopTimes[len(prev.StopTimes)-1].ArrivalAt(b.Data.dayStart(prev, uint64(day))) {
+			return
+		}
+
+		route := b.Data.Routes[b.Data.TripToRoute[nextKey]]
+		if !rounds.routeAllowed(route) {
+			return
+		}
+
+		for stopSeqKey := 1; stopSeqKey < len(route.Stops); stopSeqKey++ {
+			if !b.canLeave(route, trip, nextKey, day, uint32(stopSeqKey)) {
+				continue
+			}
+
+			stopKey := route.Stops[stopSeqKey]
+
+			arr := trip.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(trip, uint64(day)))
+			ea, ok := rounds.EarliestArrivals.Get(stopKey)
+			targetEa, targetOk := rounds.EarliestArrivals.Get(target)
+
+			if (!ok || arr < ea) && (!targetOk || arr < targetEa) {
+				next.Set(stopKey, StopArrival{
+					Arrival:   arr,
+					Trip:      nextKey,
+					EnterKey:  uint64(stopSeqKey),
+					Departure: uint64(day),
+					Vehicles:  vehicles,
+					InSeat:    true,
+				})
+				rounds.MarkedStops.Add(stopKey)
+				rounds.EarliestArrivals.Set(stopKey, arr)
+			}
+		}
+
+		prev = trip
+		tripKey = nextKey
+	}
+}
+
+// continueInSeatReverse is the reverse search counterpart of continueInSeat. It labels the stops of the trips, that
+// the vehicle of the trip ran as before.
+func (b *Bifrost) continueInSeatReverse(rounds *Rounds, next *Round, target uint64, tripKey uint32, day uint32, vehicles uint8) {
+	following := b.Data.tripAt(tripKey, day)
+
+	for i := 0; i < maxBlockLength; i++ {
+		prevKey, ok := b.Data.BlockPrevious[tripKey]
+		if !ok {
+			return
+		}
+
+		trip := b.Data.tripOnDay(prevKey, day)
+		if trip == nil {
+			return
+		}
+
+		if following.StopTimes[0].DepartureAt(b.Data.dayStart(following, uint64(day))) < trip.StopTimes[len(trip.StopTimes)-1].ArrivalAt(b.Data.dayStart(trip, uint64(day))) {
+			return
+		}
+
+		route := b.Data.Routes[b.Data.TripToRoute[prevKey]]
+		if !rounds.routeAllowed(route) {
+			return
+		}
+
+		for stopSeqKey := len(route.Stops) - 2; stopSeqKey >= 0; stopSeqKey-- {
+			if !b.canEnter(route, trip, prevKey, day, uint32(stopSeqKey)) {
+				continue
+			}
+
+			stopKey := route.Stops[stopSeqKey]
+
+			dep := trip.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(trip, uint64(day))) - b.TransferPaddingMs
+			ld, ok := rounds.EarliestArrivals.Get(stopKey)
+			targetLd, targetOk := rounds.EarliestArrivals.Get(target)
+
+			if (!ok || dep > ld) && (!targetOk || dep > targetLd) {
+				next.Set(stopKey, StopArrival{
+					Arrival:   dep,
+					Trip:      prevKey,
+					EnterKey:  uint64(stopSeqKey),
+					Departure: uint64(day),
+					Vehicles:  vehicles,
+					InSeat:    true,
+				})
+				rounds.MarkedStops.Add(stopKey)
+				rounds.EarliestArrivals.Set(stopKey, dep)
+			}
+		}
+
+		following = trip
+		tripKey = prevKey
+	}
+}
+
+// getTripFromInSeatTrip follows the block of a trip entered by staying seated back to the trip, that was boarded in
+// the previous round. The trips are merged into a single leg.
+func (b *Bifrost) getTripFromInSeatTrip(round *Round, arrival StopArrival) (*fptf.Trip, uint64, error) {
+	r := b.Data
+
+	legs := []*fptf.Trip{r.getTransitTrip(arrival.Trip, 0, int(arrival.EnterKey), arrival.Departure)}
+	tripKey := arrival.Trip
+
+	for i := 0; i < maxBlockLength; i++ {
+		prevKey, ok := r.BlockPrevious[tripKey]
+		if !ok {
+			break
+		}
+
+		route := r.Routes[r.TripToRoute[prevKey]]
+		exitKey := len(route.Stops) - 1
+
+		enterKey := b.findEnterKey(round, prevKey, exitKey, arrival.Departure)
+		if enterKey != -1 {
+			legs = append(legs, r.getTransitTrip(prevKey, enterKey, exitKey, arrival.Departure))
+			reverseTrips(legs)
+			return mergeInSeatTrips(legs), route.Stops[enterKey], nil
+		}
+
+		legs = append(legs, r.getTransitTrip(prevKey, 0, exitKey, arrival.Departure))
+		tripKey = prevKey
+	}
+
+	return nil, 0, &JourneyError{
+		Vertex: b.Data.Routes[b.Data.tripRoute(arrival.Trip)].Stops[arrival.EnterKey],
+		Reason: fmt.Sprint("no enter key found for in-seat trip ", arrival.Trip),
+	}
+}
+
+// getTripFromInSeatTripReverse is the reverse search counterpart of getTripFromInSeatTrip.
+func (b *Bifrost) getTripFromInSeatTripReverse(round *Round, departure StopArrival) (*fptf.Trip, uint64, error) {
+	r := b.Data
+
+	route := r.Routes[r.tripRoute(departure.Trip)]
+	legs := []*fptf.Trip{r.getTransitTrip(departure.Trip, int(departure.EnterKey), len(route.Stops)-1, departure.Departure)}
+	tripKey := departure.Trip
+
+	for i := 0; i < maxBlockLength; i++ {
+		nextKey, ok := r.BlockNext[tripKey]
+		if !ok {
+			break
+		}
+
+		route = r.Routes[r.TripToRoute[nextKey]]
+
+		exitKey := b.findExitKey(round, nextKey, 0, departure.Departure)
+		if exitKey != -1 {
+			legs = append(legs, r.getTransitTrip(nextKey, 0, exitKey, departure.Departure))
+			return mergeInSeatTrips(legs), route.Stops[exitKey], nil
+		}
+
+		legs = append(legs, r.getTransitTrip(nextKey, 0, len(route.Stops)-1, departure.Departure))
+		tripKey = nextKey
+	}
+
+	return nil, 0, &JourneyError{
+		Vertex: b.Data.Routes[b.Data.tripRoute(departure.Trip)].Stops[departure.EnterKey],
+		Reason: fmt.Sprint("no exit key found for in-seat trip ", departure.Trip),
+	}
+}
+
+// mergeInSeatTrips merges consecutive legs of the same vehicle into one leg. The leg keeps the line of the first trip.
+func mergeInSeatTrips(legs []*fptf.Trip) *fptf.Trip {
+	merged := legs[0]
+
+	for _, leg := range legs[1:] {
+		last := merged.Stopovers[len(merged.Stopovers)-1]
+		last.Departure = leg.Stopovers[0].Departure
+
+		merged.Stopovers = append(merged.Stopovers, leg.Stopovers[1:]...)
+		merged.Destination = leg.Destination
+		merged.Arrival = leg.Arrival
+		merged.Direction = leg.Direction
+	}
+
+	return merged
+}
+
+func reverseTrips(trips []*fptf.Trip) {
+	for i := len(trips)/2 - 1; i >= 0; i-- {
+		opp := len(trips) - 1 - i
+		trips[i], trips[opp] = trips[opp], trips[i]
+	}
+}
@@ -0,0 +1,37 @@
+package bifrost
+
+import "testing"
+
+func TestLinkBlocks(t *testing.T) {
+	stopTimes := []*gtfsStopTime{
+		{StopKey: 0, Departure: 1000, Arrival: 1000, StopSeq: 1},
+		{StopKey: 1, Departure: 2000, Arrival: 2000, StopSeq: 2},
+		{StopKey: 1, Departure: 3000, Arrival: 3000, StopSeq: 1},
+		{StopKey: 2, Departure: 4000, Arrival: 4000, StopSeq: 2},
+		{StopKey: 2, Departure: 5000, Arrival: 5000, StopSeq: 1},
+		{StopKey: 3, Departure: 6000, Arrival: 6000, StopSeq: 2},
+	}
+
+	procTrips := [][]uint32{{0, 1}, {2, 3}, {4, 5}}
+
+	trips := make([]*Trip, len(procTrips))
+	for i, trip := range procTrips {
+		trips[i] = &Trip{
+			StopTimes: []Stopover{
+				{Arrival: stopTimes[trip[0]].Arrival, Departure: stopTimes[trip[0]].Departure},
+				{Arrival: stopTimes[trip[1]].Arrival, Departure: stopTimes[trip[1]].Departure},
+			},
+		}
+	}
+
+	// the last trip belongs to the block, but runs on another service
+	blockNext := linkBlocks(trips, procTrips, stopTimes, []string{"a", "a", "a"}, []uint32{0, 0, 1})
+
+	if next, ok := blockNext[0]; !ok || next != 1 {
+		t.Fatalf("expected trip 0 to continue as trip 1, got %v", blockNext)
+	}
+
+	if _, ok := blockNext[1]; ok {
+		t.Fatalf("expected trip 1 not to continue, got %v", blockNext)
+	}
+}
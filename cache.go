@@ -0,0 +1,639 @@
+package bifrost
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// The binary bifrost cache stores the large arrays of the routing data flat, in the memory layout of the platform, so
+// they are used directly from the memory mapped file instead of being decoded. Nested slices like the street graph are
+// stored as values and offsets (CSR): the arcs of vertex i are arcs[offsets[i]:offsets[i+1]]. Everything else is
+// stored gob encoded in the meta section. The file starts with a cacheHeader, each section is aligned to 8 bytes.
+
+var cacheMagic = [8]byte{'B', 'I', 'F', 'R', 'O', 'S', 'T', 0}
+
+// version of the binary cache format, increase on every change of the format
+const cacheVersion = 2
+
+// sections of the binary cache
+const (
+	cacheSectionMeta = iota // gob encoded cacheMeta
+	cacheSectionArcs
+	cacheSectionArcOffsets
+	cacheSectionStopTimes
+	cacheSectionStopTimeOffsets
+	cacheSectionTrips
+	cacheSectionRouteStops
+	cacheSectionRouteStopOffsets
+	cacheSectionRouteTrips
+	cacheSectionRouteTripOffsets
+	cacheSectionRouteModes
+	cacheSectionStopRoutes
+	cacheSectionStopRouteOffsets
+	cacheSectionCoordinates
+	cacheSectionGtfsRouteIndex
+	cacheSectionTripToRoute
+	cacheSectionSegments
+	cacheSectionFingerprint // json encoded CacheFingerprint, empty if unknown
+	cacheSectionCount
+)
+
+type cacheHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Layout   uint32 // see cacheLayout
+	Sections [cacheSectionCount]cacheSection
+}
+
+type cacheSection struct {
+	Offset uint64 // in bytes from the start of the file
+	Length uint64 // in bytes
+}
+
+// cacheMeta contains the routing data, that is not stored flat.
+type cacheMeta struct {
+	MaxTripDayLength uint32
+	Services         []*Service
+	Timezones        []*Timezone
+	Reorders         map[uint64][]uint32
+	Transfers        map[uint64][]TransferRule
+	BlockNext        map[uint32]uint32
+	BlockPrevious    map[uint32]uint32
+	Parkings         map[uint64]uint8
+	StopsIndex       map[string]uint64
+	RouteInformation []*RouteInformation
+	TripInformation  []*TripInformation
+	Stops            map[uint64]*StopContext // vertex -> stop
+}
+
+// flat trip without its stop times
+type cacheTrip struct {
+	Service    uint32
+	Wheelchair Accessibility
+	Bikes      Accessibility
+}
+
+type cacheCoordinate struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type cacheSegment struct {
+	Segment OsmSegment
+	Vertex  uint64
+}
+
+// cacheLayout returns a checksum of the memory layout of the flat types, so caches written on a platform with another
+// layout or byte order are rejected.
+func cacheLayout() uint32 {
+	one := uint16(1)
+	littleEndian := *(*byte)(unsafe.Pointer(&one)) == 1
+
+	layout := fmt.Sprint(
+		littleEndian,
+		unsafe.Sizeof(Arc{}), unsafe.Offsetof(Arc{}.WalkDistance), unsafe.Offsetof(Arc{}.Inaccessible),
+		unsafe.Sizeof(Stopover{}), unsafe.Offsetof(Stopover{}.Pickup),
+		unsafe.Sizeof(StopRoutePair{}),
+		unsafe.Sizeof(cacheTrip{}), unsafe.Offsetof(cacheTrip{}.Bikes),
+		unsafe.Sizeof(cacheCoordinate{}),
+		unsafe.Sizeof(cacheSegment{}),
+	)
+
+	return crc32.ChecksumIEEE([]byte(layout))
+}
+
+// isBifrostCache returns true, if the file is a binary bifrost cache and not a json cache of WriteBifrostData.
+func isBifrostCache(fileName string) (bool, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := [8]byte{}
+	_, err = io.ReadFull(f, magic[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return magic == cacheMagic, nil
+}
+
+// WriteBifrostCache writes the routing data to a binary bifrost cache, that is read by AddBifrostCache. The cache has
+// no fingerprint, so LoadData only rebuilds it, if an input is modified after it was written.
+func (b *Bifrost) WriteBifrostCache(fileName string) error {
+	return b.writeBifrostCache(fileName, nil)
+}
+
+// writeBifrostCache writes a binary bifrost cache with the fingerprint of the inputs it was built from.
+func (b *Bifrost) writeBifrostCache(fileName string, fingerprint *CacheFingerprint) error {
+	sections, err := encodeCache(b.Data)
+	if err != nil {
+		return err
+	}
+
+	if fingerprint != nil {
+		sections[cacheSectionFingerprint], err = json.Marshal(fingerprint)
+		if err != nil {
+			return fmt.Errorf("error encoding bifrost cache fingerprint: %w", err)
+		}
+	}
+
+	header := cacheHeader{
+		Magic:   cacheMagic,
+		Version: cacheVersion,
+		Layout:  cacheLayout(),
+	}
+
+	offset := uint64(binary.Size(header))
+	for i, section := range sections {
+		offset = alignCacheOffset(offset)
+		header.Sections[i] = cacheSection{
+			Offset: offset,
+			Length: uint64(len(section)),
+		}
+		offset += uint64(len(section))
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating bifrost cache directory: %w", err)
+	}
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating bifrost cache: %w", err)
+	}
+	defer f.Close()
+
+	write := bufio.NewWriter(f)
+
+	err = binary.Write(write, binary.LittleEndian, &header)
+	if err != nil {
+		return fmt.Errorf("error writing bifrost cache: %w", err)
+	}
+
+	offset = uint64(binary.Size(header))
+	for i, section := range sections {
+		padding := header.Sections[i].Offset - offset
+		_, err = write.Write(make([]byte, padding))
+		if err != nil {
+			return fmt.Errorf("error writing bifrost cache: %w", err)
+		}
+
+		_, err = write.Write(section)
+		if err != nil {
+			return fmt.Errorf("error writing bifrost cache: %w", err)
+		}
+
+		offset = header.Sections[i].Offset + header.Sections[i].Length
+	}
+
+	err = write.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing bifrost cache: %w", err)
+	}
+
+	return f.Close()
+}
+
+func alignCacheOffset(offset uint64) uint64 {
+	return (offset + 7) &^ 7
+}
+
+// encodeCache returns the bytes of each section of the routing data.
+func encodeCache(r *RoutingData) ([cacheSectionCount][]byte, error) {
+	sections := [cacheSectionCount][]byte{}
+
+	err := r.EnsureSliceLengths()
+	if err != nil {
+		return sections, err
+	}
+
+	meta := &cacheMeta{
+		MaxTripDayLength: r.MaxTripDayLength,
+		Services:         r.Services,
+		Timezones:        r.Timezones,
+		Reorders:         r.Reorders,
+		Transfers:        r.Transfers,
+		BlockNext:        r.BlockNext,
+		BlockPrevious:    r.BlockPrevious,
+		Parkings:         r.Parkings,
+		StopsIndex:       r.StopsIndex,
+		RouteInformation: r.RouteInformation,
+		TripInformation:  r.TripInformation,
+		Stops:            make(map[uint64]*StopContext),
+	}
+
+	coordinates := make([]cacheCoordinate, len(r.Vertices))
+	for i, vertex := range r.Vertices {
+		coordinates[i] = cacheCoordinate{
+			Latitude:  vertex.Latitude,
+			Longitude: vertex.Longitude,
+		}
+
+		if vertex.Stop != nil {
+			meta.Stops[uint64(i)] = vertex.Stop
+		}
+	}
+
+	encodedMeta := &bytes.Buffer{}
+	err = gob.NewEncoder(encodedMeta).Encode(meta)
+	if err != nil {
+		return sections, fmt.Errorf("error encoding bifrost cache: %w", err)
+	}
+
+	trips := make([]cacheTrip, len(r.Trips))
+	stopTimes := make([][]Stopover, len(r.Trips))
+	for i, trip := range r.Trips {
+		trips[i] = cacheTrip{
+			Service:    trip.Service,
+			Wheelchair: trip.Wheelchair,
+			Bikes:      trip.Bikes,
+		}
+		stopTimes[i] = trip.StopTimes
+	}
+
+	routeStops := make([][]uint64, len(r.Routes))
+	routeTrips := make([][]uint32, len(r.Routes))
+	routeModes := make([]TransitMode, len(r.Routes))
+	for i, route := range r.Routes {
+		routeStops[i] = route.Stops
+		routeTrips[i] = route.Trips
+		routeModes[i] = route.Mode
+	}
+
+	segments := make([]cacheSegment, 0, len(r.NodesIndex))
+	for segment, vertex := range r.NodesIndex {
+		segments = append(segments, cacheSegment{
+			Segment: segment,
+			Vertex:  vertex,
+		})
+	}
+
+	sections[cacheSectionMeta] = encodedMeta.Bytes()
+	sections[cacheSectionArcs], sections[cacheSectionArcOffsets] = flattenCache(r.StreetGraph)
+	sections[cacheSectionStopTimes], sections[cacheSectionStopTimeOffsets] = flattenCache(stopTimes)
+	sections[cacheSectionTrips] = cacheBytes(trips)
+	sections[cacheSectionRouteStops], sections[cacheSectionRouteStopOffsets] = flattenCache(routeStops)
+	sections[cacheSectionRouteTrips], sections[cacheSectionRouteTripOffsets] = flattenCache(routeTrips)
+	sections[cacheSectionRouteModes] = cacheBytes(routeModes)
+	sections[cacheSectionStopRoutes], sections[cacheSectionStopRouteOffsets] = flattenCache(r.StopToRoutes)
+	sections[cacheSectionCoordinates] = cacheBytes(coordinates)
+	sections[cacheSectionGtfsRouteIndex] = cacheBytes(r.GtfsRouteIndex)
+	sections[cacheSectionTripToRoute] = cacheBytes(r.TripToRoute)
+	sections[cacheSectionSegments] = cacheBytes(segments)
+
+	return sections, nil
+}
+
+// cacheBytes returns the memory of the slice as bytes without copying it.
+func cacheBytes[T any](values []T) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), len(values)*int(unsafe.Sizeof(values[0])))
+}
+
+// flattenCache returns the concatenated values and the offsets of the lists as bytes.
+func flattenCache[T any](lists [][]T) ([]byte, []byte) {
+	offsets := make([]uint64, len(lists)+1)
+	for i, list := range lists {
+		offsets[i+1] = offsets[i] + uint64(len(list))
+	}
+
+	values := make([]T, 0, offsets[len(lists)])
+	for _, list := range lists {
+		values = append(values, list...)
+	}
+
+	return cacheBytes(values), cacheBytes(offsets)
+}
+
+// AddBifrostCache adds a binary bifrost cache written by WriteBifrostCache to the Bifrost data. The file is memory
+// mapped where supported, so the flat arrays are not copied. The mapping is private, changes to the routing data are
+// not written back to the file. All indices are checked once while loading, a corrupt cache returns a CacheError.
+func (b *Bifrost) AddBifrostCache(fileName string) error {
+	data, err := mapCacheFile(fileName)
+	if err != nil {
+		return fmt.Errorf("error reading bifrost cache: %w", err)
+	}
+
+	r, err := decodeCache(data)
+	if err != nil {
+		return &CacheError{Path: fileName, Err: err}
+	}
+
+	return b.MergeData(r)
+}
+
+// decodeCache returns the routing data of a binary cache. The flat arrays are used without copying data.
+func decodeCache(data []byte) (*RoutingData, error) {
+	header := cacheHeader{}
+
+	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	if header.Magic != cacheMagic {
+		return nil, fmt.Errorf("not a binary bifrost cache")
+	}
+
+	if header.Version != cacheVersion {
+		return nil, fmt.Errorf("unsupported cache version %d, expected %d", header.Version, cacheVersion)
+	}
+
+	if header.Layout != cacheLayout() {
+		return nil, fmt.Errorf("the cache was written on a platform with another memory layout")
+	}
+
+	sections := make([][]byte, cacheSectionCount)
+	for i, section := range header.Sections {
+		if section.Offset%8 != 0 || section.Offset > uint64(len(data)) || section.Length > uint64(len(data))-section.Offset {
+			return nil, fmt.Errorf("section %d is out of bounds", i)
+		}
+
+		sections[i] = data[section.Offset : section.Offset+section.Length]
+	}
+
+	meta := &cacheMeta{}
+	err = gob.NewDecoder(bytes.NewReader(sections[cacheSectionMeta])).Decode(meta)
+	if err != nil {
+		return nil, fmt.Errorf("invalid meta section: %w", err)
+	}
+
+	r := &RoutingData{
+		MaxTripDayLength: meta.MaxTripDayLength,
+		Services:         meta.Services,
+		Timezones:        meta.Timezones,
+		Reorders:         meta.Reorders,
+		Transfers:        meta.Transfers,
+		BlockNext:        meta.BlockNext,
+		BlockPrevious:    meta.BlockPrevious,
+		Parkings:         meta.Parkings,
+		StopsIndex:       meta.StopsIndex,
+		RouteInformation: meta.RouteInformation,
+		TripInformation:  meta.TripInformation,
+	}
+
+	var routeStops [][]uint64
+	var routeTrips [][]uint32
+	var routeModes []TransitMode
+	var stopTimes [][]Stopover
+	var trips []cacheTrip
+	var coordinates []cacheCoordinate
+	var segments []cacheSegment
+
+	for _, err := range []error{
+		unflattenCache(sections, cacheSectionArcs, cacheSectionArcOffsets, &r.StreetGraph),
+		unflattenCache(sections, cacheSectionStopRoutes, cacheSectionStopRouteOffsets, &r.StopToRoutes),
+		unflattenCache(sections, cacheSectionStopTimes, cacheSectionStopTimeOffsets, &stopTimes),
+		unflattenCache(sections, cacheSectionRouteStops, cacheSectionRouteStopOffsets, &routeStops),
+		unflattenCache(sections, cacheSectionRouteTrips, cacheSectionRouteTripOffsets, &routeTrips),
+		viewCache(sections[cacheSectionRouteModes], &routeModes),
+		viewCache(sections[cacheSectionTrips], &trips),
+		viewCache(sections[cacheSectionCoordinates], &coordinates),
+		viewCache(sections[cacheSectionSegments], &segments),
+		viewCache(sections[cacheSectionGtfsRouteIndex], &r.GtfsRouteIndex),
+		viewCache(sections[cacheSectionTripToRoute], &r.TripToRoute),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(trips) != len(stopTimes) || len(routeModes) != len(routeStops) || len(routeModes) != len(routeTrips) ||
+		len(coordinates) != len(r.StreetGraph) || len(coordinates) != len(r.StopToRoutes) {
+		return nil, fmt.Errorf("section lengths do not match")
+	}
+
+	r.Trips = make([]*Trip, len(trips))
+	for i, trip := range trips {
+		r.Trips[i] = &Trip{
+			Service:    trip.Service,
+			Wheelchair: trip.Wheelchair,
+			Bikes:      trip.Bikes,
+			StopTimes:  stopTimes[i],
+		}
+	}
+
+	r.Routes = make([]*Route, len(routeModes))
+	for i, mode := range routeModes {
+		r.Routes[i] = &Route{
+			Stops: routeStops[i],
+			Trips: routeTrips[i],
+			Mode:  mode,
+		}
+	}
+
+	r.Vertices = make([]Vertex, len(coordinates))
+	for i, coordinate := range coordinates {
+		r.Vertices[i] = Vertex{
+			Latitude:  coordinate.Latitude,
+			Longitude: coordinate.Longitude,
+			Stop:      meta.Stops[uint64(i)],
+		}
+	}
+
+	r.NodesIndex = make(map[OsmSegment]uint64, len(segments))
+	for _, segment := range segments {
+		r.NodesIndex[segment.Segment] = segment.Vertex
+	}
+
+	err = r.EnsureSliceLengths()
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCacheIndices(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// checkCacheIndices checks, that every index read from the cache points into its slice. The layout checksum only
+// covers the memory layout, so a truncated or otherwise corrupt cache would decode fine and panic during routing
+// otherwise.
+func checkCacheIndices(r *RoutingData) error {
+	vertexCount := uint64(len(r.Vertices))
+	tripCount := uint32(len(r.Trips))
+	routeCount := uint32(len(r.Routes))
+
+	for vertex, arcs := range r.StreetGraph {
+		for _, arc := range arcs {
+			if arc.Target >= vertexCount {
+				return fmt.Errorf("arc of vertex %d points to vertex %d of %d", vertex, arc.Target, vertexCount)
+			}
+		}
+	}
+
+	for vertex, pairs := range r.StopToRoutes {
+		for _, pair := range pairs {
+			if pair.Route >= routeCount || pair.StopKeyInTrip >= uint32(len(r.Routes[pair.Route].Stops)) {
+				return fmt.Errorf("stop %d refers to stop %d of route %d, which does not exist", vertex, pair.StopKeyInTrip, pair.Route)
+			}
+		}
+	}
+
+	for routeKey, route := range r.Routes {
+		if len(route.Trips) == 0 {
+			return fmt.Errorf("route %d has no trips", routeKey)
+		}
+
+		for _, stop := range route.Stops {
+			if stop >= vertexCount {
+				return fmt.Errorf("route %d stops at vertex %d of %d", routeKey, stop, vertexCount)
+			}
+		}
+
+		for _, tripKey := range route.Trips {
+			if tripKey >= tripCount || len(r.Trips[tripKey].StopTimes) != len(route.Stops) {
+				return fmt.Errorf("route %d refers to trip %d, which does not exist or has other stops", routeKey, tripKey)
+			}
+		}
+	}
+
+	for routeStopKey, reorder := range r.Reorders {
+		routeKey := uint32(routeStopKey >> 32)
+		if routeKey >= routeCount || uint32(routeStopKey) >= uint32(len(r.Routes[routeKey].Stops)) || len(reorder) != len(r.Routes[routeKey].Trips) {
+			return fmt.Errorf("trip order of route %d does not match its trips", routeKey)
+		}
+
+		for _, i := range reorder {
+			if i >= uint32(len(reorder)) {
+				return fmt.Errorf("trip order of route %d refers to trip %d of %d", routeKey, i, len(reorder))
+			}
+		}
+	}
+
+	for tripKey, trip := range r.Trips {
+		if trip.Service >= uint32(len(r.Services)) {
+			return fmt.Errorf("trip %d runs on service %d of %d", tripKey, trip.Service, len(r.Services))
+		}
+
+		if r.TripToRoute[tripKey] >= routeCount {
+			return fmt.Errorf("trip %d belongs to route %d of %d", tripKey, r.TripToRoute[tripKey], routeCount)
+		}
+	}
+
+	if len(r.TripInformation) != len(r.Trips) {
+		return fmt.Errorf("trip information length mismatch: %d != %d", len(r.TripInformation), len(r.Trips))
+	}
+
+	for routeKey, gtfsRoute := range r.GtfsRouteIndex {
+		if gtfsRoute >= uint32(len(r.RouteInformation)) {
+			return fmt.Errorf("route %d refers to gtfs route %d of %d", routeKey, gtfsRoute, len(r.RouteInformation))
+		}
+	}
+
+	if len(r.Timezones) > 0 {
+		for i, service := range r.Services {
+			if service.Timezone >= uint32(len(r.Timezones)) {
+				return fmt.Errorf("service %d uses timezone %d of %d", i, service.Timezone, len(r.Timezones))
+			}
+		}
+	}
+
+	for prev, next := range r.BlockNext {
+		if prev >= tripCount || next >= tripCount {
+			return fmt.Errorf("block links trip %d to trip %d of %d", prev, next, tripCount)
+		}
+	}
+
+	for segment, vertex := range r.NodesIndex {
+		if vertex >= vertexCount {
+			return fmt.Errorf("osm segment %v points to vertex %d of %d", segment, vertex, vertexCount)
+		}
+	}
+
+	for id, vertex := range r.StopsIndex {
+		if vertex >= vertexCount {
+			return fmt.Errorf("stop %s points to vertex %d of %d", id, vertex, vertexCount)
+		}
+	}
+
+	return nil
+}
+
+// viewCache points values to the memory of the section without copying it.
+func viewCache[T any](section []byte, values *[]T) error {
+	if len(section) == 0 {
+		*values = nil
+		return nil
+	}
+
+	size := int(unsafe.Sizeof(*new(T)))
+	if len(section)%size != 0 {
+		return fmt.Errorf("section length %d is not a multiple of %d", len(section), size)
+	}
+
+	*values = unsafe.Slice((*T)(unsafe.Pointer(&section[0])), len(section)/size)
+	return nil
+}
+
+// unflattenCache splits the values section at the offsets section into lists. The lists are capped, so appending to
+// them copies them instead of overwriting the next list.
+func unflattenCache[T any](sections [][]byte, valuesSection int, offsetsSection int, lists *[][]T) error {
+	var values []T
+	var offsets []uint64
+
+	err := viewCache(sections[valuesSection], &values)
+	if err != nil {
+		return err
+	}
+
+	err = viewCache(sections[offsetsSection], &offsets)
+	if err != nil {
+		return err
+	}
+
+	if len(offsets) == 0 {
+		*lists = nil
+		return nil
+	}
+
+	if offsets[0] != 0 || offsets[len(offsets)-1] != uint64(len(values)) {
+		return fmt.Errorf("offsets of section %d do not match its length", valuesSection)
+	}
+
+	result := make([][]T, len(offsets)-1)
+	for i := range result {
+		start, end := offsets[i], offsets[i+1]
+		if start > end {
+			return fmt.Errorf("offsets of section %d are not sorted", valuesSection)
+		}
+
+		result[i] = values[start:end:end]
+	}
+
+	*lists = result
+	return nil
+}
+
+// ConvertBifrostData converts a json bifrost cache written by WriteBifrostData to a binary bifrost cache.
+func ConvertBifrostData(jsonFileName string, cacheFileName string) error {
+	b := &Bifrost{}
+
+	err := b.AddBifrostData(jsonFileName)
+	if err != nil {
+		return err
+	}
+
+	return b.WriteBifrostCache(cacheFileName)
+}
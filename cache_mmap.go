@@ -0,0 +1,29 @@
+//go:build unix
+
+package bifrost
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapCacheFile maps the file into memory. The mapping is private and writable, so the routing data can be changed
+// without changing the file. It is never unmapped, as the routing data points into it.
+func mapCacheFile(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		return nil, nil
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
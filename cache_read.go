@@ -0,0 +1,12 @@
+//go:build !unix
+
+package bifrost
+
+import (
+	"os"
+)
+
+// mapCacheFile reads the whole file, as memory mapping is not supported on this platform.
+func mapCacheFile(fileName string) ([]byte, error) {
+	return os.ReadFile(fileName)
+}
@@ -0,0 +1,147 @@
+package bifrost
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBifrostCache(t *testing.T) {
+	data := newRealtimeTestData()
+	data.StreetGraph = [][]Arc{
+		{{Target: 1, WalkDistance: 100}},
+		{{Target: 0, WalkDistance: 100}, {Target: 2, WalkDistance: 200, Inaccessible: true}},
+		{},
+	}
+	data.NodesIndex = map[OsmSegment]uint64{{Source: 1, Target: 2}: 1}
+	data.Transfers = map[uint64][]TransferRule{1: {{FromStop: 0, FromRoute: TransferAny, ToRoute: TransferAny, FromTrip: TransferAny, ToTrip: TransferAny}}}
+	data.Timezones = []*Timezone{{Name: "UTC", FirstDay: 10, Offsets: []int32{0, 0}}}
+
+	dir := t.TempDir()
+
+	b := &Bifrost{Data: data}
+	err := b.WriteBifrostCache(filepath.Join(dir, "data.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary, err := isBifrostCache(filepath.Join(dir, "data.bifrost"))
+	if err != nil || !binary {
+		t.Fatalf("expected a binary cache, got %v (%v)", binary, err)
+	}
+
+	cached := &Bifrost{}
+	err = cached.AddBifrostCache(filepath.Join(dir, "data.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, pair := range map[string][2]interface{}{
+		"street graph":   {data.StreetGraph, cached.Data.StreetGraph},
+		"routes":         {data.Routes, cached.Data.Routes},
+		"trips":          {data.Trips, cached.Data.Trips},
+		"vertices":       {data.Vertices, cached.Data.Vertices},
+		"stop to routes": {data.StopToRoutes, cached.Data.StopToRoutes},
+		"nodes index":    {data.NodesIndex, cached.Data.NodesIndex},
+		"transfers":      {data.Transfers, cached.Data.Transfers},
+		"timezones":      {data.Timezones, cached.Data.Timezones},
+		"trip info":      {data.TripInformation, cached.Data.TripInformation},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Fatalf("expected cached %s %v, got %v", name, pair[0], pair[1])
+		}
+	}
+
+	// appending to the arcs of a vertex must not overwrite the arcs of the next one in the mapped file
+	cached.Data.StreetGraph[0] = append(cached.Data.StreetGraph[0], Arc{Target: 2})
+	if cached.Data.StreetGraph[1][0].Target != 0 {
+		t.Fatal("expected the arcs of vertex 1 to be unchanged")
+	}
+
+	empty := &Bifrost{Data: &RoutingData{}}
+	err = empty.WriteBifrostCache(filepath.Join(dir, "empty.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = empty.AddBifrostCache(filepath.Join(dir, "empty.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.WriteBifrostData(filepath.Join(dir, "data.json.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary, err = isBifrostCache(filepath.Join(dir, "data.json.bifrost"))
+	if err != nil || binary {
+		t.Fatalf("expected a json cache, got %v (%v)", binary, err)
+	}
+
+	err = ConvertBifrostData(filepath.Join(dir, "data.json.bifrost"), filepath.Join(dir, "converted.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted := &Bifrost{}
+	err = converted.AddBifrostCache(filepath.Join(dir, "converted.bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(converted.Data.Trips, data.Trips) {
+		t.Fatalf("expected converted trips %v, got %v", data.Trips, converted.Data.Trips)
+	}
+}
+
+func TestCorruptCacheIndices(t *testing.T) {
+	data := newRealtimeTestData()
+	data.StreetGraph = [][]Arc{{{Target: 1, WalkDistance: 100}}, {}, {}}
+
+	fileName := filepath.Join(t.TempDir(), "data.bifrost")
+
+	err := (&Bifrost{Data: data}).WriteBifrostCache(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := cacheHeader{}
+	err = binary.Read(bytes.NewReader(encoded), binary.LittleEndian, &header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite the first index of each section with one, that is out of range
+	for name, section := range map[string]int{
+		"arc target":    cacheSectionArcs,
+		"route stop":    cacheSectionRouteStops,
+		"route trip":    cacheSectionRouteTrips,
+		"trip service":  cacheSectionTrips,
+		"trip to route": cacheSectionTripToRoute,
+		"gtfs route":    cacheSectionGtfsRouteIndex,
+	} {
+		corrupt := append([]byte{}, encoded...)
+		binary.LittleEndian.PutUint32(corrupt[header.Sections[section].Offset:], 1000)
+
+		err = os.WriteFile(fileName, corrupt, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var cacheErr *CacheError
+		err = (&Bifrost{}).AddBifrostCache(fileName)
+		if !errors.As(err, &cacheErr) {
+			t.Fatalf("expected a cache error for a corrupt %s, got %v", name, err)
+		}
+	}
+}
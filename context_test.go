@@ -0,0 +1,89 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"github.com/Vector-Hector/fptf"
+	"testing"
+	"time"
+)
+
+// countdownContext is done after its error was checked the given number of times.
+type countdownContext struct {
+	context.Context
+	checks int
+}
+
+func (c *countdownContext) Err() error {
+	c.checks--
+	if c.checks < 0 {
+		return context.Canceled
+	}
+
+	return nil
+}
+
+func TestRouteContext(t *testing.T) {
+	const length = 5000
+
+	b := *DefaultBifrost
+	b.Data = &RoutingData{
+		Vertices:    make([]Vertex, length),
+		StreetGraph: make([][]Arc, length),
+	}
+
+	// a long chain of streets, that takes many dijkstra steps to walk along
+	for i := range b.Data.Vertices {
+		b.Data.Vertices[i] = Vertex{Latitude: 48 + float64(i)/1000, Longitude: 11.5}
+		if i+1 < length {
+			b.Data.StreetGraph[i] = []Arc{{Target: uint64(i + 1), WalkDistance: 1000}}
+		}
+	}
+
+	err := b.Data.EnsureSliceLengths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Data.RebuildVertexTree()
+
+	origins := []SourceLocation{{
+		Location:  &fptf.Location{Latitude: 48, Longitude: 11.5},
+		Departure: time.Date(2023, 12, 12, 8, 30, 0, 0, time.UTC),
+	}}
+	dest := &fptf.Location{Latitude: 48 + float64(length-1)/1000, Longitude: 11.5}
+	modes := []fptf.Mode{fptf.ModeWalking}
+
+	rounds := b.NewRounds()
+
+	_, err = b.RouteContext(context.Background(), rounds, origins, dest, modes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first vertex is not reachable, so it is not used as origin
+	if rounds.EarliestArrivals.Len() != length-1 {
+		t.Fatalf("expected the search to reach %d vertices, got %d", length-1, rounds.EarliestArrivals.Len())
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = b.RouteContext(cancelled, rounds, origins, dest, modes, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled search, got %v", err)
+	}
+
+	// the first check is before the search, the next ones while walking along the chain
+	_, err = b.RouteContext(&countdownContext{Context: context.Background(), checks: 2}, rounds, origins, dest, modes, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a search cancelled during dijkstra, got %v", err)
+	}
+
+	if rounds.EarliestArrivals.Len() >= length/2 {
+		t.Fatalf("expected the search to stop early, but it reached %d vertices", rounds.EarliestArrivals.Len())
+	}
+
+	if rounds.ctx != nil {
+		t.Fatal("expected the context to be removed from the rounds after the search")
+	}
+}
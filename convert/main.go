@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Vector-Hector/bifrost"
+	"time"
+)
+
+// converts a json bifrost cache of older versions to a binary bifrost cache
+func main() {
+	in := flag.String("in", "data.bifrost", "path to the json bifrost cache")
+	out := flag.String("out", "data.bin.bifrost", "path to write the binary bifrost cache to")
+
+	flag.Parse()
+
+	start := time.Now()
+
+	err := bifrost.ConvertBifrostData(*in, *out)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("Converted", *in, "to", *out, "in", time.Since(start))
+}
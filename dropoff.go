@@ -0,0 +1,163 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+	"time"
+)
+
+// carAccessMode defines how a car is used to reach transit. It is set per query by the modes.
+type carAccessMode uint8
+
+const (
+	carAccessParkAndRide carAccessMode = iota // drive to a park and ride facility and park there, fptf.ModeCar
+	carAccessKissAndRide                      // get dropped off near a stop and picked up near the last stop, ModeKissAndRide
+	carAccessTaxi                             // take a taxi to the first and from the last stop, ModeTaxiAccess
+)
+
+// getCarAccess returns how the car of the modes is used to reach transit.
+func getCarAccess(modes []fptf.Mode) carAccessMode {
+	for _, mode := range modes {
+		switch mode {
+		case ModeKissAndRide:
+			return carAccessKissAndRide
+		case ModeTaxiAccess:
+			return carAccessTaxi
+		}
+	}
+
+	return carAccessParkAndRide
+}
+
+// withCarAccess returns a copy of b, that uses the car as given to reach transit.
+func (b *Bifrost) withCarAccess(access carAccessMode) *Bifrost {
+	query := *b
+	query.carAccess = access
+	return &query
+}
+
+// dropsOff returns true, if the traveller is dropped off and picked up by the vehicle near stops instead of parking it.
+func (b *Bifrost) dropsOff(vehicle VehicleType) bool {
+	return vehicle == VehicleTypeCar && b.carAccess != carAccessParkAndRide
+}
+
+// setCarLegMode marks a drive to or from transit as car leg. Taxi rides get the sub mode taxi, so they can be told
+// apart from taxi routes of the feeds, which are transit.
+func (b *Bifrost) setCarLegMode(trip *fptf.Trip) {
+	trip.Mode = fptf.ModeCar
+
+	if b.carAccess == carAccessTaxi {
+		trip.SubMode = "taxi"
+	}
+}
+
+// nearStop returns true, if the vertex is connected to a stop.
+func (r *RoutingData) nearStop(vertex uint64) bool {
+	for _, arc := range r.StreetGraph[vertex] {
+		if r.Vertices[arc.Target].Stop != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// driveToStops drives from the origins to all vertices near stops, that can be reached within MaxCarAccessMs, and
+// returns them as new origins next to the original ones. No parking is needed, so the transit search departs there
+// right away.
+func (b *Bifrost) driveToStops(rounds *Rounds, origins []SourceKey, destKey uint64) ([]SourceKey, error) {
+	b.runAccessSearch(rounds, origins, destKey, VehicleTypeCar, false)
+
+	dropOffs := append(make([]SourceKey, 0, len(origins)), origins...)
+
+	for i := 0; i < rounds.Access.Len(); i++ {
+		vertex, sa := rounds.Access.Entry(i)
+		if sa.Trip != TripIdCar || !b.Data.nearStop(vertex) {
+			continue
+		}
+
+		dropOffs = append(dropOffs, SourceKey{
+			StopKey:   vertex,
+			Departure: time.UnixMilli(int64(sa.Arrival)),
+		})
+	}
+
+	return dropOffs, nil
+}
+
+// driveFromStops searches backwards from the destination by car and keeps the labels in rounds.Egress. The
+// destination is matched to a vertex reachable by car separately, as the journey may still end on foot. The search
+// is limited by MaxCarAccessMs and does not go beyond the origin.
+func (b *Bifrost) driveFromStops(rounds *Rounds, originKey uint64, dest *fptf.Location, departure time.Time) error {
+	if len(b.Data.ReverseStreetGraph) != len(b.Data.StreetGraph) {
+		return fmt.Errorf("reverse street graph is not built, call RebuildReverseStreetGraph first")
+	}
+
+	pickUpKey, err := b.matchTargetLocation(dest, VehicleTypeCar, false)
+	if err != nil {
+		return err
+	}
+
+	egress := b.searchRounds(rounds, &rounds.egressSearch)
+
+	// the labels are only used relative to each other, the TransferTime holds the duration of the drive
+	latest := timeToMs(departure) + uint64(DayInMs)
+
+	egress.Rounds[0].Set(pickUpKey, StopArrival{Arrival: latest, Trip: TripIdOrigin, Vehicles: 1 << VehicleTypeCar})
+	egress.MarkedStopsForTransfer.Add(pickUpKey)
+	egress.EarliestArrivals.Set(pickUpKey, latest)
+
+	b.runTransferRoundReverse(egress, originKey, 0, VehicleTypeCar, false)
+
+	rounds.Egress = egress.Rounds[1]
+
+	return nil
+}
+
+// applyEgress labels the destination in the round, if it is reached earlier by driving from a labelled vertex near a
+// stop.
+func (b *Bifrost) applyEgress(rounds *Rounds, destKey uint64, current int) {
+	round := rounds.Rounds[current]
+
+	for i := 0; i < rounds.Egress.Len(); i++ {
+		vertex, egress := rounds.Egress.Entry(i)
+		if egress.Trip != TripIdCar {
+			continue
+		}
+
+		sa, ok := round.Get(vertex)
+		if !ok || vertex == destKey || !b.Data.nearStop(vertex) {
+			continue
+		}
+
+		arrival := sa.Arrival + uint64(egress.TransferTime)
+
+		if ea, ok := rounds.EarliestArrivals.Get(destKey); ok && ea <= arrival {
+			continue
+		}
+
+		round.Set(destKey, StopArrival{
+			Arrival:   arrival,
+			Trip:      TripIdEgress,
+			EnterKey:  vertex,
+			Departure: sa.Arrival,
+		})
+		rounds.EarliestArrivals.Set(destKey, arrival)
+	}
+}
+
+// getEgressTrip returns the drive from the vertex near the last stop to the destination.
+func (b *Bifrost) getEgressTrip(rounds *Rounds, arrival StopArrival) (*fptf.Trip, error) {
+	trip, _, err := GetTripFromTransferReverse(b.Data, rounds.Egress, arrival.EnterKey, TripIdCar)
+	if err != nil {
+		return nil, err
+	}
+	b.setCarLegMode(trip)
+
+	drive, _ := rounds.Egress.Get(arrival.EnterKey)
+	shift := time.Duration(int64(arrival.Departure)-int64(drive.Arrival)) * time.Millisecond
+
+	shiftJourney(&fptf.Journey{Trips: []*fptf.Trip{trip}}, shift)
+
+	return trip, nil
+}
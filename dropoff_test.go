@@ -0,0 +1,83 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"testing"
+	"time"
+)
+
+func TestDriveToStops(t *testing.T) {
+	b := &Bifrost{
+		CarMaxSpeed:    36.0 * 0.001,
+		MaxCarAccessMs: 1500,
+		Data: &RoutingData{
+			Vertices: []Vertex{{}, {}, {Stop: &StopContext{}}, {}},
+			StreetGraph: [][]Arc{
+				{{Target: 1, CarDistance: 1000}},
+				{{Target: 2, WalkDistance: 500}, {Target: 3, CarDistance: 1000}},
+				{{Target: 1, WalkDistance: 500}},
+				{{Target: 2, WalkDistance: 500}},
+			},
+		},
+	}
+
+	rounds := b.NewRounds()
+	departure := time.UnixMilli(int64(DayInMs) * 3)
+
+	origins, err := b.driveToStops(rounds, []SourceKey{{StopKey: 0, Departure: departure}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// vertex 3 is near the stop as well, but too far to drive to
+	if len(origins) != 2 || origins[1].StopKey != 1 || !origins[1].Departure.Equal(departure.Add(time.Second)) {
+		t.Fatalf("expected the origin and the vertex near the stop, got %v", origins)
+	}
+}
+
+func TestApplyEgress(t *testing.T) {
+	b := &Bifrost{
+		Data: &RoutingData{
+			Vertices:    []Vertex{{}, {Stop: &StopContext{}}, {}},
+			StreetGraph: [][]Arc{{{Target: 1, WalkDistance: 500}}, {}, {}},
+		},
+	}
+
+	rounds := b.NewRounds()
+	rounds.Egress = &Round{}
+	rounds.Egress.Set(0, StopArrival{Trip: TripIdCar, TransferTime: 2000})
+	rounds.Rounds[2].Set(0, StopArrival{Arrival: 10000, Trip: TripIdWalk})
+
+	b.applyEgress(rounds, 2, 2)
+
+	sa, ok := rounds.Rounds[2].Get(2)
+	if !ok || sa.Trip != TripIdEgress || sa.Arrival != 12000 || sa.EnterKey != 0 {
+		t.Fatalf("expected destination to be reached by car, got %+v", sa)
+	}
+}
+
+func TestCarAccessModes(t *testing.T) {
+	modes := []fptf.Mode{ModeTaxiAccess, fptf.ModeBus}
+
+	vehicle, isTransit := getVehicleType(modes)
+	if vehicle != VehicleTypeCar || !isTransit || getCarAccess(modes) != carAccessTaxi {
+		t.Fatalf("expected a taxi to transit, got vehicle %d, transit %v", vehicle, isTransit)
+	}
+
+	if getCarAccess([]fptf.Mode{fptf.ModeCar, fptf.ModeBus}) != carAccessParkAndRide {
+		t.Fatal("expected the car to be parked by default")
+	}
+
+	b := (&Bifrost{}).withCarAccess(carAccessTaxi)
+	trip := &fptf.Trip{}
+	b.setCarLegMode(trip)
+
+	if trip.Mode != fptf.ModeCar || trip.SubMode != "taxi" {
+		t.Fatalf("expected a car leg with sub mode taxi, got %s %s", trip.Mode, trip.SubMode)
+	}
+
+	journey := &fptf.Journey{Trips: []*fptf.Trip{trip, {Mode: fptf.ModeTaxi}, {Mode: fptf.ModeWalking}, {Mode: fptf.ModeBus}, trip}}
+	if transfers := journeyTransfers(journey); transfers != 1 {
+		t.Fatalf("expected the drives not to count as transfers, got %d", transfers)
+	}
+}
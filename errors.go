@@ -1,9 +1,74 @@
 package bifrost
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"github.com/Vector-Hector/bifrost/stream"
+	"github.com/Vector-Hector/fptf"
+	"time"
+)
 
+// ErrOutdatedCache is returned by LoadData with OutdatedCacheError, if the bifrost cache was built from other inputs or
+// parameters.
+var ErrOutdatedCache = errors.New("bifrost cache is outdated")
+
+// FeedError is returned while adding a gtfs feed, if a row is malformed. It names the file and line of the row.
+type FeedError = stream.FeedError
+
+// CacheError is returned, if a bifrost cache cannot be decoded, because it is corrupt or truncated.
+type CacheError struct {
+	Path string
+	Err  error
+}
+
+func (e *CacheError) Error() string {
+	return fmt.Sprintf("corrupt bifrost cache %s: %v", e.Path, e.Err)
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// NoRouteError is returned by the routing functions, if the destination cannot be reached from the origins.
 type NoRouteError bool
 
 func (e NoRouteError) Error() string {
 	return fmt.Sprintf("no route found")
 }
+
+// UnreachableError is returned by the routing functions, if there is no vertex of the street graph near a location of
+// the query, that can be used with the requested modes.
+type UnreachableError struct {
+	Location *fptf.Location
+	Origin   bool // whether the location is an origin or the destination
+}
+
+func (e *UnreachableError) Error() string {
+	role := "destination"
+	if e.Origin {
+		role = "origin"
+	}
+
+	return fmt.Sprintf("%s at %f, %f is not reachable", role, e.Location.Latitude, e.Location.Longitude)
+}
+
+// DepartureError is returned by the routing functions, if the departure or arrival time of the query is before
+// earliestRoutableTime.
+type DepartureError struct {
+	Departure time.Time
+}
+
+func (e *DepartureError) Error() string {
+	return fmt.Sprintf("departure %s is before %s", e.Departure.UTC().Format(time.RFC3339), earliestRoutableTime.UTC().Format(time.RFC3339))
+}
+
+// JourneyError is returned, if a journey cannot be reconstructed from the rounds of a search. The rounds are
+// inconsistent then, e.g. because they were used by another search in between.
+type JourneyError struct {
+	Vertex uint64 // vertex, at which the reconstruction failed
+	Reason string
+}
+
+func (e *JourneyError) Error() string {
+	return fmt.Sprintf("cannot reconstruct journey at vertex %d: %s", e.Vertex, e.Reason)
+}
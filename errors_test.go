@@ -0,0 +1,138 @@
+package bifrost
+
+import (
+	"errors"
+	"github.com/Vector-Hector/fptf"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFeedError(t *testing.T) {
+	source := fstest.MapFS{}
+	for name, content := range testFeed {
+		source[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	source["stop_times.txt"] = &fstest.MapFile{Data: []byte("trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"t,08:00:00,08:00:00,s0,1\n" +
+		"t,08:10,08:10:00,s1,2\n")}
+
+	b := &Bifrost{}
+	err := b.AddGtfsFS(source, "")
+
+	var feedErr *FeedError
+	if !errors.As(err, &feedErr) {
+		t.Fatalf("expected a feed error, got %v", err)
+	}
+
+	if feedErr.File != "stop_times.txt" || feedErr.Line != 3 {
+		t.Fatalf("expected the error at stop_times.txt:3, got %v", feedErr)
+	}
+}
+
+func TestCacheError(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "data.bifrost")
+
+	b := &Bifrost{Data: newRealtimeTestData()}
+	err := b.WriteBifrostCache(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(fileName, data[:len(data)/2], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cacheErr *CacheError
+
+	err = (&Bifrost{}).AddBifrostCache(fileName)
+	if !errors.As(err, &cacheErr) {
+		t.Fatalf("expected a cache error for a truncated cache, got %v", err)
+	}
+
+	err = os.WriteFile(fileName, []byte("not a cache"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&Bifrost{}).AddBifrostData(fileName)
+	if !errors.As(err, &cacheErr) {
+		t.Fatalf("expected a cache error for an invalid json cache, got %v", err)
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	b := *DefaultBifrost
+	b.Data = &RoutingData{
+		Vertices: []Vertex{
+			{Latitude: 48.1, Longitude: 11.5},
+			{Latitude: 48.1, Longitude: 11.501},
+			{Latitude: 48.2, Longitude: 11.6},
+			{Latitude: 48.2, Longitude: 11.601},
+		},
+		StreetGraph: [][]Arc{
+			{{Target: 1, WalkDistance: 100}},
+			{},
+			{{Target: 3, WalkDistance: 100}},
+			{},
+		},
+	}
+	err := b.Data.EnsureSliceLengths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Data.RebuildVertexTree()
+
+	departure := time.Date(2023, 12, 12, 8, 30, 0, 0, time.UTC)
+
+	_, err = b.RouteOnlyTimeIndependent(b.NewRounds(), []SourceKey{{StopKey: 1, Departure: departure}}, 3, VehicleTypeWalking, false)
+	if _, ok := err.(NoRouteError); !ok {
+		t.Fatalf("expected no route between the components, got %v", err)
+	}
+
+	_, err = b.Route(b.NewRounds(), []SourceLocation{{
+		Location:  &fptf.Location{Latitude: 48.1, Longitude: 11.5},
+		Departure: departure,
+	}}, &fptf.Location{Latitude: 48.2, Longitude: 11.6}, []fptf.Mode{fptf.ModeCar}, false)
+
+	var unreachable *UnreachableError
+	if !errors.As(err, &unreachable) || !unreachable.Origin {
+		t.Fatalf("expected an unreachable origin without car arcs, got %v", err)
+	}
+	_, err = b.RouteTransit(b.NewRounds(), []SourceKey{{StopKey: 1, Departure: time.Unix(0, 0)}}, 3, false)
+
+	var early *DepartureError
+	if !errors.As(err, &early) {
+		t.Fatalf("expected a departure error before the earliest routable time, got %v", err)
+	}
+
+	_, err = b.RouteOnlyTimeIndependent(b.NewRounds(), []SourceKey{{StopKey: 1, Departure: departure}}, 3, VehicleType(99), false)
+	if err == nil {
+		t.Fatal("expected an error for an invalid vehicle type")
+	}
+
+	_, err = b.DistanceMs(&b.Data.Vertices[1], &b.Data.Vertices[3], VehicleType(99))
+	if err == nil {
+		t.Fatal("expected an error for the distance with an invalid vehicle type")
+	}
+}
+
+func TestMergeDataError(t *testing.T) {
+	a := &RoutingData{Vertices: make([]Vertex, 2), StreetGraph: make([][]Arc, 2)}
+	broken := &RoutingData{Vertices: make([]Vertex, 2), StreetGraph: make([][]Arc, 1)}
+
+	_, err := MergeData(a, broken)
+	if err == nil {
+		t.Fatal("expected an error merging routing data with inconsistent slice lengths")
+	}
+}
@@ -0,0 +1,315 @@
+package bifrost
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OutdatedCachePolicy decides what LoadData does, if the inputs or parameters changed since the cache was built.
+type OutdatedCachePolicy uint8
+
+const (
+	OutdatedCacheRebuild OutdatedCachePolicy = iota // rebuild the cache from the inputs
+	OutdatedCacheError                              // return an error wrapping ErrOutdatedCache
+)
+
+// CacheFingerprint describes the inputs and parameters a binary bifrost cache was built from.
+type CacheFingerprint struct {
+	Inputs     []InputFingerprint `json:"inputs"`     // osm files, followed by the gtfs files
+	Parameters string             `json:"parameters"` // json of the parameters, that change the routing data
+}
+
+// InputFingerprint describes an input file or directory of a bifrost cache. Directories are described by the sum of
+// the sizes and the latest modification time of their files.
+type InputFingerprint struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // unix ns
+	Hash    string `json:"hash"`    // hex sha256 of the contents
+}
+
+// buildParameters are the parameters used while building the routing data. Other parameters only change routing, so
+// changing them does not invalidate the cache.
+type buildParameters struct {
+	WalkingSpeed              float64
+	CycleSpeed                float64
+	CarMaxSpeed               float64
+	CarMinAvgSpeed            float64
+	MaxWalkingMs              uint32
+	MaxCyclingMs              uint32
+	MaxStopsConnectionSeconds uint32
+	GtfsFeedIds               []string
+	StationMerge              *StationMergeOptions
+}
+
+func (b *Bifrost) buildParameters(load *LoadOptions) (string, error) {
+	parameters, err := json.Marshal(&buildParameters{
+		WalkingSpeed:              b.WalkingSpeed,
+		CycleSpeed:                b.CycleSpeed,
+		CarMaxSpeed:               b.CarMaxSpeed,
+		CarMinAvgSpeed:            b.CarMinAvgSpeed,
+		MaxWalkingMs:              b.MaxWalkingMs,
+		MaxCyclingMs:              b.MaxCyclingMs,
+		MaxStopsConnectionSeconds: b.MaxStopsConnectionSeconds,
+		GtfsFeedIds:               load.GtfsFeedIds,
+		StationMerge:              load.StationMerge,
+	})
+
+	return string(parameters), err
+}
+
+func cacheInputs(load *LoadOptions) []string {
+	return append(append([]string{}, load.OsmPaths...), load.GtfsPaths...)
+}
+
+// cacheFingerprint fingerprints the inputs and parameters of a cache, that is built from the load options.
+func (b *Bifrost) cacheFingerprint(load *LoadOptions) (*CacheFingerprint, error) {
+	parameters, err := b.buildParameters(load)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := &CacheFingerprint{
+		Parameters: parameters,
+	}
+
+	for _, path := range cacheInputs(load) {
+		input, err := fingerprintInput(path, true)
+		if err != nil {
+			return nil, fmt.Errorf("error fingerprinting %s: %w", path, err)
+		}
+
+		fingerprint.Inputs = append(fingerprint.Inputs, *input)
+	}
+
+	return fingerprint, nil
+}
+
+// fingerprintInput describes the file or directory at path. The contents are only hashed, if withHash is set.
+func fingerprintInput(path string, withHash bool) (*InputFingerprint, error) {
+	input := &InputFingerprint{
+		Path: path,
+	}
+
+	var sum hash.Hash
+	if withHash {
+		sum = sha256.New()
+	}
+
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		input.Size += info.Size()
+		if modTime := info.ModTime().UnixNano(); modTime > input.ModTime {
+			input.ModTime = modTime
+		}
+
+		if sum == nil {
+			return nil
+		}
+
+		name, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+
+		sum.Write([]byte(name))
+		sum.Write([]byte{0})
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(sum, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if sum != nil {
+		input.Hash = hex.EncodeToString(sum.Sum(nil))
+	}
+
+	return input, nil
+}
+
+// outdatedReason returns why the cache built with this fingerprint is outdated for the load options, or an empty
+// string if it is up to date. Inputs are only hashed, if their size or modification time changed. Missing inputs are
+// skipped with a warning, so deployments shipping only the cache keep working.
+func (f *CacheFingerprint) outdatedReason(b *Bifrost, load *LoadOptions) (string, error) {
+	parameters, err := b.buildParameters(load)
+	if err != nil {
+		return "", err
+	}
+
+	if parameters != f.Parameters {
+		return fmt.Sprintf("parameters changed from %s to %s", f.Parameters, parameters), nil
+	}
+
+	paths := cacheInputs(load)
+	if len(paths) != len(f.Inputs) {
+		return "the inputs changed", nil
+	}
+
+	for i, path := range paths {
+		cached := f.Inputs[i]
+
+		if path != cached.Path {
+			return fmt.Sprintf("input %s was replaced by %s", cached.Path, path), nil
+		}
+
+		input, err := fingerprintInput(path, false)
+		if errors.Is(err, fs.ErrNotExist) {
+			warnMissingInput(path)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error fingerprinting %s: %w", path, err)
+		}
+
+		if input.Size == cached.Size && input.ModTime == cached.ModTime {
+			continue
+		}
+
+		input, err = fingerprintInput(path, true)
+		if err != nil {
+			return "", fmt.Errorf("error fingerprinting %s: %w", path, err)
+		}
+
+		if input.Hash != cached.Hash {
+			return fmt.Sprintf("input %s changed", path), nil
+		}
+	}
+
+	return "", nil
+}
+
+// readCacheFingerprint reads the fingerprint of a binary bifrost cache without reading the routing data. The
+// fingerprint is nil, if the cache has none. Returns false, if the cache was written by another version or on another
+// platform, so it cannot be read.
+func readCacheFingerprint(fileName string) (*CacheFingerprint, bool, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	// the size of the header depends on the version, so the version is checked first
+	prefix := struct {
+		Magic   [8]byte
+		Version uint32
+		Layout  uint32
+	}{}
+
+	err = binary.Read(file, binary.LittleEndian, &prefix)
+	if err != nil {
+		return nil, false, &CacheError{Path: fileName, Err: fmt.Errorf("invalid header: %w", err)}
+	}
+
+	if prefix.Version != cacheVersion || prefix.Layout != cacheLayout() {
+		return nil, false, nil
+	}
+
+	header := cacheHeader{}
+	err = binary.Read(io.NewSectionReader(file, 0, int64(binary.Size(header))), binary.LittleEndian, &header)
+	if err != nil {
+		return nil, false, &CacheError{Path: fileName, Err: fmt.Errorf("invalid header: %w", err)}
+	}
+
+	section := header.Sections[cacheSectionFingerprint]
+	if section.Length == 0 {
+		return nil, true, nil
+	}
+
+	encoded := make([]byte, section.Length)
+	_, err = file.ReadAt(encoded, int64(section.Offset))
+	if err != nil {
+		return nil, false, &CacheError{Path: fileName, Err: fmt.Errorf("invalid fingerprint: %w", err)}
+	}
+
+	fingerprint := &CacheFingerprint{}
+	err = json.Unmarshal(encoded, fingerprint)
+	if err != nil {
+		return nil, false, &CacheError{Path: fileName, Err: fmt.Errorf("invalid fingerprint: %w", err)}
+	}
+
+	return fingerprint, true, nil
+}
+
+// newerInputReason returns why a cache without fingerprint, like a json or converted cache, is outdated, or an empty
+// string if it can be used. Such a cache does not know its inputs and parameters, so it is only outdated, if an input
+// was modified after the cache was written. Missing inputs are skipped with a warning.
+func newerInputReason(load *LoadOptions) (string, error) {
+	info, err := os.Stat(load.BifrostPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range cacheInputs(load) {
+		input, err := fingerprintInput(path, false)
+		if errors.Is(err, fs.ErrNotExist) {
+			warnMissingInput(path)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error fingerprinting %s: %w", path, err)
+		}
+
+		if input.ModTime > info.ModTime().UnixNano() {
+			return fmt.Sprintf("input %s was modified after the cache was written", path), nil
+		}
+	}
+
+	return "", nil
+}
+
+func warnMissingInput(path string) {
+	fmt.Println("warning: input", path, "is missing, so the bifrost cache is used without checking it")
+}
+
+// checkCache returns why the cache at the bifrost path is outdated, or an empty string if it can be used. Json caches
+// and caches without fingerprint are checked by the modification time of their inputs, see newerInputReason.
+func (b *Bifrost) checkCache(load *LoadOptions) (string, error) {
+	binaryCache, err := isBifrostCache(load.BifrostPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !binaryCache {
+		return newerInputReason(load)
+	}
+
+	fingerprint, compatible, err := readCacheFingerprint(load.BifrostPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !compatible {
+		return "it was written by another version of bifrost or on another platform", nil
+	}
+
+	if fingerprint == nil {
+		return newerInputReason(load)
+	}
+
+	return fingerprint.outdatedReason(b, load)
+}
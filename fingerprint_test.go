@@ -0,0 +1,144 @@
+package bifrost
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	feed := filepath.Join(dir, "gtfs")
+
+	err := os.Mkdir(feed, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range testFeed {
+		err := os.WriteFile(filepath.Join(feed, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load := &LoadOptions{
+		GtfsPaths:   []string{feed},
+		BifrostPath: filepath.Join(dir, "data.bifrost"),
+	}
+
+	b := *DefaultBifrost
+	b.Data = nil
+	err = b.LoadData(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReason := func(outdated bool) {
+		t.Helper()
+
+		reason, err := b.checkCache(load)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (reason != "") != outdated {
+			t.Fatalf("expected the cache to be outdated: %v, got reason %q", outdated, reason)
+		}
+	}
+
+	expectReason(false)
+
+	// only touching the feed keeps the cache
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(feed, "stops.txt"), future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReason(false)
+
+	b.WalkingSpeed /= 2
+	expectReason(true)
+	b.WalkingSpeed *= 2
+
+	err = os.WriteFile(filepath.Join(feed, "stops.txt"), []byte(testFeed["stops.txt"]+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReason(true)
+
+	load.OutdatedCache = OutdatedCacheError
+	err = b.LoadData(load)
+	if !errors.Is(err, ErrOutdatedCache) {
+		t.Fatalf("expected an outdated cache error, got %v", err)
+	}
+
+	load.OutdatedCache = OutdatedCacheRebuild
+	b.Data = nil
+	err = b.LoadData(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReason(false)
+	// a deployment may ship the cache without its inputs
+	err = os.RemoveAll(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReason(false)
+
+	b.Data = nil
+	err = b.LoadData(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheWithoutFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "stops.txt")
+
+	err := os.WriteFile(input, []byte(testFeed["stops.txt"]), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	load := &LoadOptions{
+		GtfsPaths:   []string{input},
+		BifrostPath: filepath.Join(dir, "data.json.bifrost"),
+	}
+
+	b := &Bifrost{Data: newRealtimeTestData()}
+	err = b.WriteBifrostData(load.BifrostPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	err = os.Chtimes(input, past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, err := b.checkCache(load)
+	if err != nil || reason != "" {
+		t.Fatalf("expected the json cache to be used, got %q, %v", reason, err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(input, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reason, err = b.checkCache(load)
+	if err != nil || reason == "" {
+		t.Fatalf("expected the json cache to be outdated after its input changed, got %q, %v", reason, err)
+	}
+}
@@ -3,21 +3,22 @@ package bifrost
 import (
 	"fmt"
 	"github.com/Vector-Hector/fptf"
-	util "github.com/Vector-Hector/goutil"
 	"strconv"
 	"time"
 )
 
-func (b *Bifrost) ReconstructJourney(destKey uint64, lastRound int, rounds *Rounds) *fptf.Journey {
+// ReconstructJourney follows the labels of the rounds from the destination back to an origin and returns the journey
+// found by the search. Returns a JourneyError, if the labels do not lead to an origin.
+func (b *Bifrost) ReconstructJourney(destKey uint64, lastRound int, rounds *Rounds) (*fptf.Journey, error) {
 	// reconstruct path
 	trips := make([]*fptf.Trip, 0)
 	position := destKey
 
 	for i := lastRound; i > 0; i-- {
-		arr, ok := rounds.Rounds[i][position]
+		arr, ok := rounds.Rounds[i].Get(position)
 
 		if !ok {
-			panic("position does not exist in round")
+			return nil, &JourneyError{Vertex: position, Reason: fmt.Sprint("no arrival in round ", i)}
 		}
 
 		if arr.Trip == TripIdNoChange {
@@ -25,17 +26,61 @@ func (b *Bifrost) ReconstructJourney(destKey uint64, lastRound int, rounds *Roun
 		}
 
 		if arr.Trip == TripIdWalk || arr.Trip == TripIdCycle || arr.Trip == TripIdCar {
-			trip, newPos := GetTripFromTransfer(b.Data, rounds.Rounds[i], position, arr.Trip)
+			trip, newPos, err := GetTripFromTransfer(b.Data, rounds.Rounds[i], position, arr.Trip)
+			if err != nil {
+				return nil, err
+			}
+
 			position = newPos
 			trips = append(trips, trip)
+			if sa, _ := rounds.Rounds[i].Get(position); sa.Trip == TripIdShared {
+				i++ // the walk started after returning a shared vehicle in the same round
+			}
+			continue
+		}
+
+		if arr.Trip == TripIdShared {
+			trip, pickUp, err := b.getSharedTrip(rounds, i, position)
+			if err != nil {
+				return nil, err
+			}
+
+			position = pickUp
+			trips = append(trips, trip)
+			i++ // the vehicle was rented at a vertex labelled in the same round
+			continue
+		}
+
+		if arr.Trip == TripIdEgress {
+			trip, err := b.getEgressTrip(rounds, arr)
+			if err != nil {
+				return nil, err
+			}
+
+			trips = append(trips, trip)
+			position = arr.EnterKey
+			i++ // the drive starts at a vertex labelled in the same round
 			continue
 		}
 
-		trip, newPos := GetTripFromTrip(b.Data, rounds.Rounds[i-1], arr)
+		trip, newPos, err := b.GetTripFromTrip(rounds.Rounds[i-1], arr)
+		if err != nil {
+			return nil, err
+		}
+
 		position = newPos
 		trips = append(trips, trip)
 	}
 
+	trip, err := b.getAccessTrip(rounds, position)
+	if err != nil {
+		return nil, err
+	}
+
+	if trip != nil {
+		trips = append(trips, trip)
+	}
+
 	// reverse trips
 	for i := len(trips)/2 - 1; i >= 0; i-- {
 		opp := len(trips) - 1 - i
@@ -44,10 +89,10 @@ func (b *Bifrost) ReconstructJourney(destKey uint64, lastRound int, rounds *Roun
 
 	return &fptf.Journey{
 		Trips: trips,
-	}
+	}, nil
 }
 
-func GetTripFromTransfer(r *RoutingData, round map[uint64]StopArrival, destination uint64, tripType uint32) (*fptf.Trip, uint64) {
+func GetTripFromTransfer(r *RoutingData, round *Round, destination uint64, tripType uint32) (*fptf.Trip, uint64, error) {
 	mode := fptf.ModeWalking
 	if tripType == TripIdCycle {
 		mode = fptf.ModeBicycle
@@ -56,7 +101,7 @@ func GetTripFromTransfer(r *RoutingData, round map[uint64]StopArrival, destinati
 	}
 
 	position := destination
-	arrival := round[position]
+	arrival, _ := round.Get(position)
 	path := make([]uint64, 1)
 	path[0] = position
 
@@ -66,10 +111,10 @@ func GetTripFromTransfer(r *RoutingData, round map[uint64]StopArrival, destinati
 		}
 
 		prevPos := arrival.EnterKey
-		prevArr := round[prevPos]
+		prevArr, _ := round.Get(prevPos)
 
 		if prevArr.Arrival > arrival.Arrival {
-			panic("transfer arrival is before enter")
+			return nil, 0, &JourneyError{Vertex: position, Reason: "transfer arrival is before enter"}
 		}
 
 		position = prevPos
@@ -77,18 +122,20 @@ func GetTripFromTransfer(r *RoutingData, round map[uint64]StopArrival, destinati
 		path = append(path, position)
 	}
 
+	timezone := r.pathTimezone(path)
+
 	stopovers := make([]*fptf.Stopover, 0, len(path))
 	for i := len(path) - 1; i >= 0; i-- {
 		stop := path[i]
-		sa := round[stop]
+		sa, _ := round.Get(stop)
 		stopover := &fptf.Stopover{
 			StopStation: r.GetFptfStop(stop),
 		}
 		if i != len(path)-1 {
-			stopover.Arrival = r.GetTime(sa.Arrival)
+			stopover.Arrival = r.getTimeOnPath(sa.Arrival, stop, timezone)
 		}
 		if i != 0 {
-			stopover.Departure = r.GetTime(sa.Arrival)
+			stopover.Departure = r.getTimeOnPath(sa.Arrival, stop, timezone)
 		}
 		stopovers = append(stopovers, stopover)
 	}
@@ -107,7 +154,7 @@ func GetTripFromTransfer(r *RoutingData, round map[uint64]StopArrival, destinati
 		Mode:        mode,
 	}
 
-	return trip, position
+	return trip, position, nil
 }
 
 func (r *RoutingData) GetFptfStop(stop uint64) *fptf.StopStation {
@@ -131,67 +178,83 @@ func (r *RoutingData) GetFptfStop(stop uint64) *fptf.StopStation {
 	}
 }
 
+// GetTime returns the unix ms as time in the timezone of the first gtfs feed, or the local timezone without feeds. It
+// is meant for street legs, that touch no stop. Times at stops and of trips use their own timezone, see GetTimeAt.
 func (r *RoutingData) GetTime(ms uint64) fptf.TimeNullable {
+	t := time.Unix(int64(ms/1000), int64(ms%1000)*1000000)
+	if len(r.Timezones) > 0 {
+		t = t.In(loadLocation(r.Timezones[0].Name))
+	}
+
 	return fptf.TimeNullable{
-		Time: time.Unix(int64(ms/1000), int64(ms%1000)*1000000),
+		Time: t,
 	}
 }
 
-func GetTripFromTrip(r *RoutingData, round map[uint64]StopArrival, arrival StopArrival) (*fptf.Trip, uint64) {
-	// todo add support for these trip leg fields:
-	// todo - trip.Schedule
-	// todo - trip.Mode (split between bus, train and watercraft)
-	// todo - trip.Operator
+func (b *Bifrost) GetTripFromTrip(round *Round, arrival StopArrival) (*fptf.Trip, uint64, error) {
+	r := b.Data
 
-	trip := r.Trips[arrival.Trip]
-	routeKey := r.TripToRoute[arrival.Trip]
+	if arrival.InSeat {
+		return b.getTripFromInSeatTrip(round, arrival)
+	}
+
+	routeKey := r.tripRoute(arrival.Trip)
 	route := r.Routes[routeKey]
 
-	enterKey := 0
+	enterKey := b.findEnterKey(round, arrival.Trip, int(arrival.EnterKey), arrival.Departure)
 
-	for i := int(arrival.EnterKey) - 1; i >= 0; i-- {
-		stop := route.Stops[i]
-		_, ok := round[stop]
-		if !ok {
-			continue
+	if enterKey == -1 {
+		return nil, 0, &JourneyError{
+			Vertex: route.Stops[arrival.EnterKey],
+			Reason: fmt.Sprint("no enter key found for trip ", arrival.Trip, " at route ", routeKey),
 		}
-
-		enterKey = i
-		break
 	}
 
-	if enterKey == 0 {
-		_, ok := round[route.Stops[0]]
-		if !ok {
-			util.PrintJSON(arrival)
-			panic(fmt.Sprint("no enter key found for trip ", arrival.Trip, " at route ", routeKey))
-		}
-	}
+	return r.getTransitTrip(arrival.Trip, enterKey, int(arrival.EnterKey), arrival.Departure), route.Stops[enterKey], nil
+}
+
+// getTransitTrip converts the part of a trip between the stop sequence keys enterKey and exitKey to a fptf.Trip.
+func (r *RoutingData) getTransitTrip(tripKey uint32, enterKey int, exitKey int, day uint64) *fptf.Trip {
+	// todo add support for these trip leg fields:
+	// todo - trip.Schedule
+	// todo - trip.Operator
+
+	trip := r.tripAt(tripKey, uint32(day))
+	routeKey := r.tripRoute(tripKey)
+	route := r.Routes[routeKey]
 
 	gtfsRouteKey := r.GtfsRouteIndex[routeKey]
 	gtfsRoute := r.RouteInformation[gtfsRouteKey]
-	gtfsTrip := r.TripInformation[arrival.Trip]
+	gtfsTrip := r.tripInformation(tripKey)
+
+	rt := r.realtimeTrip(tripKey, uint32(day))
 
 	routeName := gtfsRoute.ShortName
+	mode, subMode := routeTypeMode(gtfsRoute.Type)
 
 	originStop := r.GetFptfStop(route.Stops[enterKey])
-	destStop := r.GetFptfStop(route.Stops[arrival.EnterKey])
+	destStop := r.GetFptfStop(route.Stops[exitKey])
+
+	dayStart := r.dayStart(trip, day)
 
-	dep := r.GetTime(trip.StopTimes[enterKey].DepartureAtDay(arrival.Departure))
-	arr := r.GetTime(trip.StopTimes[arrival.EnterKey].ArrivalAtDay(arrival.Departure))
+	dep := r.getTimeOfTrip(trip.StopTimes[enterKey].DepartureAt(dayStart), trip, route.Stops[enterKey])
+	arr := r.getTimeOfTrip(trip.StopTimes[exitKey].ArrivalAt(dayStart), trip, route.Stops[exitKey])
 
-	stopovers := make([]*fptf.Stopover, 0, int(arrival.EnterKey)-enterKey+1)
-	for i := enterKey; i <= int(arrival.EnterKey); i++ {
+	stopovers := make([]*fptf.Stopover, 0, exitKey-enterKey+1)
+	for i := enterKey; i <= exitKey; i++ {
 		stop := route.Stops[i]
 		stopover := &fptf.Stopover{
 			StopStation: r.GetFptfStop(stop),
-			Arrival:     r.GetTime(trip.StopTimes[i].ArrivalAtDay(arrival.Departure)),
-			Departure:   r.GetTime(trip.StopTimes[i].DepartureAtDay(arrival.Departure)),
+			Arrival:     r.getTimeOfTrip(trip.StopTimes[i].ArrivalAt(dayStart), trip, stop),
+			Departure:   r.getTimeOfTrip(trip.StopTimes[i].DepartureAt(dayStart), trip, stop),
+		}
+		if rt != nil {
+			r.setRealtimeDelays(stopover, rt, tripKey, i)
 		}
 		stopovers = append(stopovers, stopover)
 	}
 
-	result := &fptf.Trip{
+	leg := &fptf.Trip{
 		Origin:      originStop,
 		Destination: destStop,
 		Departure:   dep,
@@ -199,14 +262,221 @@ func GetTripFromTrip(r *RoutingData, round map[uint64]StopArrival, arrival StopA
 		Stopovers:   stopovers,
 		Line: &fptf.Line{
 			Id:   gtfsTrip.TripId,
-			Mode: fptf.ModeTrain,
+			Mode: mode,
 			Name: routeName,
 		},
-		Mode:      fptf.ModeTrain,
+		Mode:      mode,
+		SubMode:   subMode,
 		Direction: gtfsTrip.Headsign,
 	}
 
-	return result, route.Stops[enterKey]
+	meta := &RealtimeMeta{}
+
+	if rt != nil {
+		leg.DepartureDelay = stopovers[0].DepartureDelay
+		leg.ArrivalDelay = stopovers[len(stopovers)-1].ArrivalDelay
+		meta.Cancelled = rt.Cancelled
+	}
+
+	meta.Alerts = r.legAlerts(tripKey, uint32(day), enterKey, exitKey, trip.StopTimes[enterKey].DepartureAt(dayStart), trip.StopTimes[exitKey].ArrivalAt(dayStart))
+
+	if meta.Cancelled || len(meta.Alerts) > 0 {
+		leg.Meta = meta
+	}
+
+	return leg
+}
+
+// ReconstructJourneyReverse reconstructs a journey found by RouteTransitArriveBy. It starts at the origin and follows
+// the rounds towards the destination, so the legs are already in order.
+func (b *Bifrost) ReconstructJourneyReverse(originKey uint64, lastRound int, rounds *Rounds) (*fptf.Journey, error) {
+	trips := make([]*fptf.Trip, 0)
+	position := originKey
+
+	for i := lastRound; i > 0; i-- {
+		arr, ok := rounds.Rounds[i].Get(position)
+
+		if !ok {
+			return nil, &JourneyError{Vertex: position, Reason: fmt.Sprint("no departure in round ", i)}
+		}
+
+		if arr.Trip == TripIdNoChange {
+			continue
+		}
+
+		if arr.Trip == TripIdWalk || arr.Trip == TripIdCycle || arr.Trip == TripIdCar {
+			trip, newPos, err := GetTripFromTransferReverse(b.Data, rounds.Rounds[i], position, arr.Trip)
+			if err != nil {
+				return nil, err
+			}
+
+			position = newPos
+			trips = append(trips, trip)
+			continue
+		}
+
+		trip, newPos, err := b.GetTripFromTripReverse(rounds.Rounds[i-1], arr)
+		if err != nil {
+			return nil, err
+		}
+
+		position = newPos
+		trips = append(trips, trip)
+	}
+
+	return &fptf.Journey{
+		Trips: trips,
+	}, nil
+}
+
+// GetTripFromTransferReverse follows a transfer of a backwards search from origin towards the destination.
+func GetTripFromTransferReverse(r *RoutingData, round *Round, origin uint64, tripType uint32) (*fptf.Trip, uint64, error) {
+	mode := fptf.ModeWalking
+	if tripType == TripIdCycle {
+		mode = fptf.ModeBicycle
+	} else if tripType == TripIdCar {
+		mode = fptf.ModeCar
+	}
+
+	position := origin
+	departure, _ := round.Get(position)
+	path := []uint64{position}
+	labels := []StopArrival{departure}
+
+	for departure.Trip == tripType {
+		nextPos := departure.EnterKey
+		nextDep, _ := round.Get(nextPos)
+
+		if nextDep.Arrival < departure.Arrival {
+			return nil, 0, &JourneyError{Vertex: position, Reason: "transfer departure is after exit"}
+		}
+
+		position = nextPos
+		departure = nextDep
+		path = append(path, position)
+		labels = append(labels, departure)
+	}
+
+	timezone := r.pathTimezone(path)
+
+	stopovers := make([]*fptf.Stopover, 0, len(path))
+	for i, stop := range path {
+		stopover := &fptf.Stopover{
+			StopStation: r.GetFptfStop(stop),
+		}
+		if i != 0 {
+			stopover.Arrival = r.getTimeOnPath(labels[i-1].Departure, stop, timezone)
+		}
+		if i != len(path)-1 {
+			stopover.Departure = r.getTimeOnPath(labels[i].Arrival, stop, timezone)
+		}
+		stopovers = append(stopovers, stopover)
+	}
+
+	trip := &fptf.Trip{
+		Origin:      stopovers[0].StopStation,
+		Destination: stopovers[len(stopovers)-1].StopStation,
+		Departure:   stopovers[0].Departure,
+		Arrival:     stopovers[len(stopovers)-1].Arrival,
+		Stopovers:   stopovers,
+		Mode:        mode,
+	}
+
+	return trip, position, nil
+}
+
+// GetTripFromTripReverse finds the stop at which a trip of a backwards search is left and converts the ride to a
+// fptf.Trip. The round is the one the trip was found from.
+func (b *Bifrost) GetTripFromTripReverse(round *Round, departure StopArrival) (*fptf.Trip, uint64, error) {
+	r := b.Data
+
+	if departure.InSeat {
+		return b.getTripFromInSeatTripReverse(round, departure)
+	}
+
+	routeKey := r.tripRoute(departure.Trip)
+	route := r.Routes[routeKey]
+
+	exitKey := b.findExitKey(round, departure.Trip, int(departure.EnterKey), departure.Departure)
+
+	if exitKey == -1 {
+		return nil, 0, &JourneyError{
+			Vertex: route.Stops[departure.EnterKey],
+			Reason: fmt.Sprint("no exit key found for trip ", departure.Trip, " at route ", routeKey),
+		}
+	}
+
+	return r.getTransitTrip(departure.Trip, int(departure.EnterKey), exitKey, departure.Departure), route.Stops[exitKey], nil
+}
+
+// findExitKey returns the first stop after enterKey, at which the trip can be left to reach a stop of the round in
+// time. Returns -1, if there is none.
+func (b *Bifrost) findExitKey(round *Round, tripKey uint32, enterKey int, day uint64) int {
+	r := b.Data
+
+	trip := r.tripAt(tripKey, uint32(day))
+	route := r.Routes[r.tripRoute(tripKey)]
+
+	for i := enterKey + 1; i < len(route.Stops); i++ {
+		sa, ok := round.Get(route.Stops[i])
+		if !ok {
+			continue
+		}
+
+		if trip.StopTimes[i].ArrivalAt(r.dayStart(trip, day)) > sa.Arrival || !b.canLeave(route, trip, tripKey, uint32(day), uint32(i)) {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// findEnterKey returns the last stop before exitKey, at which the trip can be entered after reaching the stop in the
+// round.
+// Returns -1, if there is none.
+func (b *Bifrost) findEnterKey(round *Round, tripKey uint32, exitKey int, day uint64) int {
+	r := b.Data
+
+	trip := r.tripAt(tripKey, uint32(day))
+	route := r.Routes[r.tripRoute(tripKey)]
+
+	for i := exitKey - 1; i >= 0; i-- {
+		sa, ok := round.Get(route.Stops[i])
+		if !ok {
+			continue
+		}
+
+		if sa.Arrival > trip.StopTimes[i].DepartureAt(r.dayStart(trip, day)) || !b.canEnter(route, trip, tripKey, uint32(day), uint32(i)) {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+// shiftJourney moves all times of a journey by the given duration.
+func shiftJourney(journey *fptf.Journey, shift time.Duration) {
+	for _, trip := range journey.Trips {
+		trip.Departure = shiftTime(trip.Departure, shift)
+		trip.Arrival = shiftTime(trip.Arrival, shift)
+
+		for _, stopover := range trip.Stopovers {
+			stopover.Departure = shiftTime(stopover.Departure, shift)
+			stopover.Arrival = shiftTime(stopover.Arrival, shift)
+		}
+	}
+}
+
+func shiftTime(t fptf.TimeNullable, shift time.Duration) fptf.TimeNullable {
+	if t.IsZero() {
+		return t
+	}
+
+	return fptf.TimeNullable{Time: t.Add(shift)}
 }
 
 func (b *Bifrost) addSourceAndDestination(journey *fptf.Journey, sources []SourceLocation, dest *fptf.Location) {
@@ -226,10 +496,10 @@ func (b *Bifrost) addSourceAndDestination(journey *fptf.Journey, sources []Sourc
 	minSourceKey := -1
 
 	for i, source := range sources {
-		distance := b.DistanceMs(&GeoPoint{
+		distance := distanceMs(&GeoPoint{
 			Latitude:  source.Location.Latitude,
 			Longitude: source.Location.Longitude,
-		}, originPoint, VehicleTypeWalking)
+		}, originPoint, b.WalkingSpeed)
 
 		if minSourceKey == -1 || distance < minSourceDistance {
 			minSourceDistance = distance
@@ -257,27 +527,27 @@ func (b *Bifrost) addJourneyOrigin(journey *fptf.Journey, origin *fptf.Location)
 		return
 	}
 
-	vehicleType := VehicleTypeWalking
+	speed := b.WalkingSpeed
 	willAddTrip := true
 
 	if firstTrip.Mode == fptf.ModeWalking {
-		vehicleType = VehicleTypeWalking
+		speed = b.WalkingSpeed
 		willAddTrip = false
 	} else if firstTrip.Mode == fptf.ModeBicycle {
-		vehicleType = VehicleTypeBicycle
+		speed = b.CycleSpeed
 		willAddTrip = false
 	} else if firstTrip.Mode == fptf.ModeCar {
-		vehicleType = VehicleTypeCar
+		speed = b.CarMinAvgSpeed
 		willAddTrip = false
 	}
 
-	dist := uint64(b.DistanceMs(&GeoPoint{
+	dist := uint64(distanceMs(&GeoPoint{
 		Latitude:  origin.Latitude,
 		Longitude: origin.Longitude,
 	}, &GeoPoint{
 		Latitude:  journeyOriginLoc.Latitude,
 		Longitude: journeyOriginLoc.Longitude,
-	}, vehicleType))
+	}, speed))
 
 	pad := b.TransferPaddingMs
 	if !willAddTrip {
@@ -351,20 +621,20 @@ func (b *Bifrost) addJourneyDestination(journey *fptf.Journey, dest *fptf.Locati
 		return
 	}
 
-	vehicleType := VehicleTypeWalking
+	speed := b.WalkingSpeed
 	if lastTrip.Mode == fptf.ModeBicycle {
-		vehicleType = VehicleTypeBicycle
+		speed = b.CycleSpeed
 	} else if lastTrip.Mode == fptf.ModeCar {
-		vehicleType = VehicleTypeCar
+		speed = b.CarMinAvgSpeed
 	}
 
-	dist := uint64(b.DistanceMs(&GeoPoint{
+	dist := uint64(distanceMs(&GeoPoint{
 		Latitude:  dest.Latitude,
 		Longitude: dest.Longitude,
 	}, &GeoPoint{
 		Latitude:  journeyDestLoc.Latitude,
 		Longitude: journeyDestLoc.Longitude,
-	}, vehicleType))
+	}, speed))
 
 	journeyArr := journey.GetArrival()
 	journeyArrDelay := journey.GetArrivalDelay()
@@ -0,0 +1,326 @@
+package bifrost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SharingStation is a docking station or a free floating vehicle of a shared mobility system read from GBFS.
+type SharingStation struct {
+	Id                string
+	Name              string
+	System            string // gbfs system_id, vehicles may only be returned at stations of the same system
+	Operator          string // name of the system
+	FormFactor        string // gbfs form_factor of the vehicles, for example bicycle or scooter
+	VehiclesAvailable uint32
+	DocksAvailable    uint32
+	FreeFloating      bool // a single vehicle, that may be returned anywhere
+}
+
+// canPickUp returns true, if a vehicle can be rented at the station.
+func (s *SharingStation) canPickUp() bool {
+	return s.VehiclesAvailable > 0
+}
+
+// canReturn returns true, if a vehicle picked up at pickUp can be returned at the station.
+func (s *SharingStation) canReturn(pickUp *SharingStation) bool {
+	return !s.FreeFloating && s.System == pickUp.System && s.DocksAvailable > 0
+}
+
+// gbfsBool is a boolean, that is encoded as 0 and 1 in GBFS 1.x and as true and false in later versions.
+type gbfsBool bool
+
+func (g *gbfsBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*g = true
+	case "false", "0", "null":
+		*g = false
+	default:
+		return fmt.Errorf("invalid gbfs boolean %s", data)
+	}
+
+	return nil
+}
+
+// isTrue returns the value of an optional boolean, missing values default to true.
+func (g *gbfsBool) isTrue() bool {
+	return g == nil || bool(*g)
+}
+
+type gbfsSystemInformation struct {
+	SystemId string `json:"system_id"`
+	Name     string `json:"name"`
+}
+
+type gbfsStationInformation struct {
+	Stations []struct {
+		StationId string  `json:"station_id"`
+		Name      string  `json:"name"`
+		Lat       float64 `json:"lat"`
+		Lon       float64 `json:"lon"`
+	} `json:"stations"`
+}
+
+type gbfsStationStatus struct {
+	Stations []struct {
+		StationId         string    `json:"station_id"`
+		NumBikesAvailable uint32    `json:"num_bikes_available"`
+		NumDocksAvailable uint32    `json:"num_docks_available"`
+		IsInstalled       *gbfsBool `json:"is_installed"`
+		IsRenting         *gbfsBool `json:"is_renting"`
+		IsReturning       *gbfsBool `json:"is_returning"`
+	} `json:"stations"`
+}
+
+type gbfsFreeBikeStatus struct {
+	Bikes []struct {
+		BikeId        string    `json:"bike_id"`
+		Lat           float64   `json:"lat"`
+		Lon           float64   `json:"lon"`
+		IsReserved    *gbfsBool `json:"is_reserved"`
+		IsDisabled    *gbfsBool `json:"is_disabled"`
+		VehicleTypeId string    `json:"vehicle_type_id"`
+	} `json:"bikes"`
+}
+
+type gbfsVehicleTypes struct {
+	VehicleTypes []struct {
+		VehicleTypeId string `json:"vehicle_type_id"`
+		FormFactor    string `json:"form_factor"`
+	} `json:"vehicle_types"`
+}
+
+// readGbfsFile decodes the data object of a GBFS file into v. The feed is either a local directory or the base url
+// of a http server. Missing files are skipped, so v keeps its zero value.
+func readGbfsFile(feed string, name string, v interface{}) error {
+	var body io.ReadCloser
+
+	if strings.HasPrefix(feed, "http://") || strings.HasPrefix(feed, "https://") {
+		resp, err := http.Get(strings.TrimSuffix(feed, "/") + "/" + name)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("error fetching %s: %s", name, resp.Status)
+		}
+
+		body = resp.Body
+	} else {
+		f, err := os.Open(filepath.Join(feed, name))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		body = f
+	}
+	defer body.Close()
+
+	file := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+
+	err := json.NewDecoder(body).Decode(&file)
+	if err != nil {
+		return fmt.Errorf("error decoding %s: %w", name, err)
+	}
+
+	err = json.Unmarshal(file.Data, v)
+	if err != nil {
+		return fmt.Errorf("error decoding %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// readGbfs reads the stations and free floating vehicles of a GBFS feed. Stations, that are not installed or not
+// renting and returning, are reported without vehicles or docks. Reserved and disabled vehicles are skipped.
+func readGbfs(feed string) ([]*SharingStation, []*GeoPoint, error) {
+	system := &gbfsSystemInformation{}
+	err := readGbfsFile(feed, "system_information.json", system)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if system.SystemId == "" {
+		system.SystemId = feed
+	}
+
+	vehicleTypes := &gbfsVehicleTypes{}
+	err = readGbfsFile(feed, "vehicle_types.json", vehicleTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	formFactors := make(map[string]string)
+	for _, vehicleType := range vehicleTypes.VehicleTypes {
+		formFactors[vehicleType.VehicleTypeId] = vehicleType.FormFactor
+	}
+
+	stations := make([]*SharingStation, 0)
+	locations := make([]*GeoPoint, 0)
+
+	information := &gbfsStationInformation{}
+	err = readGbfsFile(feed, "station_information.json", information)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := &gbfsStationStatus{}
+	err = readGbfsFile(feed, "station_status.json", status)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stationIndex := make(map[string]*SharingStation)
+
+	for _, info := range information.Stations {
+		station := &SharingStation{
+			Id:         info.StationId,
+			Name:       info.Name,
+			System:     system.SystemId,
+			Operator:   system.Name,
+			FormFactor: "bicycle",
+		}
+
+		stationIndex[info.StationId] = station
+		stations = append(stations, station)
+		locations = append(locations, &GeoPoint{
+			Latitude:  info.Lat,
+			Longitude: info.Lon,
+		})
+	}
+
+	for _, s := range status.Stations {
+		station, ok := stationIndex[s.StationId]
+		if !ok || !s.IsInstalled.isTrue() {
+			continue
+		}
+
+		if s.IsRenting.isTrue() {
+			station.VehiclesAvailable = s.NumBikesAvailable
+		}
+
+		if s.IsReturning.isTrue() {
+			station.DocksAvailable = s.NumDocksAvailable
+		}
+	}
+
+	free := &gbfsFreeBikeStatus{}
+	err = readGbfsFile(feed, "free_bike_status.json", free)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, bike := range free.Bikes {
+		if bike.IsReserved != nil && bool(*bike.IsReserved) || bike.IsDisabled != nil && bool(*bike.IsDisabled) {
+			continue
+		}
+
+		formFactor, ok := formFactors[bike.VehicleTypeId]
+		if !ok {
+			formFactor = "bicycle"
+		}
+
+		stations = append(stations, &SharingStation{
+			Id:                bike.BikeId,
+			System:            system.SystemId,
+			Operator:          system.Name,
+			FormFactor:        formFactor,
+			VehiclesAvailable: 1,
+			FreeFloating:      true,
+		})
+		locations = append(locations, &GeoPoint{
+			Latitude:  bike.Lat,
+			Longitude: bike.Lon,
+		})
+	}
+
+	return stations, locations, nil
+}
+
+// AddGBFS reads a GBFS feed from a local directory or the base url of a http server and adds its stations and free
+// floating vehicles as vertices to the street graph. Each of them is connected to the closest walkable vertices, like
+// ConnectStopsToVertices does for stops. The availability is a snapshot taken while reading the feed. The vertex trees
+// must be built, they are rebuilt afterwards.
+func (b *Bifrost) AddGBFS(feed string) error {
+	if b.Data == nil || b.Data.WalkableVertexTree == nil {
+		return fmt.Errorf("gbfs feed %s needs a street graph to connect to", feed)
+	}
+
+	stations, locations, err := readGbfs(feed)
+	if err != nil {
+		return err
+	}
+
+	if b.Data.SharingStations == nil {
+		b.Data.SharingStations = make(map[uint64]*SharingStation)
+	}
+
+	err = b.Data.EnsureSliceLengths()
+	if err != nil {
+		return err
+	}
+
+	for i, station := range stations {
+		loc := locations[i]
+		stationKey := uint64(len(b.Data.Vertices))
+
+		b.Data.Vertices = append(b.Data.Vertices, Vertex{
+			Latitude:  loc.Latitude,
+			Longitude: loc.Longitude,
+		})
+		b.Data.StreetGraph = append(b.Data.StreetGraph, nil)
+		b.Data.StopToRoutes = append(b.Data.StopToRoutes, nil)
+		b.Data.SharingStations[stationKey] = station
+
+		nearest := b.Data.WalkableVertexTree.KNN(loc, 10)
+
+		for _, point := range nearest {
+			streetVert := point.(*GeoPoint)
+
+			if !b.fastDistWithin(loc, streetVert, b.MaxStopsConnectionSeconds) {
+				break
+			}
+
+			dist := distanceMs(loc, streetVert, b.WalkingSpeed)
+
+			if dist > b.MaxStopsConnectionSeconds {
+				break
+			}
+
+			arc := Arc{
+				Target:        streetVert.VertKey,
+				WalkDistance:  dist,
+				CycleDistance: distanceMs(loc, streetVert, b.CycleSpeed),
+			}
+
+			b.Data.StreetGraph[stationKey] = append(b.Data.StreetGraph[stationKey], arc)
+
+			arc.Target = stationKey
+			b.Data.StreetGraph[streetVert.VertKey] = append(b.Data.StreetGraph[streetVert.VertKey], arc)
+		}
+	}
+
+	fmt.Println("Found", len(stations), "shared mobility stations and vehicles in", feed)
+
+	b.Data.RebuildVertexTree()
+	b.Data.RebuildReverseStreetGraph()
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package bifrost
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadGbfs(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"system_information.json": `{"data": {"system_id": "bikes", "name": "City Bikes"}}`,
+		"station_information.json": `{"data": {"stations": [
+			{"station_id": "a", "name": "Station A", "lat": 48.1, "lon": 11.5},
+			{"station_id": "b", "name": "Station B", "lat": 48.2, "lon": 11.6}
+		]}}`,
+		"station_status.json": `{"data": {"stations": [
+			{"station_id": "a", "num_bikes_available": 3, "num_docks_available": 2, "is_renting": 1, "is_returning": 0},
+			{"station_id": "b", "num_bikes_available": 1, "num_docks_available": 4, "is_installed": false}
+		]}}`,
+		"free_bike_status.json": `{"data": {"bikes": [
+			{"bike_id": "x", "lat": 48.3, "lon": 11.7, "vehicle_type_id": "s"},
+			{"bike_id": "y", "lat": 48.3, "lon": 11.7, "is_disabled": true}
+		]}}`,
+		"vehicle_types.json": `{"data": {"vehicle_types": [{"vehicle_type_id": "s", "form_factor": "scooter"}]}}`,
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stations, locations, err := readGbfs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stations) != 3 || len(locations) != 3 {
+		t.Fatalf("expected two stations and one vehicle, got %d", len(stations))
+	}
+
+	a := stations[0]
+	if a.Name != "Station A" || a.Operator != "City Bikes" || a.VehiclesAvailable != 3 || a.DocksAvailable != 0 {
+		t.Fatalf("expected renting but not returning station, got %+v", a)
+	}
+
+	if stations[1].canPickUp() {
+		t.Fatal("expected no vehicles at uninstalled station")
+	}
+
+	scooter := stations[2]
+	if !scooter.FreeFloating || scooter.FormFactor != "scooter" || scooter.System != "bikes" || locations[2].Latitude != 48.3 {
+		t.Fatalf("expected free floating scooter, got %+v", scooter)
+	}
+}
+
+func TestSharedMobilityTransfer(t *testing.T) {
+	b := &Bifrost{
+		WalkingSpeed:   0.8 * 0.001,
+		CycleSpeed:     4.0 * 0.001,
+		SharedMobility: true,
+		SharingMs:      500,
+		MaxCyclingMs:   60 * 1000,
+		Data: &RoutingData{
+			Vertices: make([]Vertex, 5),
+			StreetGraph: [][]Arc{
+				{{Target: 1, WalkDistance: 1000}},
+				{{Target: 2, WalkDistance: 100000, CycleDistance: 10000}},
+				{{Target: 3, WalkDistance: 100000, CycleDistance: 10000}},
+				{{Target: 4, WalkDistance: 1000}},
+				{},
+			},
+			SharingStations: map[uint64]*SharingStation{
+				1: {Id: "a", Name: "Station A", System: "bikes", Operator: "City Bikes", FormFactor: "bicycle", VehiclesAvailable: 2},
+				3: {Id: "b", Name: "Station B", System: "bikes", Operator: "City Bikes", FormFactor: "bicycle", DocksAvailable: 1},
+			},
+		},
+	}
+
+	rounds := b.NewRounds()
+	departure := time.UnixMilli(int64(DayInMs) * 3)
+
+	journey, err := b.RouteOnlyTimeIndependent(rounds, []SourceKey{{StopKey: 0, Departure: departure}}, 4, VehicleTypeWalking, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journey.Trips) != 3 {
+		t.Fatalf("expected walk, ride and walk, got %d legs", len(journey.Trips))
+	}
+
+	ride := journey.Trips[1]
+	if ride.Operator == nil || ride.Operator.Name != "City Bikes" || ride.Origin.GetName() != "Station A" || ride.Destination.GetName() != "Station B" {
+		t.Fatalf("expected ride from station A to B, got %+v", ride)
+	}
+
+	if arrival := journey.GetArrival(); !arrival.Equal(departure.Add(23 * time.Second)) {
+		t.Fatalf("expected arrival after 23 seconds, got %v", arrival.Sub(departure))
+	}
+}
@@ -12,6 +12,8 @@ require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/klauspost/compress v1.17.0
 	github.com/kyroy/kdtree v0.0.0-20200419114247-70830f883f1d
+	github.com/paulmach/osm v0.3.0
+	google.golang.org/protobuf v1.31.0
 )
 
 require (
@@ -38,7 +40,6 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/paulmach/go.geojson v1.4.0 // indirect
 	github.com/paulmach/orb v0.5.0 // indirect
-	github.com/paulmach/osm v0.3.0 // indirect
 	github.com/paulmach/protoscan v0.2.1 // indirect
 	github.com/pelletier/go-toml/v2 v2.1.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -49,6 +50,5 @@ require (
 	golang.org/x/net v0.19.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -5,6 +5,7 @@ import (
 	"github.com/Vector-Hector/bifrost/stream"
 	"github.com/artonge/go-gtfs"
 	"github.com/kyroy/kdtree"
+	"io/fs"
 	"math"
 	"sort"
 	"strconv"
@@ -17,45 +18,76 @@ type gtfsStopTime struct {
 	Arrival   uint32
 	StopSeq   uint32
 	StopKey   uint64
+	Pickup    StopType
+	DropOff   StopType
 }
 
-func timeStringToMs(timeStr string) uint32 {
+// frequencyPeriod is a row of frequencies.txt. Times are in ms like the stop times.
+type frequencyPeriod struct {
+	Start   uint32
+	End     uint32
+	Headway uint32
+}
+
+// timeStringToMs converts a gtfs time to ms after noon minus 12h of the service day. Times may exceed 24:00:00 for
+// trips running past midnight.
+func timeStringToMs(timeStr string) (uint32, error) {
 	parts := strings.Split(timeStr, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM:SS", timeStr)
+	}
+
 	hours, err := strconv.Atoi(parts[0])
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("invalid hours of time %q: %w", timeStr, err)
 	}
 
 	minutes, err := strconv.Atoi(parts[1])
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("invalid minutes of time %q: %w", timeStr, err)
 	}
 
 	seconds, err := strconv.Atoi(parts[2])
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("invalid seconds of time %q: %w", timeStr, err)
 	}
 
 	totalSeconds := seconds + minutes*60 + hours*60*60
-	return uint32(totalSeconds) * 1000
+	return uint32(totalSeconds) * 1000, nil
 }
 
-func getUnixDay(date string) uint32 {
+// getUnixDay converts a gtfs date to the number of days since the unix epoch. It is an index of the calendar date,
+// see Timezone.DayStart for when the service day starts.
+func getUnixDay(date string) (uint32, error) {
 	t, err := time.Parse("20060102", date)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("invalid date %q: %w", date, err)
+	}
+
+	return uint32(uint64(t.UnixMilli()) / uint64(DayInMs)), nil
+}
+
+// DistanceMs estimates the time in ms to travel between the points with the vehicle. Returns an error, if the vehicle
+// type is invalid.
+func (b *Bifrost) DistanceMs(from kdtree.Point, to kdtree.Point, vehicleType VehicleType) (uint32, error) {
+	speed, err := b.GetMinAvgSpeed(vehicleType)
+	if err != nil {
+		return 0, err
 	}
 
-	return uint32(uint64(t.UnixMilli()) / uint64(DayInMs))
+	return distanceMs(from, to, speed), nil
 }
 
-func (b *Bifrost) DistanceMs(from kdtree.Point, to kdtree.Point, vehicleType VehicleType) uint32 {
+// distanceMs estimates the time in ms to travel between the points at the speed in meters per ms. Callers, that know
+// their vehicle, pass its speed directly, see GetMinAvgSpeed.
+func distanceMs(from kdtree.Point, to kdtree.Point, speed float64) uint32 {
 	if from.Dimensions() != 2 || to.Dimensions() != 2 {
 		panic("invalid dimension")
 	}
 
 	distInKm := Distance(from.Dimension(0), from.Dimension(1), to.Dimension(0), to.Dimension(1), "K")
-	distInMs := (distInKm * 1000) / b.GetMinAvgSpeed(vehicleType)
+
+	distInMs := (distInKm * 1000) / speed
 	res := uint32(math.Ceil(distInMs))
 	if res == 0 {
 		return 1
@@ -63,16 +95,17 @@ func (b *Bifrost) DistanceMs(from kdtree.Point, to kdtree.Point, vehicleType Veh
 	return res
 }
 
-func (b *Bifrost) GetMinAvgSpeed(vehicleType VehicleType) float64 {
+// GetMinAvgSpeed returns the speed of the vehicle in meters per ms, that is used to estimate distances.
+func (b *Bifrost) GetMinAvgSpeed(vehicleType VehicleType) (float64, error) {
 	switch vehicleType {
 	case VehicleTypeCar:
-		return b.CarMinAvgSpeed
+		return b.CarMinAvgSpeed, nil
 	case VehicleTypeBicycle:
-		return b.CycleSpeed
+		return b.CycleSpeed, nil
 	case VehicleTypeWalking:
-		return b.WalkingSpeed
+		return b.WalkingSpeed, nil
 	default:
-		panic("invalid vehicle type")
+		return 0, fmt.Errorf("invalid vehicle type %d", vehicleType)
 	}
 }
 
@@ -107,16 +140,39 @@ func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64, unit ...st
 	return dist
 }
 
-func (b *Bifrost) AddGtfs(zipFile string) error {
-	// todo merge directly instead of using a temporary struct. see AddStreetData on how it's supposed to work
-
-	g, err := stream.OpenGTFS(zipFile)
+// AddGtfs adds the gtfs feed of a zip file or an unzipped directory. The ids of the feed are prefixed with feedId, so
+// they stay unique when adding multiple feeds. Pass an empty feedId to keep them.
+func (b *Bifrost) AddGtfs(path string, feedId string) error {
+	g, err := stream.OpenGTFS(path)
 	if err != nil {
 		return fmt.Errorf("error opening gtfs stream: %w", err)
 	}
 
 	defer g.Close()
 
+	g.FeedId = feedId
+
+	return b.addGtfs(g)
+}
+
+// AddGtfsFS adds the gtfs feed at the root of a file system, e.g. an embed.FS. See AddGtfs for feedId.
+func (b *Bifrost) AddGtfsFS(source fs.FS, feedId string) error {
+	g := stream.NewGTFS(source)
+	g.FeedId = feedId
+
+	return b.addGtfs(g)
+}
+
+func (b *Bifrost) addGtfs(g *stream.GTFSFile) error {
+	// todo merge directly instead of using a temporary struct. see AddStreetData on how it's supposed to work
+
+	timezoneName, err := readAgencyTimezone(g)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("agency timezone", timezoneName)
+
 	stopCount, err := g.CountRows("stops.txt")
 	if err != nil {
 		return err
@@ -127,16 +183,19 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 	stops := make([]Vertex, stopCount)
 	stopToRoutes := make([][]StopRoutePair, stopCount)
 	stopsIndex := make(map[string]uint64, stopCount)
+	stopChildren := make(map[string][]uint64)
 
 	prog.Reset(uint64(stopCount))
-	err = g.IterateStops(func(index int, stop *gtfs.Stop) bool {
+	err = g.IterateStops(func(index int, stop *stream.Stop) bool {
 		prog.Increment()
 		prog.Print()
 
 		stops[index] = Vertex{
 			Stop: &StopContext{
-				Id:   stop.ID,
-				Name: stop.Name,
+				Id:         stop.ID,
+				Name:       stop.Name,
+				Wheelchair: Accessibility(stop.WheelchairBoarding),
+				Timezone:   stop.Timezone,
 			},
 			Longitude: stop.Longitude,
 			Latitude:  stop.Latitude,
@@ -144,6 +203,11 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 
 		stopsIndex[stop.ID] = uint64(index)
 		stopToRoutes[index] = make([]StopRoutePair, 0)
+
+		if stop.Parent != "" {
+			stopChildren[stop.Parent] = append(stopChildren[stop.Parent], uint64(index))
+		}
+
 		return true
 	})
 	if err != nil {
@@ -151,6 +215,29 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 	}
 	fmt.Println()
 
+	// stops without accessibility information or timezone inherit it from their parent station
+	for parentId, children := range stopChildren {
+		parentKey, ok := stopsIndex[parentId]
+		if !ok {
+			continue
+		}
+
+		for _, child := range children {
+			if stops[child].Stop.Wheelchair == AccessibilityUnknown {
+				stops[child].Stop.Wheelchair = stops[parentKey].Stop.Wheelchair
+			}
+			if stops[child].Stop.Timezone == "" {
+				stops[child].Stop.Timezone = stops[parentKey].Stop.Timezone
+			}
+		}
+	}
+
+	for _, stop := range stops {
+		if stop.Stop.Timezone == "" {
+			stop.Stop.Timezone = timezoneName
+		}
+	}
+
 	fmt.Println("stops", stopCount)
 
 	fmt.Println("converting services")
@@ -173,14 +260,29 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 		services = make([]*Service, serviceCount)
 		servicesIndex = make(map[string]uint32, serviceCount)
 
+		var rowErr error
+
 		prog.Reset(uint64(serviceCount))
 		err = g.IterateServices(func(index int, calendar *gtfs.Calendar) bool {
 			prog.Increment()
 			prog.Print()
+
+			startDay, err := getUnixDay(calendar.Start)
+			if err != nil {
+				rowErr = g.RowError(err)
+				return false
+			}
+
+			endDay, err := getUnixDay(calendar.End)
+			if err != nil {
+				rowErr = g.RowError(err)
+				return false
+			}
+
 			services[index] = &Service{
 				Weekdays:          uint8(calendar.Monday) | uint8(calendar.Tuesday)<<1 | uint8(calendar.Wednesday)<<2 | uint8(calendar.Thursday)<<3 | uint8(calendar.Friday)<<4 | uint8(calendar.Saturday)<<5 | uint8(calendar.Sunday)<<6,
-				StartDay:          getUnixDay(calendar.Start),
-				EndDay:            getUnixDay(calendar.End),
+				StartDay:          startDay,
+				EndDay:            endDay,
 				AddedExceptions:   make([]uint32, 0),
 				RemovedExceptions: make([]uint32, 0),
 			}
@@ -192,6 +294,9 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 		if err != nil {
 			return err
 		}
+		if rowErr != nil {
+			return rowErr
+		}
 		fmt.Println()
 	} else {
 		services = make([]*Service, 0)
@@ -200,7 +305,15 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 
 	fmt.Println("iterating calendar dates")
 
+	var rowErr error
+
 	err = g.IterateCalendarDates(func(index int, calendarDate *gtfs.CalendarDate) bool {
+		day, err := getUnixDay(calendarDate.Date)
+		if err != nil {
+			rowErr = g.RowError(err)
+			return false
+		}
+
 		var service *Service
 
 		if calendarExists {
@@ -221,9 +334,9 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 
 		switch calendarDate.ExceptionType {
 		case 1:
-			service.AddedExceptions = append(service.AddedExceptions, getUnixDay(calendarDate.Date))
+			service.AddedExceptions = append(service.AddedExceptions, day)
 		case 2:
-			service.RemovedExceptions = append(service.RemovedExceptions, getUnixDay(calendarDate.Date))
+			service.RemovedExceptions = append(service.RemovedExceptions, day)
 		}
 
 		return true
@@ -231,6 +344,9 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 	if err != nil {
 		return err
 	}
+	if rowErr != nil {
+		return rowErr
+	}
 
 	// sort service exceptions
 	for _, service := range services {
@@ -262,6 +378,8 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 		routeInformation[index] = &RouteInformation{
 			ShortName: route.ShortName,
 			RouteId:   route.ID,
+			AgencyId:  route.AgencyID,
+			Type:      route.Type,
 		}
 		return true
 	})
@@ -280,9 +398,12 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 	tripToServiceKey := make([]uint32, tripCount)
 	procTripsIndex := make(map[string]uint32, tripCount)
 	tripInformation := make([]*TripInformation, tripCount)
+	tripBlocks := make([]string, tripCount)
+	tripWheelchair := make([]Accessibility, tripCount)
+	tripBikes := make([]Accessibility, tripCount)
 
 	prog.Reset(uint64(tripCount))
-	err = g.IterateTrips(func(index int, trip *gtfs.Trip) bool {
+	err = g.IterateTrips(func(index int, trip *stream.Trip) bool {
 		prog.Increment()
 		prog.Print()
 
@@ -294,6 +415,9 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 			Headsign: trip.Headsign,
 			TripId:   trip.ID,
 		}
+		tripBlocks[index] = trip.BlockID
+		tripWheelchair[index] = Accessibility(trip.WheelchairAccessible)
+		tripBikes[index] = Accessibility(trip.BikesAllowed)
 		return true
 	})
 	if err != nil {
@@ -312,25 +436,142 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 	stopTimes := make([]*gtfsStopTime, stopTimeCount)
 
 	prog.Reset(uint64(stopTimeCount))
-	err = g.IterateStopTimes(func(index int, stopTime *gtfs.StopTime) bool {
+	err = g.IterateStopTimes(func(index int, stopTime *stream.StopTime) bool {
 		prog.Increment()
 		prog.Print()
 
+		departure, err := timeStringToMs(stopTime.Departure)
+		if err != nil {
+			rowErr = g.RowError(fmt.Errorf("invalid departure_time: %w", err))
+			return false
+		}
+
+		arrival, err := timeStringToMs(stopTime.Arrival)
+		if err != nil {
+			rowErr = g.RowError(fmt.Errorf("invalid arrival_time: %w", err))
+			return false
+		}
+
 		tripKey := procTripsIndex[stopTime.TripID]
 		procTrips[tripKey] = append(procTrips[tripKey], uint32(index))
 		stopTimes[index] = &gtfsStopTime{
-			Departure: timeStringToMs(stopTime.Departure),
-			Arrival:   timeStringToMs(stopTime.Arrival),
+			Departure: departure,
+			Arrival:   arrival,
 			StopSeq:   stopTime.StopSeq,
 			StopKey:   stopsIndex[stopTime.StopID],
+			Pickup:    StopType(stopTime.PickupType),
+			DropOff:   StopType(stopTime.DropOffType),
 		}
 		return true
 	})
 	if err != nil {
 		return err
 	}
+	if rowErr != nil {
+		return rowErr
+	}
 	fmt.Println()
 
+	if g.Exists("frequencies.txt") {
+		fmt.Println("expanding frequency based trips")
+
+		frequencies := make(map[uint32][]frequencyPeriod)
+		frequencyTrips := make([]uint32, 0) // keeps the file order, so trip keys are the same for every import
+
+		err = g.IterateFrequencies(func(index int, frequency *gtfs.Frequency) bool {
+			tripKey, ok := procTripsIndex[frequency.TripId]
+			if !ok || frequency.HeadwaySeconds == 0 {
+				return true
+			}
+
+			start, err := timeStringToMs(frequency.StartTime)
+			if err != nil {
+				rowErr = g.RowError(fmt.Errorf("invalid start_time: %w", err))
+				return false
+			}
+
+			end, err := timeStringToMs(frequency.EndTime)
+			if err != nil {
+				rowErr = g.RowError(fmt.Errorf("invalid end_time: %w", err))
+				return false
+			}
+
+			if _, ok := frequencies[tripKey]; !ok {
+				frequencyTrips = append(frequencyTrips, tripKey)
+			}
+
+			frequencies[tripKey] = append(frequencies[tripKey], frequencyPeriod{
+				Start:   start,
+				End:     end,
+				Headway: frequency.HeadwaySeconds * 1000,
+			})
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if rowErr != nil {
+			return rowErr
+		}
+
+		for _, tripKey := range frequencyTrips {
+			tripFrequencies := frequencies[tripKey]
+			template := procTrips[tripKey]
+			if len(template) == 0 {
+				continue
+			}
+
+			// the stop times of the template trip are only used as offsets to its first departure
+			first := stopTimes[template[0]]
+			for _, stopTimeKey := range template {
+				if stopTimes[stopTimeKey].StopSeq < first.StopSeq {
+					first = stopTimes[stopTimeKey]
+				}
+			}
+
+			isTemplate := true
+
+			for _, frequency := range tripFrequencies {
+				// frequencies without exact times are expanded the same way, assuming the first trip departs at the
+				// start of the period
+				for departure := frequency.Start; departure < frequency.End; departure += frequency.Headway {
+					shift := int64(departure) - int64(first.Departure)
+
+					instance := make([]uint32, len(template))
+					for i, stopTimeKey := range template {
+						stopTime := *stopTimes[stopTimeKey]
+						stopTime.Departure = uint32(int64(stopTime.Departure) + shift)
+						stopTime.Arrival = uint32(int64(stopTime.Arrival) + shift)
+
+						instance[i] = uint32(len(stopTimes))
+						stopTimes = append(stopTimes, &stopTime)
+					}
+
+					// the first instance replaces the template, so the trip id still points to a running trip. Like all
+					// instances, it is no continuation of the other trips of its block
+					if isTemplate {
+						procTrips[tripKey] = instance
+						tripBlocks[tripKey] = ""
+						isTemplate = false
+						continue
+					}
+
+					procTrips = append(procTrips, instance)
+					tripToRouteKey = append(tripToRouteKey, tripToRouteKey[tripKey])
+					tripToServiceKey = append(tripToServiceKey, tripToServiceKey[tripKey])
+					tripInformation = append(tripInformation, tripInformation[tripKey])
+					tripBlocks = append(tripBlocks, "") // instances are no continuations of each other, see linkBlocks
+					tripWheelchair = append(tripWheelchair, tripWheelchair[tripKey])
+					tripBikes = append(tripBikes, tripBikes[tripKey])
+				}
+			}
+		}
+
+		tripCount = len(procTrips)
+
+		fmt.Println("trips after expanding frequencies", tripCount)
+	}
+
 	fmt.Println("expanding routes to distinct stop sequences")
 
 	tripRoutes := make([]map[string][]uint32, routeCount)
@@ -409,14 +650,18 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 			st[j] = Stopover{
 				Arrival:   arr,
 				Departure: dep,
+				Pickup:    stopTime.Pickup,
+				DropOff:   stopTime.DropOff,
 			}
 		}
 
 		serviceKey := tripToServiceKey[i]
 
 		trips[i] = &Trip{
-			StopTimes: st,
-			Service:   serviceKey,
+			StopTimes:  st,
+			Service:    serviceKey,
+			Wheelchair: tripWheelchair[i],
+			Bikes:      tripBikes[i],
 		}
 	}
 
@@ -487,9 +732,12 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 				reorders[routeStopKey] = reorder
 			}
 
+			mode, _ := routeTypeMode(routeInformation[gtfsRouteKey].Type)
+
 			routes = append(routes, &Route{
 				Stops: routeStops,
 				Trips: route,
+				Mode:  transitModeOf(mode),
 			})
 			raptorToGtfsRoutes = append(raptorToGtfsRoutes, uint32(gtfsRouteKey))
 		}
@@ -505,8 +753,41 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 		}
 	}
 
-	b.MergeData(&RoutingData{
+	fmt.Println("linking trips of the same block")
+
+	blockNext := linkBlocks(trips, procTrips, stopTimes, tripBlocks, tripToServiceKey)
+
+	streetGraph := make([][]Arc, len(stops))
+	transfers := make(map[uint64][]TransferRule)
+
+	if g.Exists("transfers.txt") {
+		fmt.Println("reading transfers")
+
+		err = b.readTransfers(g, stops, stopsIndex, stopChildren, routeIndex, procTripsIndex, transfers, blockNext, streetGraph)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("stops with transfer rules", len(transfers))
+	}
+
+	for prev, next := range blockNext {
+		if trips[prev] == nil || trips[next] == nil {
+			delete(blockNext, prev) // in-seat transfers may reference trips without stop times
+		}
+	}
+
+	fmt.Println("trips continuing as another trip", len(blockNext))
+
+	firstDay, lastDay := serviceDayRange(services)
+	timezone, err := NewTimezone(timezoneName, firstDay, lastDay+maxTripDayLength+1)
+	if err != nil {
+		return fmt.Errorf("error reading agency timezone: %w", err)
+	}
+
+	return b.MergeData(&RoutingData{
 		MaxTripDayLength: maxTripDayLength,
+		Timezones:        []*Timezone{timezone},
 		Vertices:         stops,
 		StopsIndex:       stopsIndex,
 		Routes:           routes,
@@ -519,10 +800,224 @@ func (b *Bifrost) AddGtfs(zipFile string) error {
 		RouteInformation: routeInformation,
 		TripInformation:  tripInformation,
 		TripToRoute:      tripToRoute,
+		Transfers:        transfers,
+		BlockNext:        blockNext,
+		BlockPrevious:    reverseBlocks(blockNext),
 
-		StreetGraph: make([][]Arc, len(stops)),
-		NodesIndex:  make(map[int64]uint64),
+		StreetGraph: streetGraph,
+		NodesIndex:  make(map[OsmSegment]uint64),
 	})
+}
+
+// readAgencyTimezone returns the agency_timezone of the feed, which all agencies of a feed share. Feeds without
+// agencies are read as UTC.
+func readAgencyTimezone(g *stream.GTFSFile) (string, error) {
+	timezone := "UTC"
+
+	if !g.Exists("agency.txt") {
+		return timezone, nil
+	}
+
+	err := g.IterateAgencies(func(index int, agency *gtfs.Agency) bool {
+		if agency.Timezone != "" {
+			timezone = agency.Timezone
+		}
+		return false
+	})
+
+	return timezone, err
+}
+
+// serviceDayRange returns the first and last day, on which one of the services may run.
+func serviceDayRange(services []*Service) (uint32, uint32) {
+	firstDay := uint32(math.MaxUint32)
+	lastDay := uint32(0)
+
+	include := func(day uint32) {
+		if day < firstDay {
+			firstDay = day
+		}
+		if day > lastDay {
+			lastDay = day
+		}
+	}
+
+	for _, service := range services {
+		if service.Weekdays != 0 {
+			include(service.StartDay)
+			include(service.EndDay)
+		}
+
+		for _, day := range service.AddedExceptions {
+			include(day)
+		}
+	}
+
+	if firstDay > lastDay {
+		return 0, 0
+	}
+
+	return firstDay, lastDay
+}
+
+// linkBlocks finds the trips, that a vehicle continues as after finishing a trip. These are the trips of the same
+// block and service, that start at the stop where the previous trip ended.
+func linkBlocks(trips []*Trip, procTrips [][]uint32, stopTimes []*gtfsStopTime, tripBlocks []string, tripToServiceKey []uint32) map[uint32]uint32 {
+	blocks := make(map[string][]uint32)
+
+	for tripKey, block := range tripBlocks {
+		if block == "" || trips[tripKey] == nil {
+			continue
+		}
+
+		key := block + "/\\/" + strconv.Itoa(int(tripToServiceKey[tripKey]))
+		blocks[key] = append(blocks[key], uint32(tripKey))
+	}
+
+	blockNext := make(map[uint32]uint32)
+
+	for _, block := range blocks {
+		sort.Slice(block, func(i, j int) bool {
+			return trips[block[i]].StopTimes[0].Departure < trips[block[j]].StopTimes[0].Departure
+		})
+
+		for i := 1; i < len(block); i++ {
+			prev := block[i-1]
+			next := block[i]
+
+			prevStopTimes := procTrips[prev]
+			lastStop := stopTimes[prevStopTimes[len(prevStopTimes)-1]].StopKey
+			firstStop := stopTimes[procTrips[next][0]].StopKey
+
+			if lastStop != firstStop {
+				continue
+			}
+
+			prevTrip := trips[prev]
+			if trips[next].StopTimes[0].Departure < prevTrip.StopTimes[len(prevTrip.StopTimes)-1].Arrival {
+				continue
+			}
+
+			blockNext[prev] = next
+		}
+	}
+
+	return blockNext
+}
+
+// reverseBlocks maps each trip to the trip it continues.
+func reverseBlocks(blockNext map[uint32]uint32) map[uint32]uint32 {
+	blockPrevious := make(map[uint32]uint32, len(blockNext))
+
+	for prev, next := range blockNext {
+		blockPrevious[next] = prev
+	}
+
+	return blockPrevious
+}
+
+// readTransfers converts transfers.txt to transfer rules. Rules referencing a parent station apply to all of its
+// stops. Transfers between different stops are added to the street graph, so they can be walked. In-seat transfers
+// add or remove links between the trips in blockNext.
+func (b *Bifrost) readTransfers(g *stream.GTFSFile, stops []Vertex, stopsIndex map[string]uint64, stopChildren map[string][]uint64, routeIndex map[string]uint32, tripsIndex map[string]uint32, transfers map[uint64][]TransferRule, blockNext map[uint32]uint32, streetGraph [][]Arc) error {
+	expandStop := func(id string) []uint64 {
+		stop, ok := stopsIndex[id]
+		if !ok {
+			return nil
+		}
+
+		return append([]uint64{stop}, stopChildren[id]...)
+	}
+
+	lookup := func(index map[string]uint32, id string) (uint32, bool) {
+		if id == "" {
+			return TransferAny, true
+		}
+
+		key, ok := index[id]
+		return key, ok
+	}
+
+	skipped := 0
+
+	err := g.IterateTransfers(func(index int, transfer *stream.Transfer) bool {
+		fromRoute, fromRouteOk := lookup(routeIndex, transfer.FromRouteID)
+		toRoute, toRouteOk := lookup(routeIndex, transfer.ToRouteID)
+		fromTrip, fromTripOk := lookup(tripsIndex, transfer.FromTripID)
+		toTrip, toTripOk := lookup(tripsIndex, transfer.ToTripID)
+
+		if !fromRouteOk || !toRouteOk || !fromTripOk || !toTripOk {
+			skipped++
+			return true
+		}
+
+		transferType := TransferType(transfer.Type)
+		if transferType > TransferTypeInSeatForbidden {
+			skipped++
+			return true
+		}
+
+		if transferType == TransferTypeInSeat || transferType == TransferTypeInSeatForbidden {
+			if fromTrip == TransferAny || toTrip == TransferAny {
+				skipped++
+				return true
+			}
+
+			if transferType == TransferTypeInSeat {
+				blockNext[fromTrip] = toTrip
+			} else if next, ok := blockNext[fromTrip]; ok && next == toTrip {
+				delete(blockNext, fromTrip)
+			}
+
+			return true
+		}
+
+		fromStops := expandStop(transfer.FromStopID)
+		toStops := expandStop(transfer.ToStopID)
+
+		if len(fromStops) == 0 || len(toStops) == 0 {
+			skipped++
+			return true
+		}
+
+		for _, from := range fromStops {
+			for _, to := range toStops {
+				transfers[to] = append(transfers[to], TransferRule{
+					FromStop:  from,
+					FromRoute: fromRoute,
+					ToRoute:   toRoute,
+					FromTrip:  fromTrip,
+					ToTrip:    toTrip,
+					Type:      transferType,
+					MinTimeMs: uint32(transfer.MinTime) * 1000,
+				})
+
+				if from == to {
+					continue
+				}
+
+				// make sure the stops are connected, even if they are far apart or not connected to the street graph
+				dist := distanceMs(&stops[from], &stops[to], b.WalkingSpeed)
+				if transferType == TransferTypeMinTime && transfer.MinTime > 0 {
+					dist = uint32(transfer.MinTime) * 1000
+				}
+
+				streetGraph[from] = append(streetGraph[from], Arc{
+					Target:       to,
+					WalkDistance: dist,
+				})
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		fmt.Println("skipped", skipped, "transfers with unknown stops, routes, trips or types")
+	}
 
 	return nil
 }
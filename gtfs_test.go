@@ -0,0 +1,162 @@
+package bifrost
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+var testFeed = map[string]string{
+	"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\n" +
+		"a,Agency,https://example.com,Europe/Berlin\n",
+	"stops.txt": "stop_id,stop_name,stop_lat,stop_lon\n" +
+		"s0,Stop 0,48.1,11.5\n" +
+		"s1,Stop 1,48.2,11.6\n",
+	"routes.txt": "route_id,agency_id,route_short_name,route_type\n" +
+		"r,a,1,3\n",
+	"trips.txt": "route_id,service_id,trip_id\n" +
+		"r,weekdays,t\n",
+	"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"t,08:00:00,08:00:00,s0,1\n" +
+		"t,08:10:00,08:10:00,s1,2\n",
+	"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+		"weekdays,1,1,1,1,1,0,0,20230101,20231231\n",
+	"calendar_dates.txt": "service_id,date,exception_type\n" +
+		"weekdays,20230501,2\n",
+}
+
+func checkTestFeed(t *testing.T, b *Bifrost) {
+	if b.Data == nil || len(b.Data.Trips) != 1 || len(b.Data.Routes) != 1 || len(b.Data.StopsIndex) != 2 {
+		t.Fatal("expected one trip on one route between two stops")
+	}
+
+	if len(b.Data.Timezones) != 1 || b.Data.Timezones[0].Name != "Europe/Berlin" || b.Data.RouteInformation[0].AgencyId != "a" {
+		t.Fatal("expected the agency of the feed to be read")
+	}
+}
+
+func TestAddGtfsFS(t *testing.T) {
+	source := fstest.MapFS{}
+	for name, content := range testFeed {
+		source[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	b := &Bifrost{}
+	err := b.AddGtfsFS(source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTestFeed(t, b)
+}
+
+func TestAddGtfsDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, content := range testFeed {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &Bifrost{}
+	err := b.AddGtfs(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTestFeed(t, b)
+}
+
+func TestAddGtfsFeedIds(t *testing.T) {
+	source := fstest.MapFS{}
+	for name, content := range testFeed {
+		source[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	b := &Bifrost{}
+	for _, feedId := range []string{"regional", "national"} {
+		err := b.AddGtfsFS(source, feedId)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(b.Data.StopsIndex) != 4 || len(b.Data.Trips) != 2 {
+		t.Fatalf("expected the stops and trips of both feeds, got %d stops", len(b.Data.StopsIndex))
+	}
+
+	stop, ok := b.Data.StopsIndex["national:s1"]
+	if !ok || b.Data.Vertices[stop].Stop.Id != "national:s1" {
+		t.Fatal("expected prefixed stop ids")
+	}
+
+	if len(b.Data.StopToRoutes[stop]) != 1 || b.Data.StopToRoutes[stop][0].Route != 1 {
+		t.Fatal("expected stops of the second feed to be served by its route")
+	}
+
+	if b.Data.TripToRoute[1] != 1 || b.Data.GtfsRouteIndex[1] != 1 || b.Data.TripInformation[1].TripId != "national:t" {
+		t.Fatal("expected the trip of the second feed to keep its route")
+	}
+
+	if b.Data.RouteInformation[1].RouteId != "national:r" || b.Data.RouteInformation[1].AgencyId != "national:a" {
+		t.Fatalf("expected prefixed route ids, got %+v", b.Data.RouteInformation[1])
+	}
+}
+
+func TestFrequencies(t *testing.T) {
+	source := fstest.MapFS{}
+	for name, content := range testFeed {
+		source[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	// a loop of a block, so each instance ends where the next one starts. The trip u of the same block starts where the
+	// first instance ends, but is not continued by it either
+	source["trips.txt"] = &fstest.MapFile{Data: []byte("route_id,service_id,trip_id,block_id\n" +
+		"r,weekdays,t,b\n" +
+		"r,weekdays,u,b\n")}
+	source["stop_times.txt"] = &fstest.MapFile{Data: []byte("trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"t,07:00:00,07:00:00,s0,1\n" +
+		"t,07:04:00,07:04:00,s1,2\n" +
+		"t,07:08:00,07:08:00,s0,3\n" +
+		"u,08:08:00,08:08:00,s0,1\n" +
+		"u,08:12:00,08:12:00,s1,2\n")}
+	source["frequencies.txt"] = &fstest.MapFile{Data: []byte("trip_id,start_time,end_time,headway_secs,exact_times\n" +
+		"t,08:00:00,08:30:00,600,1\n" +
+		"t,12:00:00,12:20:00,600,0\n")}
+
+	b := &Bifrost{}
+	err := b.AddGtfsFS(source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	departures := make([]uint32, 0, len(b.Data.Trips))
+	for _, trip := range b.Data.Trips {
+		departures = append(departures, trip.StopTimes[0].Departure)
+	}
+	sort.Slice(departures, func(i, j int) bool {
+		return departures[i] < departures[j]
+	})
+
+	hour := uint32(3600 * 1000)
+	minute := hour / 60
+	expected := []uint32{8 * hour, 8*hour + 8*minute, 8*hour + 10*minute, 8*hour + 20*minute, 12 * hour, 12*hour + 10*minute}
+
+	if len(departures) != len(expected) {
+		t.Fatalf("expected %d trips with exact and inexact times and trip u, got departures %v", len(expected), departures)
+	}
+
+	for i, departure := range departures {
+		if departure != expected[i] {
+			t.Fatalf("expected departures %v, got %v", expected, departures)
+		}
+	}
+
+	if len(b.Data.BlockNext) != 0 {
+		t.Fatalf("expected frequency instances not to continue as each other or other trips, got %v", b.Data.BlockNext)
+	}
+}
@@ -0,0 +1,428 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/Vector-Hector/bifrost/stream"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The GTFS-RT messages are decoded by hand to avoid generated code. Only the fields used by bifrost are read, see
+// https://gtfs.org/realtime/reference/ for the field numbers.
+
+// trip schedule relationships of GTFS-RT
+const (
+	rtTripScheduled = 0
+	rtTripAdded     = 1
+	rtTripCanceled  = 3
+	rtTripNew       = 8
+	rtTripDeleted   = 7
+)
+
+// stop time schedule relationships of GTFS-RT
+const (
+	rtStopScheduled = 0
+	rtStopSkipped   = 1
+	rtStopNoData    = 2
+)
+
+type rtFeedMessage struct {
+	Timestamp uint64 // posix time in seconds
+	Entities  []*rtFeedEntity
+}
+
+type rtFeedEntity struct {
+	Id         string
+	IsDeleted  bool
+	TripUpdate *rtTripUpdate
+	Alert      *rtAlert
+}
+
+type rtTripDescriptor struct {
+	TripId               string
+	RouteId              string
+	StartTime            string
+	StartDate            string
+	ScheduleRelationship int
+}
+
+type rtTripUpdate struct {
+	Trip            rtTripDescriptor
+	StopTimeUpdates []*rtStopTimeUpdate
+	Delay           int32
+	HasDelay        bool
+}
+
+type rtStopTimeUpdate struct {
+	StopSequence         uint32
+	StopId               string
+	Arrival              *rtStopTimeEvent
+	Departure            *rtStopTimeEvent
+	ScheduleRelationship int
+}
+
+type rtAlert struct {
+	ActivePeriods    []rtTimeRange
+	InformedEntities []rtEntitySelector
+	Cause            int
+	Effect           int
+	Url              string
+	HeaderText       string
+	DescriptionText  string
+}
+
+type rtTimeRange struct {
+	Start uint64 // posix time in seconds, 0 if open
+	End   uint64 // posix time in seconds, 0 if open
+}
+
+type rtEntitySelector struct {
+	AgencyId     string
+	RouteId      string
+	RouteType    int
+	HasRouteType bool
+	Trip         *rtTripDescriptor
+	StopId       string
+}
+
+type rtStopTimeEvent struct {
+	Delay    int32 // in seconds
+	HasDelay bool
+	Time     int64 // posix time in seconds
+	HasTime  bool
+}
+
+// readRealtimeSource reads a GTFS-RT feed from a file or a http(s) url.
+func readRealtimeSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: %s", source, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// rangeFields calls fn for each field of a protobuf message. Varint and fixed fields are passed as number, length
+// delimited fields as bytes.
+func rangeFields(data []byte, fn func(num protowire.Number, number uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var number uint64
+		var bytes []byte
+
+		switch typ {
+		case protowire.VarintType:
+			number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			number = uint64(v)
+		case protowire.Fixed64Type:
+			number, n = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		err := fn(num, number, bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeFeedMessage decodes a GTFS-RT feed. Its ids are prefixed with the feed id of the gtfs feed it belongs to, see
+// stream.PrefixId.
+func decodeFeedMessage(data []byte, feedId string) (*rtFeedMessage, error) {
+	feed := &rtFeedMessage{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1: // header
+			return rangeFields(bytes, func(num protowire.Number, number uint64, bytes []byte) error {
+				if num == 3 {
+					feed.Timestamp = number
+				}
+				return nil
+			})
+		case 2:
+			entity, err := decodeFeedEntity(bytes)
+			if err != nil {
+				return err
+			}
+			feed.Entities = append(feed.Entities, entity)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding gtfs realtime feed: %w", err)
+	}
+
+	if feedId != "" {
+		feed.prefixIds(feedId)
+	}
+
+	return feed, nil
+}
+
+func (feed *rtFeedMessage) prefixIds(feedId string) {
+	prefixTrip := func(trip *rtTripDescriptor) {
+		trip.TripId = stream.PrefixId(feedId, trip.TripId)
+		trip.RouteId = stream.PrefixId(feedId, trip.RouteId)
+	}
+
+	for _, entity := range feed.Entities {
+		if update := entity.TripUpdate; update != nil {
+			prefixTrip(&update.Trip)
+			for _, stopTimeUpdate := range update.StopTimeUpdates {
+				stopTimeUpdate.StopId = stream.PrefixId(feedId, stopTimeUpdate.StopId)
+			}
+		}
+
+		if alert := entity.Alert; alert != nil {
+			for i := range alert.InformedEntities {
+				selector := &alert.InformedEntities[i]
+				selector.AgencyId = stream.PrefixId(feedId, selector.AgencyId)
+				selector.RouteId = stream.PrefixId(feedId, selector.RouteId)
+				selector.StopId = stream.PrefixId(feedId, selector.StopId)
+				if selector.Trip != nil {
+					prefixTrip(selector.Trip)
+				}
+			}
+		}
+	}
+}
+
+func decodeFeedEntity(data []byte) (*rtFeedEntity, error) {
+	entity := &rtFeedEntity{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			entity.Id = string(bytes)
+		case 2:
+			entity.IsDeleted = number != 0
+		case 3:
+			update, err := decodeTripUpdate(bytes)
+			if err != nil {
+				return err
+			}
+			entity.TripUpdate = update
+		case 5:
+			alert, err := decodeAlert(bytes)
+			if err != nil {
+				return err
+			}
+			entity.Alert = alert
+		}
+		return nil
+	})
+
+	return entity, err
+}
+
+func decodeAlert(data []byte) (*rtAlert, error) {
+	alert := &rtAlert{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		var err error
+
+		switch num {
+		case 1:
+			period := rtTimeRange{}
+			err = rangeFields(bytes, func(num protowire.Number, number uint64, bytes []byte) error {
+				switch num {
+				case 1:
+					period.Start = number
+				case 2:
+					period.End = number
+				}
+				return nil
+			})
+			alert.ActivePeriods = append(alert.ActivePeriods, period)
+		case 5:
+			var selector rtEntitySelector
+			selector, err = decodeEntitySelector(bytes)
+			alert.InformedEntities = append(alert.InformedEntities, selector)
+		case 6:
+			alert.Cause = int(number)
+		case 7:
+			alert.Effect = int(number)
+		case 8:
+			alert.Url, err = decodeTranslatedString(bytes)
+		case 10:
+			alert.HeaderText, err = decodeTranslatedString(bytes)
+		case 11:
+			alert.DescriptionText, err = decodeTranslatedString(bytes)
+		}
+		return err
+	})
+
+	return alert, err
+}
+
+func decodeEntitySelector(data []byte) (rtEntitySelector, error) {
+	selector := rtEntitySelector{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			selector.AgencyId = string(bytes)
+		case 2:
+			selector.RouteId = string(bytes)
+		case 3:
+			selector.RouteType = int(int32(number))
+			selector.HasRouteType = true
+		case 4:
+			trip, err := decodeTripDescriptor(bytes)
+			if err != nil {
+				return err
+			}
+			selector.Trip = &trip
+		case 5:
+			selector.StopId = string(bytes)
+		}
+		return nil
+	})
+
+	return selector, err
+}
+
+// decodeTranslatedString returns the first translation of a TranslatedString, which is the default language of the
+// feed in most cases.
+func decodeTranslatedString(data []byte) (string, error) {
+	text := ""
+	found := false
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		if num != 1 || found {
+			return nil
+		}
+
+		found = true
+		return rangeFields(bytes, func(num protowire.Number, number uint64, bytes []byte) error {
+			if num == 1 {
+				text = string(bytes)
+			}
+			return nil
+		})
+	})
+
+	return text, err
+}
+
+func decodeTripDescriptor(data []byte) (rtTripDescriptor, error) {
+	trip := rtTripDescriptor{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			trip.TripId = string(bytes)
+		case 2:
+			trip.StartTime = string(bytes)
+		case 3:
+			trip.StartDate = string(bytes)
+		case 4:
+			trip.ScheduleRelationship = int(number)
+		case 5:
+			trip.RouteId = string(bytes)
+		}
+		return nil
+	})
+
+	return trip, err
+}
+
+func decodeTripUpdate(data []byte) (*rtTripUpdate, error) {
+	update := &rtTripUpdate{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			trip, err := decodeTripDescriptor(bytes)
+			if err != nil {
+				return err
+			}
+			update.Trip = trip
+		case 2:
+			stopTimeUpdate, err := decodeStopTimeUpdate(bytes)
+			if err != nil {
+				return err
+			}
+			update.StopTimeUpdates = append(update.StopTimeUpdates, stopTimeUpdate)
+		case 5:
+			update.Delay = int32(number)
+			update.HasDelay = true
+		}
+		return nil
+	})
+
+	return update, err
+}
+
+func decodeStopTimeUpdate(data []byte) (*rtStopTimeUpdate, error) {
+	update := &rtStopTimeUpdate{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		var err error
+
+		switch num {
+		case 1:
+			update.StopSequence = uint32(number)
+		case 2:
+			update.Arrival, err = decodeStopTimeEvent(bytes)
+		case 3:
+			update.Departure, err = decodeStopTimeEvent(bytes)
+		case 4:
+			update.StopId = string(bytes)
+		case 5:
+			update.ScheduleRelationship = int(number)
+		}
+		return err
+	})
+
+	return update, err
+}
+
+func decodeStopTimeEvent(data []byte) (*rtStopTimeEvent, error) {
+	event := &rtStopTimeEvent{}
+
+	err := rangeFields(data, func(num protowire.Number, number uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			event.Delay = int32(number)
+			event.HasDelay = true
+		case 2:
+			event.Time = int64(number)
+			event.HasTime = true
+		}
+		return nil
+	})
+
+	return event, err
+}
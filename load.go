@@ -11,12 +11,23 @@ import (
 
 type LoadOptions struct {
 	OsmPaths    []string // paths to osm pbf files
-	GtfsPaths   []string // path to GTFS zip files
-	BifrostPath string   // path to bifrost cache
+	GtfsPaths   []string // paths to GTFS zip files or unzipped directories
+	GtfsFeedIds []string // feed id of each GTFS path, prefixed to the ids of the feed. Empty or missing ids keep them
+	BifrostPath string   // path to bifrost cache, binary or json
+	GbfsPaths   []string // directories or http base urls of GBFS feeds, read on every load as they change frequently
+
+	StationMerge      *StationMergeOptions // merges the stations of different GTFS feeds, if set. See MergeStations
+	StationReportPath string               // path to write the merged stations to as json, if set
+
+	OutdatedCache OutdatedCachePolicy // what to do, if the inputs or parameters changed since the cache was built
 }
 
 // LoadData loads the data from a given bifrost cache if it exists. Otherwise it will generate the data from given GTFS
-// and street CSV files. After generating the data it will write the data to a bifrost cache.
+// and street CSV files. After generating the data it will write the data to a binary bifrost cache, see
+// WriteBifrostCache. Json caches of WriteBifrostData are still read. If the GTFS or OSM files or the parameters changed
+// since the cache was built, it is rebuilt or an error is returned, see OutdatedCache. Caches without fingerprint, like
+// json caches, are only outdated, if an input was modified after they were written. Missing inputs are not checked,
+// so the cache can be used on its own. GBFS feeds are not cached, they are added afterwards.
 func (b *Bifrost) LoadData(load *LoadOptions) error {
 	cacheExists := true
 
@@ -28,19 +39,66 @@ func (b *Bifrost) LoadData(load *LoadOptions) error {
 	}
 
 	if cacheExists {
-		b.AddBifrostData(load.BifrostPath)
+		reason, err := b.checkCache(load)
+		if err != nil {
+			return fmt.Errorf("error checking bifrost cache: %w", err)
+		}
+
+		if reason != "" && load.OutdatedCache == OutdatedCacheError {
+			return fmt.Errorf("%w: %s", ErrOutdatedCache, reason)
+		}
+
+		if reason != "" {
+			fmt.Println("rebuilding bifrost cache:", reason)
+			cacheExists = false
+		}
+	}
+
+	if cacheExists {
+		binaryCache, err := isBifrostCache(load.BifrostPath)
+		if err != nil {
+			return fmt.Errorf("error checking for bifrost cache: %w", err)
+		}
+
+		if binaryCache {
+			err = b.AddBifrostCache(load.BifrostPath)
+		} else {
+			err = b.AddBifrostData(load.BifrostPath)
+		}
+
+		if err != nil {
+			return err
+		}
+
 		b.Data.RebuildVertexTree()
-		return nil
+		b.Data.RebuildReverseStreetGraph()
+		return b.addGbfsFeeds(load.GbfsPaths)
 	}
 
 	t := time.Now()
 
+	fmt.Println("fingerprinting inputs")
+
+	fingerprint, err := b.cacheFingerprint(load)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("fingerprinting inputs took", time.Since(t))
+
+	t = time.Now()
+
 	fmt.Println("reading gtfs data")
 
-	for _, gtfsPath := range load.GtfsPaths {
+	for i, gtfsPath := range load.GtfsPaths {
+		feedId := ""
+		if i < len(load.GtfsFeedIds) {
+			feedId = load.GtfsFeedIds[i]
+		}
+
 		fmt.Println("reading gtfs data from", gtfsPath)
 		localT := time.Now()
-		err = b.AddGtfs(gtfsPath)
+		err = b.AddGtfs(gtfsPath, feedId)
 		if err != nil {
 			return fmt.Errorf("error reading gtfs data: %w", err)
 		}
@@ -69,27 +127,74 @@ func (b *Bifrost) LoadData(load *LoadOptions) error {
 
 	fmt.Println("connecting stops to vertices took", time.Since(t))
 
+	if load.StationMerge != nil {
+		err = b.mergeStations(load.StationMerge, load.StationReportPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.Data.RebuildReverseStreetGraph()
+
 	fmt.Println("writing to bifrost cache")
 	t = time.Now()
 
-	b.WriteBifrostData(load.BifrostPath)
+	err = b.writeBifrostCache(load.BifrostPath, fingerprint)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("writing raptor data took", time.Since(t))
 
+	return b.addGbfsFeeds(load.GbfsPaths)
+}
+
+// mergeStations merges the stations of different feeds and writes the clusters to the report path, if it is set.
+func (b *Bifrost) mergeStations(options *StationMergeOptions, reportPath string) error {
+	clusters := b.MergeStations(options)
+
+	if reportPath == "" {
+		return nil
+	}
+
+	report, err := json.MarshalIndent(clusters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding station report: %w", err)
+	}
+
+	err = os.WriteFile(reportPath, report, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing station report: %w", err)
+	}
+
 	return nil
 }
 
-// AddBifrostData Adds cached bifrost data file to the Bifrost data. Used by LoadOptions, generated by WriteBifrostData
-func (b *Bifrost) AddBifrostData(fileName string) {
+func (b *Bifrost) addGbfsFeeds(feeds []string) error {
+	for _, feed := range feeds {
+		fmt.Println("reading gbfs data from", feed)
+
+		err := b.AddGBFS(feed)
+		if err != nil {
+			return fmt.Errorf("error reading gbfs data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddBifrostData Adds cached bifrost data file to the Bifrost data. Used by LoadOptions, generated by WriteBifrostData.
+// Returns a CacheError, if the file cannot be decoded.
+func (b *Bifrost) AddBifrostData(fileName string) error {
 	f, err := os.Open(fileName)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error reading bifrost data: %w", err)
 	}
 	defer f.Close()
 
 	read, err := zstd.NewReader(f)
 	if err != nil {
-		panic(err)
+		return &CacheError{Path: fileName, Err: err}
 	}
 	defer read.Close()
 
@@ -98,36 +203,42 @@ func (b *Bifrost) AddBifrostData(fileName string) {
 	decoder := json.NewDecoder(read)
 	err = decoder.Decode(r)
 	if err != nil {
-		panic(err)
+		return &CacheError{Path: fileName, Err: err}
 	}
 
-	b.Data = MergeData(b.Data, r)
+	err = r.EnsureSliceLengths()
+	if err != nil {
+		return &CacheError{Path: fileName, Err: err}
+	}
+
+	return b.MergeData(r)
 }
 
-func (b *Bifrost) WriteBifrostData(fileName string) {
+func (b *Bifrost) WriteBifrostData(fileName string) error {
 	// create directory if not exists
 	directory := filepath.Dir(fileName)
 	err := os.MkdirAll(directory, os.ModePerm)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	f, err := os.Create(fileName)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer f.Close()
 
 	write, err := zstd.NewWriter(f)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer write.Flush()
-	defer write.Close()
 
 	encoder := json.NewEncoder(write)
 	err = encoder.Encode(b.Data)
 	if err != nil {
-		panic(err)
+		write.Close()
+		return err
 	}
+
+	return write.Close()
 }
@@ -10,6 +10,10 @@ import (
 func (b *Bifrost) ConnectStopsToVertices() {
 	t := time.Now()
 
+	if b.Data.WalkableVertexTree == nil {
+		b.Data.RebuildVertexTree() // not built yet, if there is no street graph
+	}
+
 	fmt.Println("Building kd-tree took", time.Since(t))
 
 	t = time.Now()
@@ -32,7 +36,7 @@ func (b *Bifrost) ConnectStopsToVertices() {
 				break
 			}
 
-			dist := b.DistanceMs(&stop, streetVert, VehicleTypeWalking)
+			dist := distanceMs(&stop, streetVert, b.WalkingSpeed)
 
 			if dist > b.MaxStopsConnectionSeconds {
 				break
@@ -62,27 +66,39 @@ func (b *Bifrost) ConnectStopsToVertices() {
 	fmt.Println("Connecting stops to street graph took", time.Since(t))
 }
 
-func (b *Bifrost) MergeData(other *RoutingData) {
-	b.Data = MergeData(b.Data, other)
+func (b *Bifrost) MergeData(other *RoutingData) error {
+	merged, err := MergeData(b.Data, other)
+	if err != nil {
+		return err
+	}
+
+	b.Data = merged
+	return nil
 }
 
 // MergeData merges two RoutingData structs. It only concatenates the vertices and edges. Use ConnectStopsToVertices
 // to connect stops to the street graph. IMPORTANT: This algorithm may change and re-use the data from both structs.
-// Also note, that using multiple transit feeds may break things like the stops index due to duplicate stop ids.
-// Multiple street graphs are not supported as there is no way of connecting them.
-// todo: fix stops index for multiple transit feeds
-// todo: add support for multiple street graphs
-func MergeData(a *RoutingData, b *RoutingData) *RoutingData {
+// Transit feeds need distinct feed ids (see AddGtfs), otherwise duplicate stop ids break the stops index.
+// Street graphs are only concatenated. To combine multiple OSM extracts into one connected street graph, add them with
+// AddOSM, which deduplicates their common segments.
+func MergeData(a *RoutingData, b *RoutingData) (*RoutingData, error) {
 	if a == nil {
-		return b
+		return b, nil
 	}
 
 	if b == nil {
-		return a
+		return a, nil
 	}
 
-	a.EnsureSliceLengths()
-	b.EnsureSliceLengths()
+	err := a.EnsureSliceLengths()
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.EnsureSliceLengths()
+	if err != nil {
+		return nil, err
+	}
 
 	maxTripDayLength := a.MaxTripDayLength
 	if b.MaxTripDayLength > maxTripDayLength {
@@ -94,43 +110,52 @@ func MergeData(a *RoutingData, b *RoutingData) *RoutingData {
 	bRouteOffset := uint32(len(a.Routes))
 	bServiceOffset := uint32(len(a.Services))
 	bGtfsRouteOffset := uint32(len(a.RouteInformation))
+	bTimezoneOffset := uint32(len(a.Timezones))
 
 	result := &RoutingData{
 		MaxTripDayLength: maxTripDayLength,
-		Services:         append(a.Services, b.Services...),
+		Services:         mergeServices(a.Services, b.Services, bTimezoneOffset),
+		Timezones:        append(a.Timezones, b.Timezones...),
 		Routes:           mergeRoutes(a.Routes, b.Routes, bVertexOffset, bTripOffset),
 		StopToRoutes:     mergeStopToRoutes(a.StopToRoutes, b.StopToRoutes, bRouteOffset),
 		Trips:            mergeTrips(a.Trips, b.Trips, bServiceOffset),
 		StreetGraph:      mergeStreetGraph(a.StreetGraph, b.StreetGraph, bVertexOffset),
 		Reorders:         mergeReorders(a.Reorders, b.Reorders, bRouteOffset),
-		Vertices:         append(a.Vertices, b.Vertices...),
+		Vertices:         mergeVertices(a.Vertices, b.Vertices, bTimezoneOffset),
 		StopsIndex:       mergeStopsIndex(a.StopsIndex, b.StopsIndex, bVertexOffset),
 		NodesIndex:       mergeNodesIndex(a.NodesIndex, b.NodesIndex, bVertexOffset),
 		GtfsRouteIndex:   mergeGtfsRouteIndex(a.GtfsRouteIndex, b.GtfsRouteIndex, bGtfsRouteOffset),
 		RouteInformation: append(a.RouteInformation, b.RouteInformation...),
 		TripInformation:  append(a.TripInformation, b.TripInformation...),
 		TripToRoute:      mergeTripToRoute(a.TripToRoute, b.TripToRoute, bRouteOffset),
+		Transfers:        mergeTransfers(a.Transfers, b.Transfers, bVertexOffset, bGtfsRouteOffset, bTripOffset),
+		BlockNext:        mergeBlocks(a.BlockNext, b.BlockNext, bTripOffset),
+		BlockPrevious:    mergeBlocks(a.BlockPrevious, b.BlockPrevious, bTripOffset),
+		Parkings:         mergeParkings(a.Parkings, b.Parkings, bVertexOffset),
+		SharingStations:  mergeSharingStations(a.SharingStations, b.SharingStations, bVertexOffset),
 	}
 
 	result.RebuildVertexTree()
 
-	return result
+	return result, nil
 }
 
-func (r *RoutingData) EnsureSliceLengths() {
+// EnsureSliceLengths creates the slices indexed by vertex, route or trip, if they are empty. Returns an error, if they
+// have another length, which only happens with routing data built incorrectly or a corrupt cache.
+func (r *RoutingData) EnsureSliceLengths() error {
 	vertexCount := len(r.Vertices)
 	if len(r.StopToRoutes) == 0 {
 		r.StopToRoutes = make([][]StopRoutePair, vertexCount)
 	}
 	if len(r.StopToRoutes) != vertexCount {
-		panic(fmt.Sprintf("stop to routes length mismatch: %d != %d", len(r.StopToRoutes), vertexCount))
+		return fmt.Errorf("stop to routes length mismatch: %d != %d", len(r.StopToRoutes), vertexCount)
 	}
 
 	if len(r.StreetGraph) == 0 {
 		r.StreetGraph = make([][]Arc, vertexCount)
 	}
 	if len(r.StreetGraph) != vertexCount {
-		panic(fmt.Sprintf("street graph length mismatch: %d != %d", len(r.StreetGraph), vertexCount))
+		return fmt.Errorf("street graph length mismatch: %d != %d", len(r.StreetGraph), vertexCount)
 	}
 
 	routeCount := len(r.Routes)
@@ -138,7 +163,7 @@ func (r *RoutingData) EnsureSliceLengths() {
 		r.GtfsRouteIndex = make([]uint32, routeCount)
 	}
 	if len(r.GtfsRouteIndex) != routeCount {
-		panic(fmt.Sprintf("gtfs route index length mismatch: %d != %d", len(r.GtfsRouteIndex), routeCount))
+		return fmt.Errorf("gtfs route index length mismatch: %d != %d", len(r.GtfsRouteIndex), routeCount)
 	}
 
 	tripCount := len(r.Trips)
@@ -146,8 +171,21 @@ func (r *RoutingData) EnsureSliceLengths() {
 		r.TripToRoute = make([]uint32, tripCount)
 	}
 	if len(r.TripToRoute) != tripCount {
-		panic(fmt.Sprintf("trip to route length mismatch: %d != %d", len(r.TripToRoute), tripCount))
+		return fmt.Errorf("trip to route length mismatch: %d != %d", len(r.TripToRoute), tripCount)
 	}
+
+	return nil
+}
+
+func mergeVertices(a []Vertex, b []Vertex, bTimezoneOffset uint32) []Vertex {
+	// shift all feeds in b, which are indexed like their timezones
+	for _, vertex := range b {
+		if vertex.Stop != nil {
+			vertex.Stop.Feed += bTimezoneOffset
+		}
+	}
+
+	return append(a, b...)
 }
 
 func mergeRoutes(a []*Route, b []*Route, bVertexOffset uint64, bTripOffset uint32) []*Route {
@@ -185,10 +223,10 @@ func mergeStopToRoutes(a [][]StopRoutePair, b [][]StopRoutePair, bRouteOffset ui
 		return a
 	}
 
-	// shift all trips and routes in b
+	// shift all routes in b
 	for _, stopToRoutes := range b {
-		for _, stopRoutePair := range stopToRoutes {
-			stopRoutePair.Route += bRouteOffset
+		for i := range stopToRoutes {
+			stopToRoutes[i].Route += bRouteOffset
 			// StopKeyInRoute not shifted
 		}
 	}
@@ -200,6 +238,15 @@ func mergeStopToRoutes(a [][]StopRoutePair, b [][]StopRoutePair, bRouteOffset ui
 	return stopToRoutes
 }
 
+func mergeServices(a []*Service, b []*Service, bTimezoneOffset uint32) []*Service {
+	// shift all timezones in b
+	for _, service := range b {
+		service.Timezone += bTimezoneOffset
+	}
+
+	return append(a, b...)
+}
+
 func mergeTrips(a []*Trip, b []*Trip, bServiceOffset uint32) []*Trip {
 	if len(a) == 0 {
 		return b
@@ -233,8 +280,8 @@ func mergeStreetGraph(a [][]Arc, b [][]Arc, bVertexOffset uint64) [][]Arc {
 
 	// shift all vertices in b
 	for _, arcs := range b {
-		for _, arc := range arcs {
-			arc.Target += bVertexOffset
+		for i := range arcs {
+			arcs[i].Target += bVertexOffset
 		}
 	}
 
@@ -286,7 +333,7 @@ func mergeStopsIndex(a, b map[string]uint64, bVertexOffset uint64) map[string]ui
 	return a
 }
 
-func mergeNodesIndex(a, b map[int64]uint64, bVertexOffset uint64) map[int64]uint64 {
+func mergeNodesIndex(a, b map[OsmSegment]uint64, bVertexOffset uint64) map[OsmSegment]uint64 {
 	if len(a) == 0 {
 		return b
 	}
@@ -311,8 +358,8 @@ func mergeGtfsRouteIndex(a, b []uint32, bGtfsRouteOffset uint32) []uint32 {
 		return a
 	}
 
-	for i, v := range b {
-		a[i] = v + bGtfsRouteOffset
+	for _, v := range b {
+		a = append(a, v+bGtfsRouteOffset)
 	}
 
 	return a
@@ -327,8 +374,87 @@ func mergeTripToRoute(a, b []uint32, bRouteOffset uint32) []uint32 {
 		return a
 	}
 
-	for i, v := range b {
-		a[i] = v + bRouteOffset
+	for _, v := range b {
+		a = append(a, v+bRouteOffset)
+	}
+
+	return a
+}
+
+func mergeTransfers(a, b map[uint64][]TransferRule, bVertexOffset uint64, bGtfsRouteOffset uint32, bTripOffset uint32) map[uint64][]TransferRule {
+	if len(b) == 0 {
+		return a
+	}
+
+	if a == nil {
+		a = make(map[uint64][]TransferRule, len(b))
+	}
+
+	shift := func(key uint32, offset uint32) uint32 {
+		if key == TransferAny {
+			return key
+		}
+		return key + offset
+	}
+
+	for k, rules := range b {
+		for i := range rules {
+			rules[i].FromStop += bVertexOffset
+			rules[i].FromRoute = shift(rules[i].FromRoute, bGtfsRouteOffset)
+			rules[i].ToRoute = shift(rules[i].ToRoute, bGtfsRouteOffset)
+			rules[i].FromTrip = shift(rules[i].FromTrip, bTripOffset)
+			rules[i].ToTrip = shift(rules[i].ToTrip, bTripOffset)
+		}
+
+		a[k+bVertexOffset] = rules // write to a, so a contains the merged transfers
+	}
+
+	return a
+}
+
+func mergeBlocks(a, b map[uint32]uint32, bTripOffset uint32) map[uint32]uint32 {
+	if len(b) == 0 {
+		return a
+	}
+
+	if a == nil {
+		a = make(map[uint32]uint32, len(b))
+	}
+
+	for k, v := range b {
+		a[k+bTripOffset] = v + bTripOffset
+	}
+
+	return a
+}
+
+func mergeParkings(a, b map[uint64]uint8, bVertexOffset uint64) map[uint64]uint8 {
+	if len(b) == 0 {
+		return a
+	}
+
+	if a == nil {
+		a = make(map[uint64]uint8, len(b))
+	}
+
+	for k, v := range b {
+		a[k+bVertexOffset] |= v
+	}
+
+	return a
+}
+
+func mergeSharingStations(a, b map[uint64]*SharingStation, bVertexOffset uint64) map[uint64]*SharingStation {
+	if len(b) == 0 {
+		return a
+	}
+
+	if a == nil {
+		a = make(map[uint64]*SharingStation, len(b))
+	}
+
+	for k, v := range b {
+		a[k+bVertexOffset] = v
 	}
 
 	return a
@@ -0,0 +1,122 @@
+package bifrost
+
+import "github.com/Vector-Hector/fptf"
+
+// TransitMode is a bitmask of the transit modes a route can have or a query may use.
+type TransitMode uint8
+
+const (
+	TransitModeTrain TransitMode = 1 << iota
+	TransitModeBus
+	TransitModeWatercraft
+	TransitModeTaxi
+	TransitModeGondola
+	TransitModeAircraft
+)
+
+const TransitModeAll = TransitModeTrain | TransitModeBus | TransitModeWatercraft | TransitModeTaxi | TransitModeGondola | TransitModeAircraft
+
+// ModeTransit contains all transit modes, accessed by foot.
+var ModeTransit = []fptf.Mode{
+	fptf.ModeTrain,
+	fptf.ModeBus,
+	fptf.ModeWatercraft,
+	fptf.ModeTaxi,
+	fptf.ModeGondola,
+	fptf.ModeAircraft,
+}
+
+// ModeKissAndRide and ModeTaxiAccess may be passed next to transit modes instead of fptf.ModeCar. The traveller is then
+// dropped off near the first stop and picked up near the last stop, or takes a taxi there, instead of parking the car.
+// These drives are returned as car legs, taxi rides with the sub mode taxi.
+const (
+	ModeKissAndRide fptf.Mode = "kissAndRide"
+	ModeTaxiAccess  fptf.Mode = "taxiAccess"
+)
+
+// getTransitModes returns the transit modes contained in modes.
+func getTransitModes(modes []fptf.Mode) TransitMode {
+	transitModes := TransitMode(0)
+
+	for _, mode := range modes {
+		transitModes |= transitModeOf(mode)
+	}
+
+	return transitModes
+}
+
+// transitModeOf returns the transit mode of a fptf mode or 0 for street modes.
+func transitModeOf(mode fptf.Mode) TransitMode {
+	switch mode {
+	case fptf.ModeTrain:
+		return TransitModeTrain
+	case fptf.ModeBus:
+		return TransitModeBus
+	case fptf.ModeWatercraft:
+		return TransitModeWatercraft
+	case fptf.ModeTaxi:
+		return TransitModeTaxi
+	case fptf.ModeGondola:
+		return TransitModeGondola
+	case fptf.ModeAircraft:
+		return TransitModeAircraft
+	default:
+		return 0
+	}
+}
+
+// routeTypeMode converts a GTFS route_type, including the extended route types, to a fptf mode and sub mode.
+// See https://developers.google.com/transit/gtfs/reference/extended-route-types
+func routeTypeMode(routeType int) (fptf.Mode, string) {
+	switch routeType {
+	case 0:
+		return fptf.ModeTrain, "tram"
+	case 1:
+		return fptf.ModeTrain, "subway"
+	case 2:
+		return fptf.ModeTrain, "rail"
+	case 3:
+		return fptf.ModeBus, "bus"
+	case 4:
+		return fptf.ModeWatercraft, "ferry"
+	case 5:
+		return fptf.ModeTrain, "cable tram"
+	case 6:
+		return fptf.ModeGondola, "aerial lift"
+	case 7:
+		return fptf.ModeTrain, "funicular"
+	case 11:
+		return fptf.ModeBus, "trolleybus"
+	case 12:
+		return fptf.ModeTrain, "monorail"
+	}
+
+	switch {
+	case routeType >= 100 && routeType < 200:
+		return fptf.ModeTrain, "rail"
+	case routeType >= 200 && routeType < 300:
+		return fptf.ModeBus, "coach"
+	case routeType >= 400 && routeType < 500:
+		return fptf.ModeTrain, "subway"
+	case routeType >= 700 && routeType < 800:
+		return fptf.ModeBus, "bus"
+	case routeType >= 800 && routeType < 900:
+		return fptf.ModeBus, "trolleybus"
+	case routeType >= 900 && routeType < 1000:
+		return fptf.ModeTrain, "tram"
+	case routeType >= 1000 && routeType < 1100:
+		return fptf.ModeWatercraft, "ferry"
+	case routeType >= 1100 && routeType < 1200:
+		return fptf.ModeAircraft, "air"
+	case routeType >= 1200 && routeType < 1300:
+		return fptf.ModeWatercraft, "ferry"
+	case routeType >= 1300 && routeType < 1400:
+		return fptf.ModeGondola, "aerial lift"
+	case routeType >= 1400 && routeType < 1500:
+		return fptf.ModeTrain, "funicular"
+	case routeType >= 1500 && routeType < 1600:
+		return fptf.ModeTaxi, "taxi"
+	default:
+		return fptf.ModeBus, ""
+	}
+}
@@ -0,0 +1,42 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"testing"
+)
+
+func TestRouteTypeMode(t *testing.T) {
+	cases := []struct {
+		routeType int
+		mode      fptf.Mode
+		subMode   string
+	}{
+		{0, fptf.ModeTrain, "tram"},
+		{1, fptf.ModeTrain, "subway"},
+		{3, fptf.ModeBus, "bus"},
+		{4, fptf.ModeWatercraft, "ferry"},
+		{109, fptf.ModeTrain, "rail"},
+		{700, fptf.ModeBus, "bus"},
+		{900, fptf.ModeTrain, "tram"},
+		{1300, fptf.ModeGondola, "aerial lift"},
+	}
+
+	for _, c := range cases {
+		mode, subMode := routeTypeMode(c.routeType)
+		if mode != c.mode || subMode != c.subMode {
+			t.Errorf("route type %d: expected %s/%s, got %s/%s", c.routeType, c.mode, c.subMode, mode, subMode)
+		}
+	}
+}
+
+func TestRouteAllowed(t *testing.T) {
+	rounds := &Rounds{TransitModes: getTransitModes([]fptf.Mode{fptf.ModeBus, fptf.ModeWalking})}
+
+	if !rounds.routeAllowed(&Route{Mode: TransitModeBus}) {
+		t.Error("expected bus route to be allowed")
+	}
+
+	if rounds.routeAllowed(&Route{Mode: TransitModeTrain}) {
+		t.Error("expected train route not to be allowed")
+	}
+}
@@ -3,6 +3,7 @@ package bifrost
 import (
 	"fmt"
 	"github.com/LdDl/osm2ch"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -125,6 +126,50 @@ var osmCfg = &osm2ch.OsmConfiguration{
 	Tags:       buildTags(),
 }
 
+// OsmSegment is a directed part of an OSM way between two OSM nodes, that are junctions or way ends. Each segment is a
+// vertex of the street graph located at its middle, as the graph is expanded to allow turn restrictions. Segments are
+// identified by their OSM node ids, so the same segment of overlapping extracts is the same vertex.
+type OsmSegment struct {
+	Source int64 // osm node id
+	Target int64 // osm node id
+}
+
+func (s OsmSegment) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(s.Source, 10) + "," + strconv.FormatInt(s.Target, 10)), nil
+}
+
+func (s *OsmSegment) UnmarshalText(text []byte) error {
+	source, target, ok := strings.Cut(string(text), ",")
+	if !ok {
+		return fmt.Errorf("invalid osm segment %q, the bifrost cache may be outdated", text)
+	}
+
+	var err error
+
+	s.Source, err = strconv.ParseInt(source, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid osm segment %q: %w", text, err)
+	}
+
+	s.Target, err = strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid osm segment %q: %w", text, err)
+	}
+
+	return nil
+}
+
+func componentSegment(component *osm2ch.ExpandedEdgeComponent) OsmSegment {
+	return OsmSegment{
+		Source: int64(component.SourceNodeID),
+		Target: int64(component.TargetNodeID),
+	}
+}
+
+// AddOSM adds the street graph of an OSM pbf file. It can be called for multiple extracts, e.g. of neighbouring
+// states. Segments, that are part of multiple extracts, are added once and extracts are connected at their common OSM
+// nodes, see OsmSegment. Extracts should contain the ways crossing their border completely (the default of osmium
+// extract) or overlap, otherwise they are only connected at nodes, that are included in both.
 func (b *Bifrost) AddOSM(path string) error {
 	t := time.Now()
 
@@ -137,54 +182,76 @@ func (b *Bifrost) AddOSM(path string) error {
 
 	fmt.Println("Found", len(edges), "edges")
 
-	if b.Data == nil {
-		b.Data = &RoutingData{}
+	fmt.Println("Converting edges to bifrost street graph format")
+
+	b.addStreetEdges(edges)
+
+	b.Data.RebuildVertexTree()
+
+	err = b.addParkingFacilities(path)
+	if err != nil {
+		return err
 	}
 
-	lastVertex := uint64(len(b.Data.Vertices))
+	fmt.Println("Done reading OSM data.")
+	fmt.Println("Reading OSM data took", time.Since(t))
 
-	fmt.Println("Converting edges to bifrost street graph format")
+	return nil
+}
+
+// addStreetEdges adds the expanded edges of an OSM extract to the street graph. Vertices of segments, that are
+// already known from a previous extract, are reused. Arcs, that already exist, are not added again.
+func (b *Bifrost) addStreetEdges(edges []osm2ch.ExpandedEdge) {
+	if b.Data == nil {
+		b.Data = &RoutingData{}
+	}
 
 	if b.Data.NodesIndex == nil {
-		b.Data.NodesIndex = make(map[int64]uint64)
+		b.Data.NodesIndex = make(map[OsmSegment]uint64)
 	}
 
 	if b.Data.StreetGraph == nil {
 		b.Data.StreetGraph = make([][]Arc, len(b.Data.Vertices))
 	}
 
+	firstNewVertex := uint64(len(b.Data.Vertices))
+	previousExtracts := len(b.Data.NodesIndex) > 0
+
+	// tags of the segments added by this extract, used to connect them to the segments of previous extracts
+	newComponents := make(map[uint64]*osm2ch.ExpandedEdgeComponent)
+
+	getVertex := func(component *osm2ch.ExpandedEdgeComponent, point osm2ch.GeoPoint) uint64 {
+		segment := componentSegment(component)
+
+		vertKey, ok := b.Data.NodesIndex[segment]
+		if ok {
+			return vertKey
+		}
+
+		vertKey = uint64(len(b.Data.Vertices))
+		b.Data.NodesIndex[segment] = vertKey
+		b.Data.Vertices = append(b.Data.Vertices, Vertex{
+			Latitude:  point.Lat,
+			Longitude: point.Lon,
+		})
+		b.Data.StreetGraph = append(b.Data.StreetGraph, make([]Arc, 0))
+		b.Data.StopToRoutes = append(b.Data.StopToRoutes, nil)
+		newComponents[vertKey] = component
+
+		return vertKey
+	}
+
 	prog := Progress{}
 	prog.Reset(uint64(len(edges)))
 
-	for _, edge := range edges {
+	for i := range edges {
 		prog.Increment()
 		prog.Print()
 
-		sourceVertKey, ok := b.Data.NodesIndex[int64(edge.Source)]
-		if !ok {
-			b.Data.NodesIndex[int64(edge.Source)] = lastVertex
-			b.Data.Vertices = append(b.Data.Vertices, Vertex{
-				Latitude:  edge.Geom[0].Lat,
-				Longitude: edge.Geom[0].Lon,
-			})
-			b.Data.StreetGraph = append(b.Data.StreetGraph, make([]Arc, 0))
-			b.Data.StopToRoutes = append(b.Data.StopToRoutes, nil)
-			sourceVertKey = lastVertex
-			lastVertex++
-		}
+		edge := &edges[i]
 
-		targetVertKey, ok := b.Data.NodesIndex[int64(edge.Target)]
-		if !ok {
-			b.Data.NodesIndex[int64(edge.Target)] = lastVertex
-			b.Data.Vertices = append(b.Data.Vertices, Vertex{
-				Latitude:  edge.Geom[len(edge.Geom)-1].Lat,
-				Longitude: edge.Geom[len(edge.Geom)-1].Lon,
-			})
-			b.Data.StreetGraph = append(b.Data.StreetGraph, make([]Arc, 0))
-			b.Data.StopToRoutes = append(b.Data.StopToRoutes, nil)
-			targetVertKey = lastVertex
-			lastVertex++
-		}
+		sourceVertKey := getVertex(&edge.SourceComponent, edge.Geom[0])
+		targetVertKey := getVertex(&edge.TargetComponent, edge.Geom[len(edge.Geom)-1])
 
 		sourceDesc := b.getWayDescriptor(&edge.SourceComponent)
 		targetDesc := b.getWayDescriptor(&edge.TargetComponent)
@@ -195,35 +262,107 @@ func (b *Bifrost) AddOSM(path string) error {
 
 		merged := sourceDesc.Merge(targetDesc)
 
-		b.Data.StreetGraph[sourceVertKey] = append(b.Data.StreetGraph[sourceVertKey], Arc{
-			Target:        targetVertKey,
-			WalkDistance:  merged.WalkMs,
-			CycleDistance: merged.CycleMs,
-			CarDistance:   merged.CarMs,
-		})
+		b.addStreetArc(sourceVertKey, targetVertKey, merged, firstNewVertex)
 
 		if edge.WasOneway && merged.WalkMs > 0 {
-			b.Data.StreetGraph[targetVertKey] = append(b.Data.StreetGraph[targetVertKey], Arc{
-				Target:        sourceVertKey,
-				WalkDistance:  merged.WalkMs,
-				CycleDistance: merged.CycleMs,
-				CarDistance:   merged.CarMs,
-			}) // walkers can walk both ways
+			b.addStreetArc(targetVertKey, sourceVertKey, merged, firstNewVertex) // walkers can walk both ways
 		}
 	}
 
-	b.Data.RebuildVertexTree()
+	if previousExtracts {
+		b.connectExtracts(firstNewVertex, newComponents)
+	}
+}
 
-	fmt.Println("Done reading OSM data.")
-	fmt.Println("Reading OSM data took", time.Since(t))
+// addStreetArc adds an arc for the way descriptor. Arcs between vertices of previous extracts are skipped, if they
+// exist already.
+func (b *Bifrost) addStreetArc(from uint64, to uint64, desc *wayDescriptor, firstNewVertex uint64) {
+	if from < firstNewVertex && to < firstNewVertex && b.hasStreetArc(from, to) {
+		return
+	}
 
-	return nil
+	b.Data.StreetGraph[from] = append(b.Data.StreetGraph[from], Arc{
+		Target:        to,
+		WalkDistance:  desc.WalkMs,
+		CycleDistance: desc.CycleMs,
+		CarDistance:   desc.CarMs,
+		Inaccessible:  desc.Inaccessible,
+	})
+}
+
+// connectExtracts connects the segments added by an extract to the segments of previous extracts, that end or start
+// at the same OSM node. The extracts only know the turns between their own segments, so these arcs are missing where a
+// way leaves one of them. The tags of the new segment are used for the arc, its length is approximated by the
+// straight distance between both segments.
+func (b *Bifrost) connectExtracts(firstNewVertex uint64, newComponents map[uint64]*osm2ch.ExpandedEdgeComponent) {
+	endingAt := make(map[int64][]OsmSegment)
+	startingAt := make(map[int64][]OsmSegment)
+
+	for segment := range b.Data.NodesIndex {
+		endingAt[segment.Target] = append(endingAt[segment.Target], segment)
+		startingAt[segment.Source] = append(startingAt[segment.Source], segment)
+	}
+
+	connected := 0
+
+	for node, incoming := range endingAt {
+		for _, from := range incoming {
+			for _, to := range startingAt[node] {
+				if from.Source == to.Target {
+					continue // u-turn
+				}
+
+				fromKey := b.Data.NodesIndex[from]
+				toKey := b.Data.NodesIndex[to]
+
+				if (fromKey < firstNewVertex) == (toKey < firstNewVertex) {
+					continue // both segments are of the same extract or were connected by both
+				}
+
+				if b.hasStreetArc(fromKey, toKey) {
+					continue
+				}
+
+				component := newComponents[fromKey]
+				if component == nil {
+					component = newComponents[toKey]
+				}
+
+				fromVert := &b.Data.Vertices[fromKey]
+				toVert := &b.Data.Vertices[toKey]
+
+				desc := b.getWayDescriptor(&osm2ch.ExpandedEdgeComponent{
+					Tags:       component.Tags,
+					CostMeters: Distance(fromVert.Latitude, fromVert.Longitude, toVert.Latitude, toVert.Longitude, "K") * 1000,
+				})
+				if desc == nil {
+					continue
+				}
+
+				b.addStreetArc(fromKey, toKey, desc, firstNewVertex)
+				connected++
+			}
+		}
+	}
+
+	fmt.Println("Connected", connected, "segments to previous extracts")
+}
+
+func (b *Bifrost) hasStreetArc(from uint64, to uint64) bool {
+	for _, arc := range b.Data.StreetGraph[from] {
+		if arc.Target == to {
+			return true
+		}
+	}
+
+	return false
 }
 
 type wayDescriptor struct {
-	WalkMs  uint32
-	CycleMs uint32
-	CarMs   uint32
+	WalkMs       uint32
+	CycleMs      uint32
+	CarMs        uint32
+	Inaccessible bool // not usable with a wheelchair
 }
 
 func (w *wayDescriptor) Merge(v *wayDescriptor) *wayDescriptor {
@@ -243,9 +382,10 @@ func (w *wayDescriptor) Merge(v *wayDescriptor) *wayDescriptor {
 	}
 
 	return &wayDescriptor{
-		WalkMs:  walk,
-		CycleMs: cycle,
-		CarMs:   car,
+		WalkMs:       walk,
+		CycleMs:      cycle,
+		CarMs:        car,
+		Inaccessible: w.Inaccessible || v.Inaccessible,
 	}
 }
 
@@ -265,12 +405,71 @@ func (b *Bifrost) getWayDescriptor(edge *osm2ch.ExpandedEdgeComponent) *wayDescr
 	}
 
 	return &wayDescriptor{
-		WalkMs:  b.getWalk(edge, highwayTagValue),
-		CycleMs: b.getCycle(edge, highwayTagValue),
-		CarMs:   b.getCar(edge, highwayTagValue),
+		WalkMs:       b.getWalk(edge, highwayTagValue),
+		CycleMs:      b.getCycle(edge, highwayTagValue),
+		CarMs:        b.getCar(edge, highwayTagValue),
+		Inaccessible: isWheelchairInaccessible(edge, highwayTagValue),
 	}
 }
 
+// maximum incline in percent, that is considered usable with a wheelchair
+const maxWheelchairIncline = 6.0
+
+// isWheelchairInaccessible returns true, if the edge is tagged as not usable with a wheelchair or has steps, high
+// kerbs or a steep incline. An explicit wheelchair tag overrides the other tags.
+func isWheelchairInaccessible(edge *osm2ch.ExpandedEdgeComponent, highwayTagValue string) bool {
+	inaccessible := highwayTagValue == "steps"
+
+	for _, tag := range edge.Tags {
+		switch tag.Key {
+		case "wheelchair":
+			return tag.Value == "no"
+		case "kerb":
+			if tag.Value == "raised" || tag.Value == "regular" || tag.Value == "yes" {
+				inaccessible = true
+			}
+		case "incline":
+			incline, ok := parseIncline(tag.Value)
+			if ok && math.Abs(incline) > maxWheelchairIncline {
+				inaccessible = true
+			}
+		}
+	}
+
+	return inaccessible
+}
+
+// parseIncline parses an incline tag in percent or degrees and returns it in percent. Values like "up" are not
+// supported.
+func parseIncline(incline string) (float64, bool) {
+	incline = strings.TrimSpace(incline)
+
+	if strings.HasSuffix(incline, "%") {
+		num, err := strconv.ParseFloat(strings.TrimSpace(incline[:len(incline)-1]), 64)
+		if err != nil {
+			return 0, false
+		}
+
+		return num, true
+	}
+
+	if strings.HasSuffix(incline, "°") {
+		num, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(incline, "°")), 64)
+		if err != nil {
+			return 0, false
+		}
+
+		return math.Tan(num*math.Pi/180) * 100, true
+	}
+
+	num, err := strconv.ParseFloat(incline, 64) // default is percent
+	if err != nil {
+		return 0, false
+	}
+
+	return num, true
+}
+
 // isWalk returns true if the edge can be walked.
 func (b *Bifrost) isWalk(edge *osm2ch.ExpandedEdgeComponent, highwayTagValue string) bool {
 	if _, ok := footTagSet[highwayTagValue]; ok {
@@ -0,0 +1,78 @@
+package bifrost
+
+import (
+	"encoding/json"
+	"github.com/LdDl/osm2ch"
+	"github.com/paulmach/osm"
+	"testing"
+)
+
+// testTurn returns the expanded edge of a turn from the segment a -> b to the segment b -> c of residential ways. Node
+// n is located at latitude n/1000.
+func testTurn(a, b, c int64) osm2ch.ExpandedEdge {
+	tags := osm.Tags{{Key: "highway", Value: "residential"}}
+	middle := func(from, to int64) osm2ch.GeoPoint {
+		return osm2ch.GeoPoint{Lat: float64(from+to) / 2000}
+	}
+
+	return osm2ch.ExpandedEdge{
+		SourceComponent: osm2ch.ExpandedEdgeComponent{SourceNodeID: osm.NodeID(a), TargetNodeID: osm.NodeID(b), Tags: tags, CostMeters: 55},
+		TargetComponent: osm2ch.ExpandedEdgeComponent{SourceNodeID: osm.NodeID(b), TargetNodeID: osm.NodeID(c), Tags: tags, CostMeters: 55},
+		Geom:            []osm2ch.GeoPoint{middle(a, b), middle(b, c)},
+	}
+}
+
+func TestAddOSMExtracts(t *testing.T) {
+	b := *DefaultBifrost
+	b.Data = nil
+
+	// the first two extracts overlap at the segment 2 - 3, the third one only shares node 4 with the second one
+	b.addStreetEdges([]osm2ch.ExpandedEdge{testTurn(1, 2, 3), testTurn(3, 2, 1)})
+	b.addStreetEdges([]osm2ch.ExpandedEdge{testTurn(2, 3, 4), testTurn(4, 3, 2)})
+	b.addStreetEdges([]osm2ch.ExpandedEdge{testTurn(4, 5, 6), testTurn(6, 5, 4)})
+
+	if len(b.Data.Vertices) != 10 {
+		t.Fatalf("expected 10 segment vertices, got %d", len(b.Data.Vertices))
+	}
+
+	vertex := func(source, target int64) uint64 {
+		key, ok := b.Data.NodesIndex[OsmSegment{Source: source, Target: target}]
+		if !ok {
+			t.Fatalf("missing segment %d -> %d", source, target)
+		}
+		return key
+	}
+
+	path := [][2]int64{{1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 6}}
+	for i := 1; i < len(path); i++ {
+		from := vertex(path[i-1][0], path[i-1][1])
+		to := vertex(path[i][0], path[i][1])
+
+		arcs := 0
+		for _, arc := range b.Data.StreetGraph[from] {
+			if arc.Target == to && arc.WalkDistance > 0 {
+				arcs++
+			}
+		}
+
+		if arcs != 1 {
+			t.Fatalf("expected one arc from %v to %v, got %d", path[i-1], path[i], arcs)
+		}
+
+		back := vertex(path[i][1], path[i][0])
+		if !b.hasStreetArc(back, vertex(path[i-1][1], path[i-1][0])) {
+			t.Fatalf("expected an arc back from %v", path[i])
+		}
+	}
+
+	encoded, err := json.Marshal(b.Data.NodesIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := make(map[OsmSegment]uint64)
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil || len(decoded) != len(b.Data.NodesIndex) || decoded[OsmSegment{Source: 4, Target: 5}] != vertex(4, 5) {
+		t.Fatalf("expected the nodes index to survive the bifrost cache, got %v (%v)", decoded, err)
+	}
+}
@@ -0,0 +1,189 @@
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"io"
+	"os"
+)
+
+// parkingFacility is a park and ride or bicycle parking facility read from OSM.
+type parkingFacility struct {
+	Latitude  float64
+	Longitude float64
+	Vehicles  uint8 // bitmask of vehicles, that can be parked
+}
+
+// parkingVehicles returns the bitmask of vehicles, that can be parked at a facility with the given tags. Car parkings
+// are only used, if they are tagged as park and ride.
+func parkingVehicles(tags osm.Tags) uint8 {
+	switch tags.Find("amenity") {
+	case "parking":
+		parkRide := tags.Find("park_ride")
+		if parkRide == "" || parkRide == "no" {
+			return 0
+		}
+
+		return 1 << VehicleTypeCar
+	case "bicycle_parking":
+		return 1 << VehicleTypeBicycle
+	default:
+		return 0
+	}
+}
+
+// readParkingFacilities reads the park and ride and bicycle parking facilities of an OSM pbf file. Facilities mapped
+// as ways are located at the center of their nodes. Multipolygon relations are not supported.
+func readParkingFacilities(path string) ([]parkingFacility, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	facilities := make([]parkingFacility, 0)
+	ways := make([]*osm.Way, 0)
+	wayNodes := make(map[osm.NodeID]*osm.Node)
+
+	scanner := osmpbf.New(context.Background(), f, 4)
+	scanner.SkipRelations = true
+
+	for scanner.Scan() {
+		switch obj := scanner.Object().(type) {
+		case *osm.Node:
+			vehicles := parkingVehicles(obj.Tags)
+			if vehicles == 0 {
+				continue
+			}
+
+			facilities = append(facilities, parkingFacility{
+				Latitude:  obj.Lat,
+				Longitude: obj.Lon,
+				Vehicles:  vehicles,
+			})
+		case *osm.Way:
+			if parkingVehicles(obj.Tags) == 0 {
+				continue
+			}
+
+			ways = append(ways, obj)
+			for _, node := range obj.Nodes {
+				wayNodes[node.ID] = nil
+			}
+		}
+	}
+
+	err = scanner.Err()
+	scanner.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ways) == 0 {
+		return facilities, nil
+	}
+
+	// nodes are stored before ways, so the nodes of the facility ways need a second pass
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner = osmpbf.New(context.Background(), f, 4)
+	defer scanner.Close()
+
+	scanner.SkipWays = true
+	scanner.SkipRelations = true
+
+	for scanner.Scan() {
+		node, ok := scanner.Object().(*osm.Node)
+		if !ok {
+			continue
+		}
+
+		if _, ok := wayNodes[node.ID]; ok {
+			wayNodes[node.ID] = node
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, way := range ways {
+		lat, lon, count := 0.0, 0.0, 0
+
+		for _, wayNode := range way.Nodes {
+			node := wayNodes[wayNode.ID]
+			if node == nil {
+				continue
+			}
+
+			lat += node.Lat
+			lon += node.Lon
+			count++
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		facilities = append(facilities, parkingFacility{
+			Latitude:  lat / float64(count),
+			Longitude: lon / float64(count),
+			Vehicles:  parkingVehicles(way.Tags),
+		})
+	}
+
+	return facilities, nil
+}
+
+// addParkingFacilities reads the parking facilities of an OSM pbf file and attaches each of them to the closest
+// street vertex, that can be reached by the parked vehicle. The vertex trees must be built.
+func (b *Bifrost) addParkingFacilities(path string) error {
+	facilities, err := readParkingFacilities(path)
+	if err != nil {
+		return err
+	}
+
+	if b.Data.Parkings == nil {
+		b.Data.Parkings = make(map[uint64]uint8)
+	}
+
+	for _, facility := range facilities {
+		loc := &GeoPoint{
+			Latitude:  facility.Latitude,
+			Longitude: facility.Longitude,
+		}
+
+		for _, vehicle := range []VehicleType{VehicleTypeCar, VehicleTypeBicycle} {
+			if facility.Vehicles&(1<<vehicle) == 0 {
+				continue
+			}
+
+			tree := b.Data.CarableVertexTree
+			if vehicle == VehicleTypeBicycle {
+				tree = b.Data.CycleableVertexTree
+			}
+
+			nearest := tree.KNN(loc, 1)
+			if len(nearest) == 0 {
+				continue
+			}
+
+			vertex := nearest[0].(*GeoPoint)
+
+			if !b.fastDistWithin(loc, vertex, b.MaxStopsConnectionSeconds) {
+				continue
+			}
+
+			b.Data.Parkings[vertex.VertKey] |= 1 << vehicle
+		}
+	}
+
+	fmt.Println("Found", len(facilities), "parking facilities")
+
+	return nil
+}
@@ -0,0 +1,343 @@
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+	"sort"
+	"time"
+)
+
+// RoutePareto finds all journeys from the origins to the destination, that are not beaten by another journey in both
+// arrival time and number of transfers. If WalkingCriterion is set, journeys with less walking are searched for as well and the walking time is used
+// as a third criterion. This is an approximation: the walking time is not a label of the search, instead the search
+// is repeated with MaxWalkingMs halved walkingCriterionSearches times, so journeys, that walk less only on some of
+// their legs, may be missed. The journeys are sorted by their number of transfers.
+func (b *Bifrost) RoutePareto(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) ([]*fptf.Journey, error) {
+	return b.routePareto(rounds, origins, dest, modes, false, debug)
+}
+
+// RouteParetoArriveBy is RoutePareto for journeys arriving at the destination before the departure time of the first
+// origin. The departure time is used instead of the arrival time as criterion then, see RouteArriveBy.
+func (b *Bifrost) RouteParetoArriveBy(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) ([]*fptf.Journey, error) {
+	return b.routePareto(rounds, origins, dest, modes, true, debug)
+}
+
+func (b *Bifrost) routePareto(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, arriveBy bool, debug bool) ([]*fptf.Journey, error) {
+	vehicleType, isTransit := getVehicleType(modes)
+	rounds.TransitModes = getTransitModes(modes)
+	rounds.Access = nil
+	rounds.Egress = nil
+
+	if !isTransit {
+		journey, err := b.route(rounds, origins, dest, modes, arriveBy, debug)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*fptf.Journey{journey}, nil
+	}
+
+	if b.takesBikeOnBoard(vehicleType) {
+		b = b.withBikeOnBoard()
+	}
+
+	if access := getCarAccess(modes); access != carAccessParkAndRide {
+		b = b.withCarAccess(access)
+	}
+
+	journeys, err := b.routeTransitPareto(rounds, origins, dest, vehicleType, arriveBy, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.WalkingCriterion {
+		// a search with a tighter walking limit may find journeys, that are slower, but need less walking
+		limited := *b
+
+		for i := 0; i < walkingCriterionSearches; i++ {
+			limited.MaxWalkingMs /= 2
+
+			more, err := limited.routeTransitPareto(rounds, origins, dest, vehicleType, arriveBy, debug)
+			if _, ok := err.(NoRouteError); ok {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			journeys = append(journeys, more...)
+		}
+
+		journeys = filterParetoJourneys(journeys, arriveBy)
+	}
+
+	sort.SliceStable(journeys, func(i, j int) bool {
+		return journeyTransfers(journeys[i]) < journeyTransfers(journeys[j])
+	})
+
+	return journeys, nil
+}
+
+// number of additional searches with halved walking limits, if walking is used as criterion
+const walkingCriterionSearches = 2
+
+func (b *Bifrost) routeTransitPareto(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, vehicleType VehicleType, arriveBy bool, debug bool) ([]*fptf.Journey, error) {
+	var journeys []*fptf.Journey
+
+	if arriveBy {
+		if len(origins) == 0 {
+			return nil, fmt.Errorf("no origin provided")
+		}
+
+		if b.parksVehicle(vehicleType) || b.dropsOff(vehicleType) {
+			return nil, fmt.Errorf("access by car or bicycle is not supported for arrive-by queries")
+		}
+
+		destKeys, err := b.matchArrivalLocation(dest, origins[0].Departure, b.transitVehicle())
+		if err != nil {
+			return nil, err
+		}
+
+		originKey, err := b.matchTargetLocation(origins[0].Location, b.transitVehicle(), true)
+		if err != nil {
+			return nil, err
+		}
+
+		journeys, err = b.RouteTransitArriveByPareto(rounds, destKeys, originKey, debug)
+		if err != nil {
+			return nil, err
+		}
+
+		origins = origins[:1]
+	} else {
+		originKeys, err := b.matchSourceLocations(origins, vehicleType)
+		if err != nil {
+			return nil, err
+		}
+
+		destKey, err := b.matchTargetLocation(dest, b.transitVehicle(), false)
+		if err != nil {
+			return nil, err
+		}
+
+		originKeys, err = b.prepareVehicleAccess(rounds, originKeys, dest, destKey, vehicleType)
+		if err != nil {
+			return nil, err
+		}
+
+		journeys, err = b.RouteTransitPareto(rounds, originKeys, destKey, debug)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, journey := range journeys {
+		b.addSourceAndDestination(journey, origins, dest)
+	}
+
+	return journeys, nil
+}
+
+// RouteParetoContext is RoutePareto, that stops when the context is done and returns its error then, see
+// RouteContext.
+func (b *Bifrost) RouteParetoContext(ctx context.Context, rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) ([]*fptf.Journey, error) {
+	return searchWithContext(ctx, rounds, func() ([]*fptf.Journey, error) {
+		return b.RoutePareto(rounds, origins, dest, modes, debug)
+	})
+}
+
+// RouteParetoArriveByContext is RouteParetoArriveBy, that stops when the context is done, see RouteContext.
+func (b *Bifrost) RouteParetoArriveByContext(ctx context.Context, rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) ([]*fptf.Journey, error) {
+	return searchWithContext(ctx, rounds, func() ([]*fptf.Journey, error) {
+		return b.RouteParetoArriveBy(rounds, origins, dest, modes, debug)
+	})
+}
+
+// RouteTransitPareto runs RAPTOR like RouteTransit, but reconstructs a journey from every round, in which the arrival
+// at the destination improved. Round k holds the earliest arrivals using at most k trips, so the result is the set of
+// journeys not beaten in both arrival time and number of transfers.
+func (b *Bifrost) RouteTransitPareto(rounds *Rounds, origins []SourceKey, destKey uint64, debug bool) ([]*fptf.Journey, error) {
+	err := checkDepartures(origins)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+
+	rounds.NewSession()
+
+	lastRound := b.runTransitRounds(rounds, origins, destKey, debug)
+
+	destKey, lastRound, ok := b.reachDestination(rounds, destKey, lastRound)
+	if !ok {
+		return nil, NoRouteError(true)
+	}
+
+	journeys := make([]*fptf.Journey, 0)
+	for _, round := range paretoRounds(rounds, destKey, lastRound, false) {
+		journey, err := b.ReconstructJourney(destKey, round, rounds)
+		if err != nil {
+			return nil, err
+		}
+
+		journeys = append(journeys, journey)
+	}
+
+	if debug {
+		fmt.Println("found", len(journeys), "pareto optimal journeys in", time.Since(t))
+	}
+
+	return journeys, nil
+}
+
+// RouteTransitArriveByPareto is the arrive-by counterpart of RouteTransitPareto.
+func (b *Bifrost) RouteTransitArriveByPareto(rounds *Rounds, destinations []SourceKey, originKey uint64, debug bool) ([]*fptf.Journey, error) {
+	if len(b.Data.ReverseStreetGraph) != len(b.Data.StreetGraph) {
+		return nil, fmt.Errorf("reverse street graph is not built, call RebuildReverseStreetGraph first")
+	}
+
+	err := checkDepartures(destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+
+	rounds.NewSession()
+
+	lastRound := b.runTransitRoundsReverse(rounds, destinations, originKey, debug)
+
+	originKey, lastRound, ok := b.reachOrigin(rounds, originKey, lastRound)
+	if !ok {
+		return nil, NoRouteError(true)
+	}
+
+	journeys := make([]*fptf.Journey, 0)
+	for _, round := range paretoRounds(rounds, originKey, lastRound, true) {
+		journey, err := b.ReconstructJourneyReverse(originKey, round, rounds)
+		if err != nil {
+			return nil, err
+		}
+
+		journeys = append(journeys, journey)
+	}
+
+	if debug {
+		fmt.Println("found", len(journeys), "pareto optimal journeys in", time.Since(t))
+	}
+
+	return journeys, nil
+}
+
+// paretoRounds returns the rounds in which the label of the given vertex improved. In reverse searches, labels are
+// latest departures, so a higher label is better.
+func paretoRounds(rounds *Rounds, vertex uint64, lastRound int, reverse bool) []int {
+	result := make([]int, 0)
+
+	var best uint64
+	found := false
+
+	for i := 1; i <= lastRound; i++ {
+		sa, ok := rounds.Rounds[i].Get(vertex)
+		if !ok {
+			continue
+		}
+
+		if found && (!reverse && sa.Arrival >= best || reverse && sa.Arrival <= best) {
+			continue
+		}
+
+		best = sa.Arrival
+		found = true
+		result = append(result, i)
+	}
+
+	return result
+}
+
+// filterParetoJourneys removes all journeys, that are beaten or matched by another journey in arrival time (departure
+// time for arrive-by queries), number of transfers and walking time.
+func filterParetoJourneys(journeys []*fptf.Journey, arriveBy bool) []*fptf.Journey {
+	result := make([]*fptf.Journey, 0, len(journeys))
+
+	for i, journey := range journeys {
+		dominated := false
+
+		for j, other := range journeys {
+			if i == j {
+				continue
+			}
+
+			if !journeyDominates(other, journey, arriveBy) {
+				continue
+			}
+
+			// equal journeys dominate each other, keep the first one
+			if j > i && journeyDominates(journey, other, arriveBy) {
+				continue
+			}
+
+			dominated = true
+			break
+		}
+
+		if !dominated {
+			result = append(result, journey)
+		}
+	}
+
+	return result
+}
+
+// journeyDominates returns true, if a is at least as good as b in all criteria.
+func journeyDominates(a, b *fptf.Journey, arriveBy bool) bool {
+	if arriveBy {
+		if a.GetDeparture().Before(b.GetDeparture()) {
+			return false
+		}
+	} else if a.GetArrival().After(b.GetArrival()) {
+		return false
+	}
+
+	if journeyTransfers(a) > journeyTransfers(b) {
+		return false
+	}
+
+	return journeyWalkingTime(a) <= journeyWalkingTime(b)
+}
+
+// journeyTransfers returns the number of transfers between transit legs of a journey. Street legs, including the
+// drives to and from transit, are not counted.
+func journeyTransfers(journey *fptf.Journey) int {
+	transitLegs := 0
+
+	for _, trip := range journey.Trips {
+		if transitModeOf(trip.Mode) == 0 {
+			continue
+		}
+
+		transitLegs++
+	}
+
+	if transitLegs == 0 {
+		return 0
+	}
+
+	return transitLegs - 1
+}
+
+// journeyWalkingTime returns the total duration of all walking legs of a journey.
+func journeyWalkingTime(journey *fptf.Journey) time.Duration {
+	walking := time.Duration(0)
+
+	for _, trip := range journey.Trips {
+		if trip.Mode != fptf.ModeWalking {
+			continue
+		}
+
+		walking += trip.Arrival.Sub(trip.Departure.Time)
+	}
+
+	return walking
+}
@@ -0,0 +1,46 @@
+package bifrost
+
+import (
+	"time"
+)
+
+// parksVehicle returns true, if the vehicle is parked at a parking facility before taking transit.
+func (b *Bifrost) parksVehicle(vehicle VehicleType) bool {
+	return vehicle == VehicleTypeCar && b.carAccess == carAccessParkAndRide || vehicle == VehicleTypeBicycle && b.BikeAndRide
+}
+
+// takesBikeOnBoard returns true, if the vehicle is a bicycle, that is taken on board of transit.
+func (b *Bifrost) takesBikeOnBoard(vehicle VehicleType) bool {
+	return vehicle == VehicleTypeBicycle && !b.BikeAndRide
+}
+
+// driveToParkings drives or cycles from the origins to the parking facilities of the vehicle and returns them as new
+// origins, departing once the vehicle is parked. The vehicle is only switched at these facilities. The labels of the
+// street search are kept in rounds.Access to reconstruct the first leg of the journey.
+func (b *Bifrost) driveToParkings(rounds *Rounds, origins []SourceKey, destKey uint64, vehicle VehicleType) ([]SourceKey, error) {
+	b.runAccessSearch(rounds, origins, destKey, vehicle, true)
+
+	parkings := make([]SourceKey, 0)
+
+	for vertex, vehicles := range b.Data.Parkings {
+		if vehicles&(1<<vehicle) == 0 {
+			continue
+		}
+
+		sa, ok := rounds.Access.Get(vertex)
+		if !ok {
+			continue
+		}
+
+		parkings = append(parkings, SourceKey{
+			StopKey:   vertex,
+			Departure: time.UnixMilli(int64(sa.Arrival + b.ParkingMs)),
+		})
+	}
+
+	if len(parkings) == 0 {
+		return nil, NoRouteError(true)
+	}
+
+	return parkings, nil
+}
@@ -0,0 +1,62 @@
+package bifrost
+
+import (
+	"github.com/paulmach/osm"
+	"testing"
+	"time"
+)
+
+func TestParkingVehicles(t *testing.T) {
+	cases := []struct {
+		tags     osm.Tags
+		vehicles uint8
+	}{
+		{osm.Tags{{Key: "amenity", Value: "parking"}}, 0},
+		{osm.Tags{{Key: "amenity", Value: "parking"}, {Key: "park_ride", Value: "no"}}, 0},
+		{osm.Tags{{Key: "amenity", Value: "parking"}, {Key: "park_ride", Value: "bus"}}, 1 << VehicleTypeCar},
+		{osm.Tags{{Key: "amenity", Value: "bicycle_parking"}}, 1 << VehicleTypeBicycle},
+	}
+
+	for _, c := range cases {
+		if vehicles := parkingVehicles(c.tags); vehicles != c.vehicles {
+			t.Fatalf("expected %b for %v, got %b", c.vehicles, c.tags, vehicles)
+		}
+	}
+}
+
+func TestDriveToParkings(t *testing.T) {
+	b := &Bifrost{
+		CarMaxSpeed: 36.0 * 0.001,
+		ParkingMs:   60000,
+		Data: &RoutingData{
+			Vertices: []Vertex{{}, {}, {}, {}},
+			StreetGraph: [][]Arc{
+				{{Target: 1, CarDistance: 1000}},
+				{{Target: 2, CarDistance: 1000}},
+				{{Target: 3, WalkDistance: 1000}},
+				{},
+			},
+			Parkings: map[uint64]uint8{1: 1 << VehicleTypeCar, 2: 1 << VehicleTypeBicycle},
+		},
+	}
+
+	rounds := b.NewRounds()
+	departure := time.UnixMilli(int64(DayInMs) * 3)
+
+	parkings, err := b.driveToParkings(rounds, []SourceKey{{StopKey: 0, Departure: departure}}, 3, VehicleTypeCar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parkings) != 1 || parkings[0].StopKey != 1 {
+		t.Fatalf("expected only the park and ride facility, got %v", parkings)
+	}
+
+	if !parkings[0].Departure.Equal(departure.Add(61 * time.Second)) {
+		t.Fatalf("expected departure after driving and parking, got %v", parkings[0].Departure)
+	}
+
+	if sa, ok := rounds.Access.Get(1); !ok || sa.Trip != TripIdCar {
+		t.Fatalf("expected car label at the facility, got %+v", sa)
+	}
+}
@@ -1,9 +1,11 @@
 package bifrost
 
 import (
+	"context"
 	"fmt"
 	"github.com/Vector-Hector/fptf"
 	util "github.com/Vector-Hector/goutil"
+	"math"
 	"time"
 )
 
@@ -17,19 +19,70 @@ type SourceLocation struct {
 	Departure time.Time
 }
 
+// earliestRoutableTime is the earliest departure or arrival of a query. Trips are searched on the service days
+// before the day of the query, which must not be before the unix epoch.
+var earliestRoutableTime = time.UnixMilli(2 * int64(DayInMs))
+
+// checkDepartures returns a DepartureError, if one of the sources departs before earliestRoutableTime.
+func checkDepartures(sources []SourceKey) error {
+	for _, source := range sources {
+		if source.Departure.Before(earliestRoutableTime) {
+			return &DepartureError{Departure: source.Departure}
+		}
+	}
+
+	return nil
+}
+
 func timeToMs(day time.Time) uint64 {
 	return uint64(day.UnixMilli())
 }
 
+// Route finds a journey from one of the origins to the destination using the given modes, that departs at the
+// departure time of the origins.
 func (b *Bifrost) Route(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) (*fptf.Journey, error) {
+	return b.route(rounds, origins, dest, modes, false, debug)
+}
+
+// RouteArriveBy finds the journey from the origin to the destination leaving as late as possible. The departure time
+// of the first origin is used as the latest arrival time at the destination.
+func (b *Bifrost) RouteArriveBy(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) (*fptf.Journey, error) {
+	return b.route(rounds, origins, dest, modes, true, debug)
+}
+
+func (b *Bifrost) route(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, arriveBy bool, debug bool) (*fptf.Journey, error) {
 	vehicleType, isTransit := getVehicleType(modes)
+	rounds.TransitModes = getTransitModes(modes)
+	rounds.Access = nil
+	rounds.Egress = nil
+
+	if isTransit && b.takesBikeOnBoard(vehicleType) {
+		b = b.withBikeOnBoard()
+	}
+
+	if access := getCarAccess(modes); isTransit && access != carAccessParkAndRide {
+		b = b.withCarAccess(access)
+	}
+
+	if arriveBy && isTransit {
+		if b.parksVehicle(vehicleType) || b.dropsOff(vehicleType) {
+			return nil, fmt.Errorf("access by car or bicycle is not supported for arrive-by queries")
+		}
+
+		return b.routeTransitArriveBy(rounds, origins, dest, debug)
+	}
 
 	originKeys, err := b.matchSourceLocations(origins, vehicleType)
 	if err != nil {
 		return nil, err
 	}
 
-	destKey, err := b.matchTargetLocation(dest, vehicleType)
+	destVehicle := vehicleType
+	if isTransit {
+		destVehicle = b.transitVehicle()
+	}
+
+	destKey, err := b.matchTargetLocation(dest, destVehicle, false)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +92,11 @@ func (b *Bifrost) Route(rounds *Rounds, origins []SourceLocation, dest *fptf.Loc
 	if !isTransit {
 		journey, err = b.RouteOnlyTimeIndependent(rounds, originKeys, destKey, vehicleType, debug)
 	} else {
+		originKeys, err = b.prepareVehicleAccess(rounds, originKeys, dest, destKey, vehicleType)
+		if err != nil {
+			return nil, err
+		}
+
 		journey, err = b.RouteTransit(rounds, originKeys, destKey, debug)
 	}
 
@@ -48,34 +106,88 @@ func (b *Bifrost) Route(rounds *Rounds, origins []SourceLocation, dest *fptf.Loc
 
 	b.addSourceAndDestination(journey, origins, dest)
 
+	if arriveBy {
+		// street journeys do not depend on the time, so we can just move them to the requested arrival
+		shiftJourney(journey, origins[0].Departure.Sub(journey.GetArrival()))
+	}
+
 	return journey, nil
 
 }
 
+// RouteContext is Route, that stops when the context is done and returns its error then. The context is checked
+// between RAPTOR rounds and periodically while searching the street graph.
+func (b *Bifrost) RouteContext(ctx context.Context, rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) (*fptf.Journey, error) {
+	return searchWithContext(ctx, rounds, func() (*fptf.Journey, error) {
+		return b.Route(rounds, origins, dest, modes, debug)
+	})
+}
+
+// RouteArriveByContext is RouteArriveBy, that stops when the context is done, see RouteContext.
+func (b *Bifrost) RouteArriveByContext(ctx context.Context, rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, debug bool) (*fptf.Journey, error) {
+	return searchWithContext(ctx, rounds, func() (*fptf.Journey, error) {
+		return b.RouteArriveBy(rounds, origins, dest, modes, debug)
+	})
+}
+
+func (b *Bifrost) routeTransitArriveBy(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, debug bool) (*fptf.Journey, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("no origin provided")
+	}
+
+	destKeys, err := b.matchArrivalLocation(dest, origins[0].Departure, b.transitVehicle())
+	if err != nil {
+		return nil, err
+	}
+
+	originKey, err := b.matchTargetLocation(origins[0].Location, b.transitVehicle(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	journey, err := b.RouteTransitArriveBy(rounds, destKeys, originKey, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	b.addSourceAndDestination(journey, origins[:1], dest)
+
+	return journey, nil
+}
+
+// getVehicleType returns the street vehicle of the modes and whether transit is used. Transit is accessed by foot,
+// unless a car or bicycle is requested as well. It is parked or, for bicycles, possibly taken on board then. Cars may
+// also drop off the traveller, see getCarAccess.
 func getVehicleType(modes []fptf.Mode) (VehicleType, bool) {
 	vehicleType := VehicleTypeWalking
+	isTransit := false
 
 	for _, mode := range modes {
-		if mode == fptf.ModeTrain || mode == fptf.ModeBus {
-			return 0, true
+		if transitModeOf(mode) != 0 {
+			isTransit = true
 		}
 
 		if mode == fptf.ModeBicycle {
 			vehicleType = VehicleTypeBicycle
-		} else if mode == fptf.ModeCar {
+		} else if mode == fptf.ModeCar || mode == ModeKissAndRide || mode == ModeTaxiAccess {
 			vehicleType = VehicleTypeCar
 		}
 	}
 
-	return vehicleType, false
+	return vehicleType, isTransit
 }
 
 func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint64, debug bool) (*fptf.Journey, error) {
-	// todo add vehicle support (take more of the vehicle bitmask into account, what if bicycle is taken with you on the train?)
-	// what if bicycle is taken with you on a car? what if that car is going to a train station and you take the bicycle with you on the train?
+	// todo add more vehicle support: what if bicycle is taken with you on a car? what if that car is going to a train
+	// station and you take the bicycle with you on the train?
 
 	// todo investigate graph issues: some vertices are not reachable and can only be reached by choosing a close vertex as destKey instead
 
+	err := checkDepartures(origins)
+	if err != nil {
+		return nil, err
+	}
+
 	t := time.Now()
 
 	rounds.NewSession()
@@ -97,24 +209,61 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 		b.Data.PrintStats()
 	}
 
+	lastRound := b.runTransitRounds(rounds, origins, destKey, debug)
+
+	destKey, lastRound, ok := b.reachDestination(rounds, destKey, lastRound)
+	if !ok {
+		return nil, NoRouteError(true)
+	}
+
+	journey, err := b.ReconstructJourney(destKey, lastRound, rounds)
+	if err != nil {
+		return nil, err
+	}
+
+	if debug {
+		fmt.Println("max tts size", rounds.Rounds[lastRound].Len())
+
+		dep := journey.GetDeparture()
+		arr := journey.GetArrival()
+
+		origin := journey.GetOrigin().GetName()
+		destination := journey.GetDestination().GetName()
+
+		fmt.Println("Journey from", origin, "to", destination, "took", arr.Sub(dep), ". dep", dep, ", arr", arr)
+
+		fmt.Println("Journey:")
+		util.PrintJSON(journey)
+	}
+
+	return journey, nil
+}
+
+// runTransitRounds seeds the origins into the first round and runs the RAPTOR rounds. It does not reset the rounds, so
+// labels of earlier runs are kept. Returns the last round that was reached.
+func (b *Bifrost) runTransitRounds(rounds *Rounds, origins []SourceKey, destKey uint64, debug bool) int {
 	calcStart := time.Now()
+	t := calcStart
 
 	for _, origin := range origins {
 		departure := timeToMs(origin.Departure)
 
-		rounds.Rounds[0][origin.StopKey] = StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << VehicleTypeWalking}
-		rounds.MarkedStops[origin.StopKey] = true
-		rounds.EarliestArrivals[origin.StopKey] = departure
+		if ea, ok := rounds.EarliestArrivals.Get(origin.StopKey); ok && ea <= departure {
+			continue
+		}
+
+		rounds.Rounds[0].Set(origin.StopKey, StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << b.transitVehicle()})
+		rounds.MarkedStops.Add(origin.StopKey)
+		rounds.EarliestArrivals.Set(origin.StopKey, departure)
 	}
 
 	lastRound := 0
 
-	if debug {
-		fmt.Println("setting up took", time.Since(t))
-		t = time.Now()
-	}
-
 	for k := 0; k < b.TransferLimit+1; k++ {
+		if rounds.cancelled() {
+			break
+		}
+
 		if debug {
 			fmt.Println("------ Round", k, "------")
 		}
@@ -124,48 +273,41 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 		t = time.Now()
 		b.runRaptorRound(rounds, destKey, ttsKey, debug)
 
-		for _, sa := range rounds.Rounds[ttsKey] {
-			if sa.Arrival < uint64(DayInMs*2) {
-				panic("arrival too small")
-			}
-		}
-
 		if debug {
 			fmt.Println("Getting trip times took", time.Since(t))
 			t = time.Now()
 
-			fmt.Println("Marked", len(rounds.MarkedStops), "stops for trips")
+			fmt.Println("Marked", rounds.MarkedStops.Len(), "stops for trips")
 		}
 
 		if k == 0 {
 			for _, origin := range origins {
-				rounds.MarkedStops[origin.StopKey] = true
+				rounds.MarkedStops.Add(origin.StopKey)
 			}
 		}
 
 		if debug {
-			fmt.Println("num reached stops:", len(rounds.Rounds[ttsKey]))
+			fmt.Println("num reached stops:", rounds.Rounds[ttsKey].Len())
 		}
 
-		for stop, marked := range rounds.MarkedStops {
-			rounds.MarkedStopsForTransfer[stop] = marked
-		}
+		rounds.MarkedStops.Each(rounds.MarkedStopsForTransfer.Add)
 
-		b.runTransferRound(rounds, destKey, ttsKey+1, VehicleTypeWalking, false)
+		b.runTransferRound(rounds, destKey, ttsKey+1, b.transitVehicle(), false)
+		b.applyEgress(rounds, destKey, ttsKey+2)
 
 		if debug {
 			fmt.Println("Getting transfer times took", time.Since(t))
 		}
 
 		if debug {
-			fmt.Println("Marked", len(rounds.MarkedStops), "stops in total in round", k)
+			fmt.Println("Marked", rounds.MarkedStops.Len(), "stops in total in round", k)
 		}
 
 		if debug {
-			fmt.Println("num reached stops:", len(rounds.Rounds[ttsKey+1]))
+			fmt.Println("num reached stops:", rounds.Rounds[ttsKey+1].Len())
 		}
 
-		if len(rounds.MarkedStops) == 0 {
+		if rounds.MarkedStops.Len() == 0 {
 			break
 		}
 
@@ -176,20 +318,28 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 		fmt.Println("Done in", time.Since(calcStart))
 	}
 
-	_, ok := rounds.EarliestArrivals[destKey]
+	return lastRound
+}
+
+// reachDestination makes sure the destination was reached. If not, it runs an unrestricted transfer round and
+// otherwise falls back to a reached vertex very close to the destination. Returns the possibly replaced destination
+// and last round, and whether the destination was reached at all.
+func (b *Bifrost) reachDestination(rounds *Rounds, destKey uint64, lastRound int) (uint64, int, bool) {
+	ok := rounds.EarliestArrivals.Has(destKey)
 	if !ok {
 		// add an unrestricted transfer round
 		// first, mark all vertices that are reachable already
-		for vert := range rounds.EarliestArrivals {
-			rounds.MarkedStopsForTransfer[vert] = true
+		for i := 0; i < rounds.EarliestArrivals.Len(); i++ {
+			vert, _ := rounds.EarliestArrivals.Entry(i)
+			rounds.MarkedStopsForTransfer.Add(vert)
 		}
 
 		// then, run a transfer round
-		b.runTransferRound(rounds, destKey, lastRound, VehicleTypeWalking, true)
+		b.runTransferRound(rounds, destKey, lastRound, b.transitVehicle(), true)
 		lastRound++
 	}
 
-	_, ok = rounds.EarliestArrivals[destKey]
+	ok = rounds.EarliestArrivals.Has(destKey)
 	if !ok {
 		// look for very close, walkable vertices
 		loc := b.Data.Vertices[destKey]
@@ -198,7 +348,7 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 		for _, point := range nearest {
 			streetVert := point.(*GeoPoint)
 
-			_, ok = rounds.EarliestArrivals[streetVert.VertKey]
+			ok = rounds.EarliestArrivals.Has(streetVert.VertKey)
 			if !ok {
 				continue
 			}
@@ -207,7 +357,7 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 				break
 			}
 
-			dist := b.DistanceMs(&loc, streetVert, VehicleTypeWalking)
+			dist := distanceMs(&loc, streetVert, b.WalkingSpeed)
 
 			if dist > b.MaxStopsConnectionSeconds {
 				break
@@ -218,29 +368,8 @@ func (b *Bifrost) RouteTransit(rounds *Rounds, origins []SourceKey, destKey uint
 		}
 	}
 
-	_, ok = rounds.EarliestArrivals[destKey]
-	if !ok {
-		return nil, NoRouteError(true)
-	}
-
-	journey := b.ReconstructJourney(destKey, lastRound, rounds)
-
-	if debug {
-		fmt.Println("max tts size", len(rounds.Rounds[lastRound]))
-
-		dep := journey.GetDeparture()
-		arr := journey.GetArrival()
-
-		origin := journey.GetOrigin().GetName()
-		destination := journey.GetDestination().GetName()
-
-		fmt.Println("Journey from", origin, "to", destination, "took", arr.Sub(dep), ". dep", dep, ", arr", arr)
-
-		fmt.Println("Journey:")
-		util.PrintJSON(journey)
-	}
-
-	return journey, nil
+	ok = rounds.EarliestArrivals.Has(destKey)
+	return destKey, lastRound, ok
 }
 
 func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, debug bool) {
@@ -249,11 +378,17 @@ func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, deb
 	round := rounds.Rounds[current]
 	next := rounds.Rounds[current+1]
 
-	for stop, stopArr := range round {
-		next[stop] = StopArrival{
-			Arrival: stopArr.Arrival,
-			Trip:    TripIdNoChange,
+	for i := 0; i < round.Len(); i++ {
+		stop, stopArr := round.Entry(i)
+		if existing, ok := next.Get(stop); ok && existing.Arrival <= stopArr.Arrival {
+			continue // keep better labels of earlier range runs
 		}
+
+		next.Set(stop, StopArrival{
+			Arrival:  stopArr.Arrival,
+			Trip:     TripIdNoChange,
+			Vehicles: stopArr.Vehicles,
+		})
 	}
 
 	if debug {
@@ -262,9 +397,7 @@ func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, deb
 	}
 
 	// clear queue
-	for k := range rounds.Queue {
-		delete(rounds.Queue, k)
-	}
+	rounds.Queue.Reset()
 
 	if debug {
 		fmt.Println("clearing queue took", time.Since(t))
@@ -272,11 +405,15 @@ func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, deb
 	}
 
 	// add routes to queue
-	for stop := range rounds.MarkedStops {
+	rounds.MarkedStops.Each(func(stop uint64) {
 		for _, pair := range b.Data.StopToRoutes[stop] {
-			enter, ok := rounds.Queue[pair.Route]
+			if !rounds.routeAllowed(b.Data.Routes[pair.Route]) {
+				continue
+			}
+
+			enter, ok := rounds.Queue.Get(uint64(pair.Route))
 			if !ok {
-				rounds.Queue[pair.Route] = pair.StopKeyInTrip
+				rounds.Queue.Set(uint64(pair.Route), pair.StopKeyInTrip)
 				continue
 			}
 
@@ -284,61 +421,73 @@ func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, deb
 				continue
 			}
 
-			rounds.Queue[pair.Route] = pair.StopKeyInTrip
+			rounds.Queue.Set(uint64(pair.Route), pair.StopKeyInTrip)
 		}
-
-		delete(rounds.MarkedStops, stop)
-	}
+	})
+	rounds.MarkedStops.Reset()
 
 	if debug {
 		fmt.Println("adding trips to queue took", time.Since(t))
 		t = time.Now()
 
-		fmt.Println("q size", len(rounds.Queue))
+		fmt.Println("q size", rounds.Queue.Len())
 	}
 
 	numVisited := 0
 
 	// scan routes
-	for routeKey, enterKey := range rounds.Queue {
+	for i := 0; i < rounds.Queue.Len(); i++ {
+		key, enterKey := rounds.Queue.Entry(i)
+		routeKey := uint32(key)
 		route := b.Data.Routes[routeKey]
 
 		tripKey := uint32(0)
 		departureDay := uint32(0)
+		dayStart := uint64(0)
+		vehicles := uint8(0) // vehicles taken on board of the trip
 		var trip *Trip
 
 		for stopSeqKeyShifted, stopKey := range route.Stops[enterKey:] {
 			stopSeqKey := enterKey + uint32(stopSeqKeyShifted)
 			numVisited++
 
-			if trip != nil {
-				arr := trip.StopTimes[stopSeqKey].ArrivalAtDay(uint64(departureDay))
-				ea, ok := rounds.EarliestArrivals[stopKey]
-				targetEa, targetOk := rounds.EarliestArrivals[target]
+			if trip != nil && b.canLeave(route, trip, tripKey, departureDay, stopSeqKey) {
+				arr := trip.StopTimes[stopSeqKey].ArrivalAt(dayStart)
+				ea, ok := rounds.EarliestArrivals.Get(stopKey)
+				targetEa, targetOk := rounds.EarliestArrivals.Get(target)
 
 				if (!ok || arr < ea) && (!targetOk || arr < targetEa) {
-					next[stopKey] = StopArrival{
+					next.Set(stopKey, StopArrival{
 						Arrival:   arr,
 						Trip:      tripKey,
 						EnterKey:  uint64(stopSeqKey),
 						Departure: uint64(departureDay),
-					}
-					rounds.MarkedStops[stopKey] = true
-					rounds.EarliestArrivals[stopKey] = arr
+						Vehicles:  vehicles,
+					})
+					rounds.MarkedStops.Add(stopKey)
+					rounds.EarliestArrivals.Set(stopKey, arr)
 				}
 			}
 
-			sa, ok := round[stopKey]
+			sa, ok := round.Get(stopKey)
 
-			if ok && (trip == nil || sa.Arrival <= trip.StopTimes[stopSeqKey].ArrivalAtDay(uint64(departureDay))) {
-				et, key, depDay := b.Data.earliestTrip(routeKey, stopSeqKey, sa.Arrival+b.TransferPaddingMs)
-				if et != nil {
+			// entering a trip at the last stop of the route is pointless
+			if ok && int(stopSeqKey) < len(route.Stops)-1 && (trip == nil || sa.Arrival <= trip.StopTimes[stopSeqKey].ArrivalAt(dayStart)) {
+				et, key, depDay := b.earliestTripAfterTransfer(rounds, current, routeKey, stopSeqKey, stopKey, sa.Arrival)
+				// transfer rules may only allow a later trip, so keep the current trip in that case
+				if et != nil && (trip == nil || et.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(et, uint64(depDay))) < trip.StopTimes[stopSeqKey].DepartureAt(dayStart)) {
 					trip = et
 					tripKey = key
 					departureDay = depDay
+					dayStart = b.Data.dayStart(et, uint64(depDay))
+					vehicles = tripVehicles(et, sa.Vehicles)
 				}
 			}
 		}
+
+		if trip != nil {
+			b.continueInSeat(rounds, next, target, tripKey, departureDay, vehicles)
+		}
 	}
 
 	if debug {
@@ -348,6 +497,61 @@ func (b *Bifrost) runRaptorRound(rounds *Rounds, target uint64, current int, deb
 	}
 }
 
+// canEnter returns true, if travellers may enter the trip of the route at the stop.
+func (b *Bifrost) canEnter(route *Route, trip *Trip, tripKey uint32, day uint32, stopSeqKey uint32) bool {
+	if b.bikeOnBoard && trip.Bikes != AccessibilityYes {
+		return false
+	}
+
+	if b.Wheelchair && !b.wheelchairAccessible(route, trip, stopSeqKey) {
+		return false
+	}
+
+	if b.AvoidNoService && b.Data.noService(route, tripKey, day, stopSeqKey, trip.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(trip, uint64(day)))) {
+		return false
+	}
+
+	return b.stopTypeAllowed(trip.StopTimes[stopSeqKey].Pickup)
+}
+
+// canLeave returns true, if travellers may leave the trip of the route at the stop.
+func (b *Bifrost) canLeave(route *Route, trip *Trip, tripKey uint32, day uint32, stopSeqKey uint32) bool {
+	if b.bikeOnBoard && trip.Bikes != AccessibilityYes {
+		return false
+	}
+
+	if b.Wheelchair && !b.wheelchairAccessible(route, trip, stopSeqKey) {
+		return false
+	}
+
+	if b.AvoidNoService && b.Data.noService(route, tripKey, day, stopSeqKey, trip.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(trip, uint64(day)))) {
+		return false
+	}
+
+	return b.stopTypeAllowed(trip.StopTimes[stopSeqKey].DropOff)
+}
+
+// wheelchairAccessible returns true, if neither the trip nor the stop are known to be inaccessible with a wheelchair.
+func (b *Bifrost) wheelchairAccessible(route *Route, trip *Trip, stopSeqKey uint32) bool {
+	if trip.Wheelchair == AccessibilityNo {
+		return false
+	}
+
+	stop := b.Data.Vertices[route.Stops[stopSeqKey]].Stop
+	return stop == nil || stop.Wheelchair != AccessibilityNo
+}
+
+func (b *Bifrost) stopTypeAllowed(stopType StopType) bool {
+	switch stopType {
+	case StopTypeNone:
+		return false
+	case StopTypePhoneAgency:
+		return b.AllowPhoneAgencyStops
+	default:
+		return true
+	}
+}
+
 func (r *RoutingData) tripRunsOnDay(trip *Trip, day uint32) bool {
 	service := r.Services[trip.Service]
 
@@ -400,50 +604,88 @@ func binarySearchDays(days []uint32, day uint32) int {
 	return left
 }
 
-func (r *RoutingData) earliestTrip(routeKey uint32, stopSeqKey uint32, minDeparture uint64) (*Trip, uint32, uint32) {
-	day := uint32(minDeparture / uint64(DayInMs))
-	minDepartureInDay := uint32(minDeparture % uint64(DayInMs))
+// tripFilter returns true, if the trip running on the day may be used. Trip scans skip the trips it rejects, a nil
+// filter accepts all trips.
+type tripFilter func(trip *Trip, tripKey uint32, day uint32) bool
 
-	for i := uint32(0); i <= r.MaxTripDayLength; i++ {
-		trip, key := r.earliestTripInDay(routeKey, stopSeqKey, minDepartureInDay+i*DayInMs, day)
-		if trip != nil {
-			return trip, key, day
+func (f tripFilter) accepts(trip *Trip, tripKey uint32, day uint32) bool {
+	return f == nil || f(trip, tripKey, day)
+}
+
+// earliestTrip finds the trip of a route departing at stopSeqKey as early as possible, but not before minDeparture.
+// Returns the trip, its key and the day it departed on. Trips rejected by accept are skipped. Realtime updates are
+// respected, if there are any.
+func (r *RoutingData) earliestTrip(routeKey uint32, stopSeqKey uint32, minDeparture uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	if r.Realtime != nil {
+		return r.earliestRealtimeTrip(routeKey, stopSeqKey, minDeparture, accept)
+	}
+
+	return r.earliestScheduledTrip(routeKey, stopSeqKey, minDeparture, accept)
+}
+
+// earliestScheduledTrip finds the earliest trip by its scheduled departure.
+func (r *RoutingData) earliestScheduledTrip(routeKey uint32, stopSeqKey uint32, minDeparture uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	// the trips of a route belong to the same feed, so they share the start of their service days
+	first := r.Trips[r.Routes[routeKey].Trips[0]]
+	day := r.serviceDay(first, minDeparture)
+
+	var best *Trip
+	bestKey := uint32(0)
+	bestDay := uint32(0)
+	bestDeparture := uint64(0)
+
+	// a trip of an earlier service day running past midnight may depart before the first trip of the day
+	for i := uint32(0); i <= r.MaxTripDayLength && i <= day; i++ {
+		minDepartureInDay := minDeparture - r.dayStart(first, uint64(day-i))
+		if minDepartureInDay > math.MaxUint32 {
+			break // stop times never exceed a few days
+		}
+
+		trip, key := r.earliestTripInDay(routeKey, stopSeqKey, uint32(minDepartureInDay), day-i, accept)
+		if trip == nil {
+			continue
 		}
 
-		day--
+		dep := trip.StopTimes[stopSeqKey].DepartureAt(r.dayStart(trip, uint64(day-i)))
+		if best == nil || dep < bestDeparture {
+			best = trip
+			bestKey = key
+			bestDay = day - i
+			bestDeparture = dep
+		}
 	}
 
-	return nil, 0, 0
+	return best, bestKey, bestDay
 }
 
-func (r *RoutingData) earliestTripInDay(routeKey uint32, stopSeqKey uint32, minDepartureInDay uint32, day uint32) (*Trip, uint32) {
+func (r *RoutingData) earliestTripInDay(routeKey uint32, stopSeqKey uint32, minDepartureInDay uint32, day uint32, accept tripFilter) (*Trip, uint32) {
 	route := r.Routes[routeKey]
 	routeStopKey := uint64(routeKey)<<32 | uint64(stopSeqKey)
 
 	reorder, ok := r.Reorders[routeStopKey]
 	if !ok {
-		return r.earliestTripOrdered(route, stopSeqKey, minDepartureInDay, day)
+		return r.earliestTripOrdered(route, stopSeqKey, minDepartureInDay, day, accept)
 	}
 
-	return r.earliestTripReordered(route, stopSeqKey, minDepartureInDay, day, reorder)
+	return r.earliestTripReordered(route, stopSeqKey, minDepartureInDay, day, reorder, accept)
 }
 
-func (r *RoutingData) earliestTripOrdered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32) (*Trip, uint32) {
+func (r *RoutingData) earliestTripOrdered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, accept tripFilter) (*Trip, uint32) {
 	if r.Trips[route.Trips[0]].StopTimes[stopSeqKey].Departure >= minDepartureInDay {
-		return r.earliestExistentTripOrdered(route, day, 0)
+		return r.earliestExistentTripOrdered(route, day, 0, accept)
 	}
 
 	if r.Trips[route.Trips[len(route.Trips)-1]].StopTimes[stopSeqKey].Departure < minDepartureInDay {
 		return nil, 0
 	}
 
-	return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, 0, len(route.Trips)-1)
+	return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, 0, len(route.Trips)-1, accept)
 }
 
-func (r *RoutingData) earliestExistentTripOrdered(route *Route, day uint32, indexStart int) (*Trip, uint32) {
+// earliestExistentTripOrdered returns the first trip from indexStart on, that runs on the day and is accepted.
+func (r *RoutingData) earliestExistentTripOrdered(route *Route, day uint32, indexStart int, accept tripFilter) (*Trip, uint32) {
 	for i := indexStart; i < len(route.Trips); i++ {
-		trip := r.Trips[route.Trips[i]]
-		if r.tripRunsOnDay(trip, day) {
+		if trip := r.tripOnDay(route.Trips[i], day); trip != nil && accept.accepts(trip, route.Trips[i], day) {
 			return trip, route.Trips[i]
 		}
 	}
@@ -452,65 +694,73 @@ func (r *RoutingData) earliestExistentTripOrdered(route *Route, day uint32, inde
 
 // binary searches for the earliest trip, starting later than minDepartureInDay at stopSeqKey.
 // this assumes that left is below minDeparture and right is above minDeparture
-func (r *RoutingData) earliestTripBinarySearch(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, left int, right int) (*Trip, uint32) {
+func (r *RoutingData) earliestTripBinarySearch(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, left int, right int, accept tripFilter) (*Trip, uint32) {
 	mid := (left + right) / 2
 
 	if left == mid {
-		return r.earliestExistentTripOrdered(route, day, right)
+		return r.earliestExistentTripOrdered(route, day, right, accept)
 	}
 
 	trip := r.Trips[route.Trips[mid]]
 	dep := trip.StopTimes[stopSeqKey].Departure
 
 	if dep < minDepartureInDay {
-		return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, mid, right)
+		return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, mid, right, accept)
 	}
 
-	return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, left, mid)
+	return r.earliestTripBinarySearch(route, stopSeqKey, minDepartureInDay, day, left, mid, accept)
 }
 
-func (r *RoutingData) earliestExistentTripReordered(route *Route, day uint32, indexStart int, reorder []uint32) (*Trip, uint32) {
+func (r *RoutingData) earliestExistentTripReordered(route *Route, day uint32, indexStart int, reorder []uint32, accept tripFilter) (*Trip, uint32) {
 	for i := indexStart; i < len(route.Trips); i++ {
-		trip := r.Trips[route.Trips[reorder[i]]]
-		if r.tripRunsOnDay(trip, day) {
+		if trip := r.tripOnDay(route.Trips[reorder[i]], day); trip != nil && accept.accepts(trip, route.Trips[reorder[i]], day) {
 			return trip, route.Trips[reorder[i]]
 		}
 	}
 	return nil, 0
 }
 
-func (r *RoutingData) earliestTripReordered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, reorder []uint32) (*Trip, uint32) {
+func (r *RoutingData) earliestTripReordered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, reorder []uint32, accept tripFilter) (*Trip, uint32) {
 	if r.Trips[route.Trips[reorder[0]]].StopTimes[stopSeqKey].Departure >= minDepartureInDay {
-		return r.earliestExistentTripReordered(route, day, 0, reorder)
+		return r.earliestExistentTripReordered(route, day, 0, reorder, accept)
 	}
 
 	if r.Trips[route.Trips[reorder[len(route.Trips)-1]]].StopTimes[stopSeqKey].Departure < minDepartureInDay {
 		return nil, 0
 	}
 
-	return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, 0, len(route.Trips)-1)
+	return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, 0, len(route.Trips)-1, accept)
 }
 
 // binary searches for the earliest trip, starting later than minDeparture at stopSeqKey.
 // this assumes that left is below minDeparture and right is above minDeparture
-func (r *RoutingData) earliestTripBinarySearchReordered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, reorder []uint32, left int, right int) (*Trip, uint32) {
+func (r *RoutingData) earliestTripBinarySearchReordered(route *Route, stopSeqKey uint32, minDepartureInDay uint32, day uint32, reorder []uint32, left int, right int, accept tripFilter) (*Trip, uint32) {
 	mid := (left + right) / 2
 
 	if left == mid {
-		return r.earliestExistentTripReordered(route, day, right, reorder)
+		return r.earliestExistentTripReordered(route, day, right, reorder, accept)
 	}
 
 	trip := r.Trips[route.Trips[reorder[mid]]]
 	dep := trip.StopTimes[stopSeqKey].Departure
 
 	if dep < minDepartureInDay {
-		return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, mid, right)
+		return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, mid, right, accept)
 	}
 
-	return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, left, mid)
+	return r.earliestTripBinarySearchReordered(route, stopSeqKey, minDepartureInDay, day, reorder, left, mid, accept)
 }
 
 func (b *Bifrost) matchSourceLocations(origins []SourceLocation, vehicleToStart VehicleType) ([]SourceKey, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("no origin provided")
+	}
+
+	speed, err := b.GetMinAvgSpeed(vehicleToStart)
+	if err != nil {
+		return nil, err
+	}
+
 	originKeys := make([]SourceKey, 0)
 
 	tree := b.Data.WalkableVertexTree
@@ -531,7 +781,7 @@ func (b *Bifrost) matchSourceLocations(origins []SourceLocation, vehicleToStart
 		for _, vertex := range vertices {
 			point := vertex.(*GeoPoint)
 
-			dist := b.DistanceMs(loc, point, vehicleToStart)
+			dist := distanceMs(loc, point, speed)
 
 			originKeys = append(originKeys, SourceKey{
 				StopKey:   point.VertKey,
@@ -541,13 +791,20 @@ func (b *Bifrost) matchSourceLocations(origins []SourceLocation, vehicleToStart
 	}
 
 	if len(originKeys) == 0 {
-		return nil, fmt.Errorf("no origin vertex found for any provided location")
+		return nil, &UnreachableError{Location: origins[0].Location, Origin: true}
 	}
 
 	return originKeys, nil
 }
 
-func (b *Bifrost) matchTargetLocation(dest *fptf.Location, vehicleToReach VehicleType) (uint64, error) {
+// matchArrivalLocation finds the vertices around the destination of an arrive-by query. The returned keys hold the
+// latest time at which each vertex has to be left to reach the destination at the given arrival time.
+func (b *Bifrost) matchArrivalLocation(dest *fptf.Location, arrival time.Time, vehicleToReach VehicleType) ([]SourceKey, error) {
+	speed, err := b.GetMinAvgSpeed(vehicleToReach)
+	if err != nil {
+		return nil, err
+	}
+
 	loc := &GeoPoint{
 		Latitude:  dest.Latitude,
 		Longitude: dest.Longitude,
@@ -562,15 +819,48 @@ func (b *Bifrost) matchTargetLocation(dest *fptf.Location, vehicleToReach Vehicl
 
 	vertices := tree.KNN(loc, 30)
 
-	if len(vertices) == 0 {
-		return 0, fmt.Errorf("no stop within tolerance found for location %v", loc)
+	destKeys := make([]SourceKey, 0, len(vertices))
+
+	for _, vertex := range vertices {
+		point := vertex.(*GeoPoint)
+
+		dist := distanceMs(point, loc, speed)
+
+		destKeys = append(destKeys, SourceKey{
+			StopKey:   point.VertKey,
+			Departure: arrival.Add(-time.Duration(dist) * time.Millisecond),
+		})
+	}
+
+	if len(destKeys) == 0 {
+		return nil, &UnreachableError{Location: dest}
+	}
+
+	return destKeys, nil
+}
+
+// matchTargetLocation returns the vertex closest to the location. The location is the destination of the query, or its
+// origin for arrive-by queries, which are searched backwards.
+func (b *Bifrost) matchTargetLocation(dest *fptf.Location, vehicleToReach VehicleType, origin bool) (uint64, error) {
+	loc := &GeoPoint{
+		Latitude:  dest.Latitude,
+		Longitude: dest.Longitude,
+	}
+
+	tree := b.Data.WalkableVertexTree
+	if vehicleToReach == VehicleTypeBicycle {
+		tree = b.Data.CycleableVertexTree
+	} else if vehicleToReach == VehicleTypeCar {
+		tree = b.Data.CarableVertexTree
 	}
 
+	vertices := tree.KNN(loc, 30)
+
 	for _, vert := range vertices {
 		point := vert.(*GeoPoint)
 
 		return point.VertKey, nil
 	}
 
-	return 0, fmt.Errorf("no destination vertex found for location %v", loc)
+	return 0, &UnreachableError{Location: dest, Origin: origin}
 }
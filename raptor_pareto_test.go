@@ -0,0 +1,84 @@
+package bifrost
+
+import (
+	"testing"
+	"time"
+)
+
+// newParetoTestRouter adds a slow direct bus from vertex 0 to vertex 288 to the line test city, which can otherwise
+// only be reached by changing from the row to the column bus at vertex 16.
+func newParetoTestRouter() *Bifrost {
+	b := newLineTestRouter(10 * 60 * 1000)
+
+	minute := uint32(60 * 1000)
+	addTestRoute(b.Data, []uint64{0, 288}, []uint32{8*60*minute + 10*minute, 9 * 60 * minute})
+
+	return b
+}
+
+func TestRouteTransitPareto(t *testing.T) {
+	b := newParetoTestRouter()
+
+	departure := time.Date(2023, 12, 12, 8, 0, 0, 0, time.UTC)
+
+	journeys, err := b.RouteTransitPareto(b.NewRounds(), []SourceKey{{StopKey: 0, Departure: departure}}, 288, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journeys) != 2 {
+		t.Fatalf("expected the direct and the changing journey, got %d journeys", len(journeys))
+	}
+
+	direct, changing := journeys[0], journeys[1]
+
+	if journeyTransfers(direct) != 0 || !direct.GetArrival().Equal(departure.Add(time.Hour)) {
+		t.Fatalf("expected the direct bus arriving at 9:00, got %d transfers arriving at %v", journeyTransfers(direct), direct.GetArrival())
+	}
+
+	if journeyTransfers(changing) != 1 || !changing.GetArrival().Before(direct.GetArrival()) {
+		t.Fatalf("expected a faster journey with one transfer, got %d transfers arriving at %v", journeyTransfers(changing), changing.GetArrival())
+	}
+}
+
+func TestRouteTransitArriveByPareto(t *testing.T) {
+	b := newParetoTestRouter()
+
+	arrival := time.Date(2023, 12, 12, 9, 0, 0, 0, time.UTC)
+
+	journeys, err := b.RouteTransitArriveByPareto(b.NewRounds(), []SourceKey{{StopKey: 288, Departure: arrival}}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journeys) != 2 {
+		t.Fatalf("expected the direct and the changing journey, got %d journeys", len(journeys))
+	}
+
+	var direct, changing int
+	for _, journey := range journeys {
+		if journey.GetArrival().After(arrival) {
+			t.Fatalf("expected every journey to arrive by %v, got %v", arrival, journey.GetArrival())
+		}
+
+		switch journeyTransfers(journey) {
+		case 0:
+			direct++
+			if !journey.GetDeparture().Equal(arrival.Add(-50 * time.Minute)) {
+				t.Fatalf("expected the direct bus leaving at 8:10, got %v", journey.GetDeparture())
+			}
+		case 1:
+			changing++
+		}
+	}
+
+	if direct != 1 || changing != 1 {
+		t.Fatalf("expected one direct and one changing journey, got %d and %d", direct, changing)
+	}
+
+	for _, journey := range journeys {
+		if journeyTransfers(journey) == 1 && !journey.GetDeparture().After(arrival.Add(-50*time.Minute)) {
+			t.Fatalf("expected the changing journey to leave later than the direct bus, got %v", journey.GetDeparture())
+		}
+	}
+}
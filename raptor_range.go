@@ -0,0 +1,214 @@
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+	"sort"
+	"time"
+)
+
+// RouteRange finds all journeys departing within the given window after the departure of the origins, that are not
+// dominated by another journey departing later and arriving earlier or at the same time. The journeys are sorted by
+// departure. Street only modes do not depend on the departure, so only one journey is returned for them.
+func (b *Bifrost) RouteRange(rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, window time.Duration, debug bool) ([]*fptf.Journey, error) {
+	vehicleType, isTransit := getVehicleType(modes)
+	rounds.TransitModes = getTransitModes(modes)
+	rounds.Access = nil
+	rounds.Egress = nil
+
+	if !isTransit {
+		journey, err := b.Route(rounds, origins, dest, modes, debug)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*fptf.Journey{journey}, nil
+	}
+
+	if b.takesBikeOnBoard(vehicleType) {
+		b = b.withBikeOnBoard()
+	}
+
+	if access := getCarAccess(modes); access != carAccessParkAndRide {
+		b = b.withCarAccess(access)
+	}
+
+	originKeys, err := b.matchSourceLocations(origins, vehicleType)
+	if err != nil {
+		return nil, err
+	}
+
+	destKey, err := b.matchTargetLocation(dest, b.transitVehicle(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	originKeys, err = b.prepareVehicleAccess(rounds, originKeys, dest, destKey, vehicleType)
+	if err != nil {
+		return nil, err
+	}
+
+	journeys, err := b.RouteTransitRange(rounds, originKeys, destKey, window, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, journey := range journeys {
+		b.addSourceAndDestination(journey, origins, dest)
+	}
+
+	return journeys, nil
+}
+
+// RouteRangeContext is RouteRange, that stops when the context is done and returns its error then, see RouteContext.
+func (b *Bifrost) RouteRangeContext(ctx context.Context, rounds *Rounds, origins []SourceLocation, dest *fptf.Location, modes []fptf.Mode, window time.Duration, debug bool) ([]*fptf.Journey, error) {
+	return searchWithContext(ctx, rounds, func() ([]*fptf.Journey, error) {
+		return b.RouteRange(rounds, origins, dest, modes, window, debug)
+	})
+}
+
+// RouteTransitRange implements rRAPTOR. It collects the departures of all trips that can be caught from the origins
+// within the window and runs RAPTOR once for each of them, starting with the latest. The labels are not reset
+// between runs, as every label of a later departure is also valid for an earlier one. A run only yields a journey if
+// it improves the arrival at the destination.
+func (b *Bifrost) RouteTransitRange(rounds *Rounds, origins []SourceKey, destKey uint64, window time.Duration, debug bool) ([]*fptf.Journey, error) {
+	err := checkDepartures(origins)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+
+	offsets := b.rangeDepartureOffsets(rounds, origins, destKey, window)
+
+	if debug {
+		fmt.Println("found", len(offsets), "departures in window in", time.Since(t))
+	}
+
+	rounds.NewSession()
+
+	journeys := make([]*fptf.Journey, 0)
+	bestArrival := ArrivalTimeNotReached
+
+	for _, offset := range offsets {
+		if rounds.cancelled() {
+			break
+		}
+
+		shifted := make([]SourceKey, len(origins))
+		for i, origin := range origins {
+			shifted[i] = SourceKey{
+				StopKey:   origin.StopKey,
+				Departure: origin.Departure.Add(offset),
+			}
+		}
+
+		lastRound := b.runTransitRounds(rounds, shifted, destKey, debug)
+
+		runDestKey, lastRound, ok := b.reachDestination(rounds, destKey, lastRound)
+		if !ok {
+			continue
+		}
+
+		arrival, _ := rounds.EarliestArrivals.Get(runDestKey)
+		if arrival >= bestArrival {
+			continue // a journey departing later arrives just as early
+		}
+
+		bestArrival = arrival
+		journey, err := b.ReconstructJourney(runDestKey, lastRound, rounds)
+		if err != nil {
+			return nil, err
+		}
+
+		journeys = append(journeys, journey)
+	}
+
+	if len(journeys) == 0 {
+		return nil, NoRouteError(true)
+	}
+
+	// runs went from the latest to the earliest departure
+	for i := len(journeys)/2 - 1; i >= 0; i-- {
+		opp := len(journeys) - 1 - i
+		journeys[i], journeys[opp] = journeys[opp], journeys[i]
+	}
+
+	if debug {
+		fmt.Println("found", len(journeys), "journeys in", time.Since(t))
+	}
+
+	return journeys, nil
+}
+
+// rangeDepartureOffsets returns the offsets to the departure of the origins, at which a trip is caught exactly at a
+// stop within walking distance. The offsets lie within the window and are sorted from latest to earliest. The offset
+// zero is always included.
+func (b *Bifrost) rangeDepartureOffsets(rounds *Rounds, origins []SourceKey, destKey uint64, window time.Duration) []time.Duration {
+	rounds.NewSession()
+
+	for _, origin := range origins {
+		departure := timeToMs(origin.Departure)
+
+		if ea, ok := rounds.EarliestArrivals.Get(origin.StopKey); ok && ea <= departure {
+			continue
+		}
+
+		rounds.Rounds[0].Set(origin.StopKey, StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << b.transitVehicle()})
+		rounds.MarkedStopsForTransfer.Add(origin.StopKey)
+		rounds.EarliestArrivals.Set(origin.StopKey, departure)
+	}
+
+	b.runTransferRound(rounds, destKey, 0, b.transitVehicle(), false)
+
+	windowMs := uint64(window.Milliseconds())
+	offsetSet := map[uint64]bool{0: true}
+
+	for i := 0; i < rounds.EarliestArrivals.Len(); i++ {
+		stop, arrival := rounds.EarliestArrivals.Entry(i)
+		earliestDeparture := arrival + b.TransferPaddingMs
+		latestDeparture := earliestDeparture + windowMs
+
+		// include the service days before and after, whose trips may depart on this utc day
+		firstDay := uint64(0)
+		if day := earliestDeparture / uint64(DayInMs); day > uint64(b.Data.MaxTripDayLength)+1 {
+			firstDay = day - uint64(b.Data.MaxTripDayLength) - 1
+		}
+		lastDay := latestDeparture/uint64(DayInMs) + 1
+
+		for _, pair := range b.Data.StopToRoutes[stop] {
+			route := b.Data.Routes[pair.Route]
+			if !rounds.routeAllowed(route) {
+				continue
+			}
+
+			for _, tripKey := range route.Trips {
+				for day := firstDay; day <= lastDay; day++ {
+					trip := b.Data.tripOnDay(tripKey, uint32(day))
+					if trip == nil || !b.canEnter(route, trip, tripKey, uint32(day), pair.StopKeyInTrip) {
+						continue
+					}
+
+					dep := trip.StopTimes[pair.StopKeyInTrip].DepartureAt(b.Data.dayStart(trip, day))
+					if dep < earliestDeparture || dep > latestDeparture {
+						continue
+					}
+
+					offsetSet[dep-earliestDeparture] = true
+				}
+			}
+		}
+	}
+
+	offsets := make([]time.Duration, 0, len(offsetSet))
+	for offset := range offsetSet {
+		offsets = append(offsets, time.Duration(offset)*time.Millisecond)
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] > offsets[j]
+	})
+
+	return offsets
+}
@@ -0,0 +1,66 @@
+package bifrost
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouteTransitRange(t *testing.T) {
+	// walking is too slow to compete with the buses
+	b := newLineTestRouter(60 * 60 * 1000)
+
+	minute := uint32(60 * 1000)
+
+	// a slow bus leaving at 8:07 arrives at 8:30, after the bus leaving at 8:10
+	addTestRoute(b.Data, []uint64{0, 16}, []uint32{8*60*minute + 7*minute, 8*60*minute + 30*minute})
+
+	day := time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC)
+
+	// with the padding, trips are caught from 8:00 to 8:30 including both ends
+	departure := day.Add(7*time.Hour + 57*time.Minute)
+	journeys, err := b.RouteTransitRange(b.NewRounds(), []SourceKey{{StopKey: 0, Departure: departure}}, 16, 30*time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journeys) != 7 {
+		t.Fatalf("expected the buses from 8:00 to 8:30 every 5 minutes, got %d journeys", len(journeys))
+	}
+
+	for i, journey := range journeys {
+		expected := day.Add(8*time.Hour + time.Duration(i)*5*time.Minute)
+		if !journey.GetDeparture().Equal(expected) {
+			t.Fatalf("expected journey %d to depart at %v, got %v", i, expected, journey.GetDeparture())
+		}
+
+		if !journey.GetArrival().Equal(expected.Add(8 * time.Minute)) {
+			t.Fatalf("expected journey %d to arrive after 8 minutes, got %v", i, journey.GetArrival())
+		}
+	}
+}
+
+func TestRouteTransitRangeAcrossMidnight(t *testing.T) {
+	b := newLineTestRouter(60 * 60 * 1000)
+
+	// a night bus of the service day before leaving at 0:30
+	minute := uint32(60 * 1000)
+	addTestRoute(b.Data, []uint64{0, 16}, []uint32{24*60*minute + 30*minute, 24*60*minute + 40*minute})
+	b.Data.MaxTripDayLength = 1
+
+	day := time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC)
+
+	// the last bus of the day leaves at 22:55, the night bus at 0:30 and the first bus of the next day at 5:00
+	departure := day.Add(22*time.Hour + 50*time.Minute)
+	journeys, err := b.RouteTransitRange(b.NewRounds(), []SourceKey{{StopKey: 0, Departure: departure}}, 16, 2*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journeys) != 2 {
+		t.Fatalf("expected the last bus of the day and the night bus, got %d journeys", len(journeys))
+	}
+
+	if !journeys[0].GetDeparture().Equal(day.Add(22*time.Hour+55*time.Minute)) || !journeys[1].GetDeparture().Equal(day.Add(24*time.Hour+30*time.Minute)) {
+		t.Fatalf("expected departures at 22:55 and 0:30, got %v and %v", journeys[0].GetDeparture(), journeys[1].GetDeparture())
+	}
+}
@@ -0,0 +1,349 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+	util "github.com/Vector-Hector/goutil"
+	"math"
+	"sort"
+	"time"
+)
+
+// RouteTransitArriveBy runs RAPTOR backwards in time. It starts at the destinations, where the Departure of each
+// SourceKey is the latest time the vertex may be left to still arrive in time, and searches for the latest departure
+// at the origin. During this search, StopArrival.Arrival and Rounds.EarliestArrivals hold the latest departure from
+// a vertex instead of the earliest arrival.
+func (b *Bifrost) RouteTransitArriveBy(rounds *Rounds, destinations []SourceKey, originKey uint64, debug bool) (*fptf.Journey, error) {
+	if len(b.Data.ReverseStreetGraph) != len(b.Data.StreetGraph) {
+		return nil, fmt.Errorf("reverse street graph is not built, call RebuildReverseStreetGraph first")
+	}
+
+	err := checkDepartures(destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Now()
+
+	rounds.NewSession()
+
+	if debug {
+		fmt.Println("resetting rounds took", time.Since(t))
+		t = time.Now()
+	}
+
+	if debug {
+		fmt.Println("finding routes from", originKey)
+
+		fmt.Println("destinations:")
+		for _, dest := range destinations {
+			fmt.Println("stop", dest.StopKey, "at", dest.Departure)
+		}
+	}
+
+	lastRound := b.runTransitRoundsReverse(rounds, destinations, originKey, debug)
+
+	originKey, lastRound, ok := b.reachOrigin(rounds, originKey, lastRound)
+	if !ok {
+		return nil, NoRouteError(true)
+	}
+
+	journey, err := b.ReconstructJourneyReverse(originKey, lastRound, rounds)
+	if err != nil {
+		return nil, err
+	}
+
+	if debug {
+		dep := journey.GetDeparture()
+		arr := journey.GetArrival()
+
+		fmt.Println("Journey took", arr.Sub(dep), ". dep", dep, ", arr", arr)
+
+		fmt.Println("Journey:")
+		util.PrintJSON(journey)
+	}
+
+	return journey, nil
+}
+
+// runTransitRoundsReverse seeds the destinations into the first round and runs the backwards RAPTOR rounds. Returns
+// the last round that was reached.
+func (b *Bifrost) runTransitRoundsReverse(rounds *Rounds, destinations []SourceKey, originKey uint64, debug bool) int {
+	calcStart := time.Now()
+	t := calcStart
+
+	for _, dest := range destinations {
+		departure := timeToMs(dest.Departure)
+
+		rounds.Rounds[0].Set(dest.StopKey, StopArrival{Arrival: departure, Trip: TripIdOrigin, Vehicles: 1 << b.transitVehicle()})
+		rounds.MarkedStops.Add(dest.StopKey)
+		rounds.EarliestArrivals.Set(dest.StopKey, departure)
+	}
+
+	lastRound := 0
+
+	for k := 0; k < b.TransferLimit+1; k++ {
+		if rounds.cancelled() {
+			break
+		}
+
+		if debug {
+			fmt.Println("------ Round", k, "------")
+		}
+
+		ttsKey := k * 2
+
+		t = time.Now()
+		b.runRaptorRoundReverse(rounds, originKey, ttsKey, debug)
+
+		if debug {
+			fmt.Println("Getting trip times took", time.Since(t))
+			t = time.Now()
+		}
+
+		if k == 0 {
+			for _, dest := range destinations {
+				rounds.MarkedStops.Add(dest.StopKey)
+			}
+		}
+
+		rounds.MarkedStops.Each(rounds.MarkedStopsForTransfer.Add)
+
+		b.runTransferRoundReverse(rounds, originKey, ttsKey+1, b.transitVehicle(), false)
+
+		if debug {
+			fmt.Println("Getting transfer times took", time.Since(t))
+			fmt.Println("Marked", rounds.MarkedStops.Len(), "stops in total in round", k)
+		}
+
+		if rounds.MarkedStops.Len() == 0 {
+			break
+		}
+
+		lastRound = ttsKey + 2
+	}
+
+	if debug {
+		fmt.Println("Done in", time.Since(calcStart))
+	}
+
+	return lastRound
+}
+
+// reachOrigin is the arrive-by counterpart of reachDestination.
+func (b *Bifrost) reachOrigin(rounds *Rounds, originKey uint64, lastRound int) (uint64, int, bool) {
+	ok := rounds.EarliestArrivals.Has(originKey)
+	if !ok {
+		// add an unrestricted transfer round
+		for i := 0; i < rounds.EarliestArrivals.Len(); i++ {
+			vert, _ := rounds.EarliestArrivals.Entry(i)
+			rounds.MarkedStopsForTransfer.Add(vert)
+		}
+
+		b.runTransferRoundReverse(rounds, originKey, lastRound, b.transitVehicle(), true)
+		lastRound++
+	}
+
+	ok = rounds.EarliestArrivals.Has(originKey)
+	if !ok {
+		// look for very close, walkable vertices
+		loc := b.Data.Vertices[originKey]
+		nearest := b.Data.WalkableVertexTree.KNN(&loc, 30)
+
+		for _, point := range nearest {
+			streetVert := point.(*GeoPoint)
+
+			ok = rounds.EarliestArrivals.Has(streetVert.VertKey)
+			if !ok {
+				continue
+			}
+
+			if !b.fastDistWithin(&loc, streetVert, b.MaxStopsConnectionSeconds) {
+				break
+			}
+
+			dist := distanceMs(&loc, streetVert, b.WalkingSpeed)
+
+			if dist > b.MaxStopsConnectionSeconds {
+				break
+			}
+
+			originKey = streetVert.VertKey // replace origin with the closest reachable vertex
+			break
+		}
+	}
+
+	ok = rounds.EarliestArrivals.Has(originKey)
+	return originKey, lastRound, ok
+}
+
+func (b *Bifrost) runRaptorRoundReverse(rounds *Rounds, target uint64, current int, debug bool) {
+	t := time.Now()
+
+	round := rounds.Rounds[current]
+	next := rounds.Rounds[current+1]
+
+	for i := 0; i < round.Len(); i++ {
+		stop, stopArr := round.Entry(i)
+		next.Set(stop, StopArrival{
+			Arrival:  stopArr.Arrival,
+			Trip:     TripIdNoChange,
+			Vehicles: stopArr.Vehicles,
+		})
+	}
+
+	rounds.Queue.Reset()
+
+	// add routes to queue. routes are scanned backwards, so we need the latest marked stop of each route
+	rounds.MarkedStops.Each(func(stop uint64) {
+		for _, pair := range b.Data.StopToRoutes[stop] {
+			if !rounds.routeAllowed(b.Data.Routes[pair.Route]) {
+				continue
+			}
+
+			exit, ok := rounds.Queue.Get(uint64(pair.Route))
+			if !ok || exit < pair.StopKeyInTrip {
+				rounds.Queue.Set(uint64(pair.Route), pair.StopKeyInTrip)
+			}
+		}
+	})
+	rounds.MarkedStops.Reset()
+
+	if debug {
+		fmt.Println("adding trips to queue took", time.Since(t))
+		t = time.Now()
+
+		fmt.Println("q size", rounds.Queue.Len())
+	}
+
+	// scan routes
+	for i := 0; i < rounds.Queue.Len(); i++ {
+		key, exitKey := rounds.Queue.Entry(i)
+		routeKey := uint32(key)
+		route := b.Data.Routes[routeKey]
+
+		tripKey := uint32(0)
+		departureDay := uint32(0)
+		dayStart := uint64(0)
+		vehicles := uint8(0) // vehicles taken on board of the trip
+		var trip *Trip
+
+		for stopSeqKey := int(exitKey); stopSeqKey >= 0; stopSeqKey-- {
+			stopKey := route.Stops[stopSeqKey]
+
+			if trip != nil && b.canEnter(route, trip, tripKey, departureDay, uint32(stopSeqKey)) {
+				dep := trip.StopTimes[stopSeqKey].DepartureAt(dayStart) - b.TransferPaddingMs
+				ld, ok := rounds.EarliestArrivals.Get(stopKey)
+				targetLd, targetOk := rounds.EarliestArrivals.Get(target)
+
+				if (!ok || dep > ld) && (!targetOk || dep > targetLd) {
+					next.Set(stopKey, StopArrival{
+						Arrival:   dep,
+						Trip:      tripKey,
+						EnterKey:  uint64(stopSeqKey),
+						Departure: uint64(departureDay),
+						Vehicles:  vehicles,
+					})
+					rounds.MarkedStops.Add(stopKey)
+					rounds.EarliestArrivals.Set(stopKey, dep)
+				}
+			}
+
+			sa, ok := round.Get(stopKey)
+
+			// leaving a trip at the first stop of the route is pointless
+			if ok && stopSeqKey > 0 && (trip == nil || sa.Arrival >= trip.StopTimes[stopSeqKey].ArrivalAt(dayStart)) {
+				lt, key, depDay := b.latestTripBeforeTransfer(rounds, current, routeKey, uint32(stopSeqKey), stopKey, sa.Arrival)
+				// transfer rules may only allow an earlier trip, so keep the current trip in that case
+				if lt != nil && (trip == nil || lt.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(lt, uint64(depDay))) > trip.StopTimes[stopSeqKey].ArrivalAt(dayStart)) {
+					trip = lt
+					tripKey = key
+					departureDay = depDay
+					dayStart = b.Data.dayStart(lt, uint64(depDay))
+					vehicles = tripVehicles(lt, sa.Vehicles)
+				}
+			}
+		}
+
+		if trip != nil {
+			b.continueInSeatReverse(rounds, next, target, tripKey, departureDay, vehicles)
+		}
+	}
+
+	if debug {
+		fmt.Println("scanning trips took", time.Since(t))
+	}
+}
+
+// latestTrip finds the trip of a route arriving at stopSeqKey as late as possible, but not after maxArrival.
+// Returns the trip, its key and the day it departed on. Trips rejected by accept are skipped. Realtime updates are
+// respected, if there are any.
+func (r *RoutingData) latestTrip(routeKey uint32, stopSeqKey uint32, maxArrival uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	if r.Realtime != nil {
+		return r.latestRealtimeTrip(routeKey, stopSeqKey, maxArrival, accept)
+	}
+
+	return r.latestScheduledTrip(routeKey, stopSeqKey, maxArrival, accept)
+}
+
+// latestScheduledTrip finds the latest trip by its scheduled arrival.
+func (r *RoutingData) latestScheduledTrip(routeKey uint32, stopSeqKey uint32, maxArrival uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	first := r.Trips[r.Routes[routeKey].Trips[0]]
+	day := r.serviceDay(first, maxArrival)
+
+	var best *Trip
+	bestKey := uint32(0)
+	bestDay := uint32(0)
+	bestArrival := uint64(0)
+
+	for i := uint32(0); i <= r.MaxTripDayLength && i <= day; i++ {
+		maxArrivalInDay := maxArrival - r.dayStart(first, uint64(day-i))
+		if maxArrivalInDay > math.MaxUint32 {
+			maxArrivalInDay = math.MaxUint32
+		}
+
+		trip, key := r.latestTripInDay(routeKey, stopSeqKey, uint32(maxArrivalInDay), day-i, accept)
+		if trip == nil {
+			continue
+		}
+
+		arr := trip.StopTimes[stopSeqKey].ArrivalAt(r.dayStart(trip, uint64(day-i)))
+		if best == nil || arr > bestArrival {
+			best = trip
+			bestKey = key
+			bestDay = day - i
+			bestArrival = arr
+		}
+	}
+
+	return best, bestKey, bestDay
+}
+
+// latestTripInDay uses the departure order of the trips at stopSeqKey, which matches their arrival order unless
+// a trip overtakes another while waiting at the stop.
+func (r *RoutingData) latestTripInDay(routeKey uint32, stopSeqKey uint32, maxArrivalInDay uint32, day uint32, accept tripFilter) (*Trip, uint32) {
+	route := r.Routes[routeKey]
+	routeStopKey := uint64(routeKey)<<32 | uint64(stopSeqKey)
+
+	reorder := r.Reorders[routeStopKey]
+
+	tripKeyAt := func(i int) uint32 {
+		if reorder == nil {
+			return route.Trips[i]
+		}
+		return route.Trips[reorder[i]]
+	}
+
+	end := sort.Search(len(route.Trips), func(i int) bool {
+		return r.Trips[tripKeyAt(i)].StopTimes[stopSeqKey].Arrival > maxArrivalInDay
+	})
+
+	for i := end - 1; i >= 0; i-- {
+		tripKey := tripKeyAt(i)
+		if trip := r.tripOnDay(tripKey, day); trip != nil && accept.accepts(trip, tripKey, day) {
+			return trip, tripKey
+		}
+	}
+
+	return nil, 0
+}
@@ -0,0 +1,135 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"math"
+	"testing"
+	"time"
+)
+
+func routeArriveByTest(t *testing.T, b *Bifrost, rounds *Rounds, originKey uint64, destKey uint64, arrival time.Time) time.Time {
+	t.Helper()
+
+	journey, err := b.RouteTransitArriveBy(rounds, []SourceKey{{StopKey: destKey, Departure: arrival}}, originKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if journey.GetArrival().After(arrival) {
+		t.Fatalf("expected the journey to arrive by %v, got %v", arrival, journey.GetArrival())
+	}
+
+	return journey.GetDeparture().UTC()
+}
+
+func TestRouteTransitArriveBy(t *testing.T) {
+	b := newLineTestRouter(60 * 1000)
+	rounds := b.NewRounds()
+
+	day := time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC)
+
+	// buses leave every 5 minutes, the one at 8:20 arrives at 8:28
+	departure := routeArriveByTest(t, b, rounds, 0, 16, day.Add(8*time.Hour+30*time.Minute))
+	if !departure.Equal(day.Add(8*time.Hour + 20*time.Minute)) {
+		t.Fatalf("expected the latest departure at 8:20, got %v", departure)
+	}
+
+	// the label at the origin is the latest time to be at the stop, which includes the padding
+	latest, ok := rounds.EarliestArrivals.Get(0)
+	if !ok || latest != timeToMs(departure)-b.TransferPaddingMs {
+		t.Fatalf("expected the origin to be left %d ms before the departure, got %v", b.TransferPaddingMs, latest)
+	}
+}
+
+func TestRouteTransitArriveByTransferPadding(t *testing.T) {
+	b := newLineTestRouter(60 * 1000)
+
+	arrival := time.Date(2023, 12, 12, 9, 0, 0, 0, time.UTC)
+
+	// shortest gap before boarding a trip, the origin counts as arrived at the departure
+	minGap := func(journey *fptf.Journey) time.Duration {
+		gap := time.Duration(math.MaxInt64)
+		for i := 1; i < len(journey.Trips); i++ {
+			if transitModeOf(journey.Trips[i].Mode) == 0 {
+				continue
+			}
+
+			if g := journey.Trips[i].Departure.Sub(journey.Trips[i-1].Arrival.Time); g < gap {
+				gap = g
+			}
+		}
+		return gap
+	}
+
+	b.TransferPaddingMs = 0
+	journey, err := b.RouteTransitArriveBy(b.NewRounds(), []SourceKey{{StopKey: 288, Departure: arrival}}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without padding, the second bus leaving vertex 16 at 8:50 is reached by the one arriving at 8:48
+	unpadded := journey.GetDeparture()
+	if gap := minGap(journey); gap >= 3*time.Minute {
+		t.Fatalf("expected a transfer shorter than 3 minutes without padding, got %v", gap)
+	}
+
+	b.TransferPaddingMs = 3 * 60 * 1000
+	journey, err = b.RouteTransitArriveBy(b.NewRounds(), []SourceKey{{StopKey: 288, Departure: arrival}}, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gap := minGap(journey); gap < 3*time.Minute {
+		t.Fatalf("expected at least 3 minutes before boarding with padding, got %v", gap)
+	}
+
+	if !journey.GetDeparture().Before(unpadded) {
+		t.Fatalf("expected an earlier departure with padding than %v, got %v", unpadded, journey.GetDeparture())
+	}
+}
+
+func TestRouteTransitArriveByPreviousDay(t *testing.T) {
+	// walking is too slow to compete with the buses
+	b := newLineTestRouter(60 * 60 * 1000)
+
+	// a night bus of the first row line, that leaves at 0:30 of the next day
+	minute := uint32(60 * 1000)
+	night := &Trip{}
+	for i := range b.Data.Routes[0].Stops {
+		stopTime := 24*60*minute + 30*minute + uint32(i)*2*minute
+		night.StopTimes = append(night.StopTimes, Stopover{Arrival: stopTime, Departure: stopTime})
+	}
+
+	b.Data.Routes[0].Trips = append(b.Data.Routes[0].Trips, uint32(len(b.Data.Trips)))
+	b.Data.Trips = append(b.Data.Trips, night)
+	b.Data.TripToRoute = append(b.Data.TripToRoute, 0)
+	b.Data.TripInformation = append(b.Data.TripInformation, &TripInformation{})
+	b.Data.MaxTripDayLength = 1
+
+	day := time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC)
+
+	// no bus of the day runs that early, the night bus belongs to the service day before
+	departure := routeArriveByTest(t, b, b.NewRounds(), 0, 16, day.Add(45*time.Minute))
+	if !departure.Equal(day.Add(30 * time.Minute)) {
+		t.Fatalf("expected the night bus of the previous service day at 0:30, got %v", departure)
+	}
+}
+
+func TestRouteTransitArriveByNoRoute(t *testing.T) {
+	b := newLineTestRouter(60 * 1000)
+
+	// a vertex far away without any streets
+	b.Data.Vertices = append(b.Data.Vertices, Vertex{Latitude: 50, Longitude: 11.5})
+	b.Data.StreetGraph = append(b.Data.StreetGraph, nil)
+	b.Data.StopToRoutes = append(b.Data.StopToRoutes, nil)
+	b.Data.RebuildVertexTree()
+	b.Data.RebuildReverseStreetGraph()
+
+	originKey := uint64(len(b.Data.Vertices) - 1)
+	arrival := time.Date(2023, 12, 12, 9, 0, 0, 0, time.UTC)
+
+	_, err := b.RouteTransitArriveBy(b.NewRounds(), []SourceKey{{StopKey: 16, Departure: arrival}}, originKey, false)
+	if _, ok := err.(NoRouteError); !ok {
+		t.Fatalf("expected no route from the unconnected origin, got %v", err)
+	}
+}
@@ -48,3 +48,104 @@ func TestRaptor(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestRaptorArriveBy(t *testing.T) {
+	origin := &fptf.Location{
+		Name:      "München Hbf",
+		Longitude: 11.5596949,
+		Latitude:  48.140262,
+	}
+
+	dest := &fptf.Location{
+		Name:      "Marienplatz",
+		Longitude: 11.5757167,
+		Latitude:  48.1378071,
+	}
+
+	arrivalTime, err := time.Parse(time.RFC3339, "2023-12-12T09:00:00Z")
+	if err != nil {
+		panic(err)
+	}
+
+	journey, err := b.RouteArriveBy(r, []SourceLocation{{
+		Location:  origin,
+		Departure: arrivalTime,
+	}}, dest, ModeTransit, true)
+	if err != nil {
+		panic(err)
+	}
+
+	if journey.GetArrival().After(arrivalTime) {
+		t.Fatal("journey arrives after", arrivalTime, ":", journey.GetArrival())
+	}
+}
+
+func TestRaptorRange(t *testing.T) {
+	origin := &fptf.Location{
+		Name:      "München Hbf",
+		Longitude: 11.5596949,
+		Latitude:  48.140262,
+	}
+
+	dest := &fptf.Location{
+		Name:      "Marienplatz",
+		Longitude: 11.5757167,
+		Latitude:  48.1378071,
+	}
+
+	departureTime, err := time.Parse(time.RFC3339, "2023-12-12T08:00:00Z")
+	if err != nil {
+		panic(err)
+	}
+
+	journeys, err := b.RouteRange(r, []SourceLocation{{
+		Location:  origin,
+		Departure: departureTime,
+	}}, dest, ModeTransit, time.Hour, true)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 1; i < len(journeys); i++ {
+		if !journeys[i-1].GetArrival().Before(journeys[i].GetArrival()) {
+			t.Fatal("journey", i-1, "is dominated by journey", i)
+		}
+	}
+}
+
+func TestRaptorPareto(t *testing.T) {
+	origin := &fptf.Location{
+		Name:      "München Hbf",
+		Longitude: 11.5596949,
+		Latitude:  48.140262,
+	}
+
+	dest := &fptf.Location{
+		Name:      "Marienplatz",
+		Longitude: 11.5757167,
+		Latitude:  48.1378071,
+	}
+
+	departureTime, err := time.Parse(time.RFC3339, "2023-12-12T08:30:00Z")
+	if err != nil {
+		panic(err)
+	}
+
+	journeys, err := b.RoutePareto(r, []SourceLocation{{
+		Location:  origin,
+		Departure: departureTime,
+	}}, dest, ModeTransit, true)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 1; i < len(journeys); i++ {
+		if journeyTransfers(journeys[i-1]) >= journeyTransfers(journeys[i]) {
+			t.Fatal("journey", i, "does not need more transfers than journey", i-1)
+		}
+
+		if !journeys[i].GetArrival().Before(journeys[i-1].GetArrival()) {
+			t.Fatal("journey", i, "is dominated by journey", i-1)
+		}
+	}
+}
@@ -0,0 +1,604 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/Vector-Hector/fptf"
+	"math"
+	"sort"
+	"time"
+)
+
+// Realtime is an overlay of GTFS-RT TripUpdates over the timetable of a RoutingData. It is never changed after it
+// was read, so a newer one can be read while queries still use the old one. See RoutingData.WithRealtime.
+type Realtime struct {
+	Timestamp  uint64                   // header timestamp of the feed in unix ms
+	Trips      map[uint64]*RealtimeTrip // trip key << 32 | day -> updated trip
+	Added      map[uint32][]uint32      // route key -> keys of added trips
+	AddedTrips []*RealtimeTrip          // added trips, the key of the first one is len(RoutingData.Trips)
+	MaxDelayMs uint32                   // largest delay, trips scheduled this long before a departure may still be caught
+	MaxEarlyMs uint32                   // largest time a trip runs ahead of schedule, so trips scheduled this long after a departure may leave before it
+}
+
+// RealtimeTrip is a trip on a specific day, as described by a TripUpdate.
+type RealtimeTrip struct {
+	Trip      *Trip  // stop times including the delays, skipped stops may neither be entered nor left
+	Day       uint32 // day the trip departs on
+	Cancelled bool
+	Skipped   []bool // stop sequence key -> stop is skipped
+
+	Route       uint32           // route key, only set for added trips
+	Information *TripInformation // only set for added trips
+}
+
+// RealtimeMeta is set as the meta of legs and stopovers, that are cancelled or that service alerts inform about.
+type RealtimeMeta struct {
+	Cancelled bool     `json:"cancelled,omitempty"`
+	Alerts    []*Alert `json:"alerts,omitempty"`
+}
+
+// WithRealtime returns a shallow copy of the routing data, that uses the realtime overlay. Queries running on the
+// original data are not affected. Pass nil to use the timetable only.
+func (r *RoutingData) WithRealtime(realtime *Realtime) *RoutingData {
+	data := *r
+	data.Realtime = realtime
+	return &data
+}
+
+// ReadTripUpdates reads a GTFS-RT feed of TripUpdates from a file or a http(s) url. Use RoutingData.WithRealtime to
+// route with it. feedId is the id of the gtfs feed the updates refer to, as given to AddGtfs.
+func (b *Bifrost) ReadTripUpdates(source string, feedId string) (*Realtime, error) {
+	data, err := readRealtimeSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading trip updates: %w", err)
+	}
+
+	return b.Data.ParseTripUpdates(data, feedId)
+}
+
+// ParseTripUpdates builds a realtime overlay from a protobuf encoded GTFS-RT feed. Stop time updates are matched to
+// the stops of the trip by stop_id. Delays are propagated to the following stops, until the next update. Added trips
+// are only used, if their stops match a stop sequence of their route.
+func (r *RoutingData) ParseTripUpdates(data []byte, feedId string) (*Realtime, error) {
+	feed, err := decodeFeedMessage(data, feedId)
+	if err != nil {
+		return nil, err
+	}
+
+	realtime := &Realtime{
+		Timestamp: feed.Timestamp * 1000,
+		Trips:     make(map[uint64]*RealtimeTrip),
+		Added:     make(map[uint32][]uint32),
+	}
+
+	if realtime.Timestamp == 0 {
+		realtime.Timestamp = uint64(time.Now().UnixMilli())
+	}
+
+	tripsIndex := make(map[string][]uint32, len(r.TripInformation))
+	for tripKey, info := range r.TripInformation {
+		tripsIndex[info.TripId] = append(tripsIndex[info.TripId], uint32(tripKey))
+	}
+
+	skipped := 0
+
+	for _, entity := range feed.Entities {
+		update := entity.TripUpdate
+		if entity.IsDeleted || update == nil {
+			continue
+		}
+
+		switch update.Trip.ScheduleRelationship {
+		case rtTripAdded, rtTripNew:
+			if !r.addRealtimeTrip(realtime, update) {
+				skipped++
+			}
+			continue
+		}
+
+		tripKey, day, ok := r.matchTripDescriptor(tripsIndex, &update.Trip, realtime.Timestamp)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		rt := &RealtimeTrip{
+			Day: day,
+		}
+
+		switch update.Trip.ScheduleRelationship {
+		case rtTripCanceled, rtTripDeleted:
+			rt.Cancelled = true
+		default:
+			rt.Trip, rt.Skipped = r.applyTripUpdate(realtime, tripKey, day, update)
+		}
+
+		realtime.Trips[uint64(tripKey)<<32|uint64(day)] = rt
+	}
+
+	fmt.Println("Applied", len(realtime.Trips), "trip updates and", len(realtime.AddedTrips), "added trips, skipped", skipped)
+
+	return realtime, nil
+}
+
+// matchTripDescriptor finds the key and the day of the trip a TripUpdate refers to. Frequency based trips share
+// their trip id and are told apart by their start time. Without a start date, the trip is looked up on the days
+// before the timestamp of the feed.
+func (r *RoutingData) matchTripDescriptor(tripsIndex map[string][]uint32, descriptor *rtTripDescriptor, timestamp uint64) (uint32, uint32, bool) {
+	keys := tripsIndex[descriptor.TripId]
+	if len(keys) == 0 {
+		return 0, 0, false
+	}
+
+	tripKey := keys[0]
+	if descriptor.StartTime != "" {
+		start, err := timeStringToMs(descriptor.StartTime)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		for _, key := range keys {
+			if r.Trips[key].StopTimes[0].Departure == start {
+				tripKey = key
+				break
+			}
+		}
+	}
+
+	if descriptor.StartDate != "" {
+		date, err := time.Parse("20060102", descriptor.StartDate)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		return tripKey, uint32(date.Unix() / int64(DayInMs/1000)), true
+	}
+
+	day := r.serviceDay(r.Trips[tripKey], timestamp)
+	for i := uint32(0); i <= r.MaxTripDayLength && i <= day; i++ {
+		if r.tripRunsOnDay(r.Trips[tripKey], day-i) {
+			return tripKey, day - i, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// applyTripUpdate returns the stop times of a trip with the delays of a TripUpdate and the stops it skips.
+func (r *RoutingData) applyTripUpdate(realtime *Realtime, tripKey uint32, day uint32, update *rtTripUpdate) (*Trip, []bool) {
+	static := r.Trips[tripKey]
+	route := r.Routes[r.TripToRoute[tripKey]]
+
+	trip := *static
+	trip.StopTimes = make([]Stopover, len(static.StopTimes))
+	copy(trip.StopTimes, static.StopTimes)
+
+	skipped := make([]bool, len(trip.StopTimes))
+
+	delay := int64(0)
+	if update.HasDelay {
+		delay = int64(update.Delay) * 1000
+	}
+
+	// updates are ordered by stop sequence, so each one is matched to the next stop with its stop id
+	updates := make([]*rtStopTimeUpdate, len(trip.StopTimes))
+	nextKey := 0
+	for _, stopTimeUpdate := range update.StopTimeUpdates {
+		for i := nextKey; i < len(route.Stops); i++ {
+			if r.stopMatches(route.Stops[i], stopTimeUpdate.StopId) {
+				updates[i] = stopTimeUpdate
+				nextKey = i + 1
+				break
+			}
+		}
+	}
+
+	dayStart := int64(r.dayStart(static, uint64(day)))
+
+	for i := range trip.StopTimes {
+		stopTime := &trip.StopTimes[i]
+		stopTimeUpdate := updates[i]
+
+		if stopTimeUpdate != nil {
+			switch stopTimeUpdate.ScheduleRelationship {
+			case rtStopSkipped:
+				skipped[i] = true
+				stopTime.Pickup = StopTypeNone
+				stopTime.DropOff = StopTypeNone
+				stopTime.Arrival = shiftStopTime(stopTime.Arrival, delay)
+				stopTime.Departure = shiftStopTime(stopTime.Departure, delay)
+				continue
+			case rtStopNoData:
+				delay = 0
+				continue
+			}
+		}
+
+		arrivalDelay := delay
+		if stopTimeUpdate != nil && stopTimeUpdate.Arrival != nil {
+			arrivalDelay = eventDelay(stopTimeUpdate.Arrival, int64(stopTime.Arrival)+dayStart, delay)
+		}
+
+		departureDelay := arrivalDelay
+		if stopTimeUpdate != nil && stopTimeUpdate.Departure != nil {
+			departureDelay = eventDelay(stopTimeUpdate.Departure, int64(stopTime.Departure)+dayStart, arrivalDelay)
+		}
+
+		stopTime.Arrival = shiftStopTime(stopTime.Arrival, arrivalDelay)
+		stopTime.Departure = shiftStopTime(stopTime.Departure, departureDelay)
+		if stopTime.Departure < stopTime.Arrival {
+			stopTime.Departure = stopTime.Arrival
+		}
+
+		realtime.addDelay(arrivalDelay)
+		realtime.addDelay(departureDelay)
+		delay = departureDelay
+	}
+
+	return &trip, skipped
+}
+
+// addRealtimeTrip adds a trip, that is not part of the timetable. Its stop time updates must contain the absolute
+// times of all stops. Returns false, if the trip could not be matched to a route.
+func (r *RoutingData) addRealtimeTrip(realtime *Realtime, update *rtTripUpdate) bool {
+	if update.Trip.StartDate == "" {
+		return false
+	}
+
+	date, err := time.Parse("20060102", update.Trip.StartDate)
+	if err != nil {
+		return false
+	}
+
+	day := uint32(date.Unix() / int64(DayInMs/1000))
+
+	stops := make([]uint64, 0, len(update.StopTimeUpdates))
+	times := make([]int64, 0, 2*len(update.StopTimeUpdates)) // arrival and departure of each stop in unix ms
+
+	for _, stopTimeUpdate := range update.StopTimeUpdates {
+		stop, ok := r.StopsIndex[stopTimeUpdate.StopId]
+		if !ok || stopTimeUpdate.ScheduleRelationship == rtStopSkipped {
+			return false
+		}
+
+		arrival, departure := stopTimeUpdate.Arrival, stopTimeUpdate.Departure
+		if arrival == nil || !arrival.HasTime {
+			arrival = departure
+		}
+		if departure == nil || !departure.HasTime {
+			departure = arrival
+		}
+		if arrival == nil || !arrival.HasTime {
+			return false
+		}
+
+		stops = append(stops, stop)
+		times = append(times, arrival.Time*1000, departure.Time*1000)
+	}
+
+	routeKey, ok := r.findRoute(update.Trip.RouteId, stops)
+	if !ok {
+		return false
+	}
+
+	// the added trip runs in the timezone of the other trips of its route
+	trip := &Trip{
+		Service:   r.Trips[r.Routes[routeKey].Trips[0]].Service,
+		StopTimes: make([]Stopover, len(stops)),
+	}
+
+	dayStart := int64(r.dayStart(trip, uint64(day)))
+	for i := range trip.StopTimes {
+		trip.StopTimes[i].Arrival = uint32(times[2*i] - dayStart)
+		trip.StopTimes[i].Departure = uint32(times[2*i+1] - dayStart)
+	}
+
+	tripKey := uint32(len(r.Trips) + len(realtime.AddedTrips))
+
+	realtime.AddedTrips = append(realtime.AddedTrips, &RealtimeTrip{
+		Trip:    trip,
+		Day:     day,
+		Skipped: make([]bool, len(trip.StopTimes)),
+		Route:   routeKey,
+		Information: &TripInformation{
+			TripId: update.Trip.TripId,
+		},
+	})
+	realtime.Added[routeKey] = append(realtime.Added[routeKey], tripKey)
+
+	return true
+}
+
+// findRoute returns the key of the route with the gtfs route id and the stop sequence.
+func (r *RoutingData) findRoute(gtfsRouteId string, stops []uint64) (uint32, bool) {
+	for routeKey, route := range r.Routes {
+		if len(route.Stops) != len(stops) || r.RouteInformation[r.GtfsRouteIndex[routeKey]].RouteId != gtfsRouteId {
+			continue
+		}
+
+		matches := true
+		for i, stop := range route.Stops {
+			if stop != stops[i] {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return uint32(routeKey), true
+		}
+	}
+
+	return 0, false
+}
+
+// stopMatches returns true, if the stop vertex has the gtfs stop id.
+func (r *RoutingData) stopMatches(stop uint64, stopId string) bool {
+	stopCtx := r.Vertices[stop].Stop
+	return stopCtx != nil && stopCtx.Id == stopId
+}
+
+// eventDelay returns the delay in ms of a stop time event. Events without delay or time keep the propagated delay.
+func eventDelay(event *rtStopTimeEvent, scheduled int64, propagated int64) int64 {
+	if event.HasTime {
+		return event.Time*1000 - scheduled
+	}
+
+	if event.HasDelay {
+		return int64(event.Delay) * 1000
+	}
+
+	return propagated
+}
+
+func shiftStopTime(stopTime uint32, delay int64) uint32 {
+	shifted := int64(stopTime) + delay
+	if shifted < 0 {
+		return 0
+	}
+	return uint32(shifted)
+}
+
+func (rt *Realtime) addDelay(delay int64) {
+	if delay > int64(rt.MaxDelayMs) {
+		rt.MaxDelayMs = uint32(delay)
+	}
+
+	if -delay > int64(rt.MaxEarlyMs) {
+		rt.MaxEarlyMs = uint32(-delay)
+	}
+}
+
+// realtimeTrip returns the update of a trip on a day or nil, if there is none.
+func (r *RoutingData) realtimeTrip(tripKey uint32, day uint32) *RealtimeTrip {
+	if r.Realtime == nil {
+		return nil
+	}
+
+	if tripKey >= uint32(len(r.Trips)) {
+		added := r.Realtime.AddedTrips[tripKey-uint32(len(r.Trips))]
+		if added.Day != day {
+			return nil
+		}
+		return added
+	}
+
+	return r.Realtime.Trips[uint64(tripKey)<<32|uint64(day)]
+}
+
+// tripOnDay returns the trip as it runs on the day, including realtime updates. Returns nil, if the trip does not run
+// on the day or is cancelled.
+func (r *RoutingData) tripOnDay(tripKey uint32, day uint32) *Trip {
+	if rt := r.realtimeTrip(tripKey, day); rt != nil {
+		if rt.Cancelled {
+			return nil
+		}
+		return rt.Trip
+	}
+
+	if tripKey >= uint32(len(r.Trips)) {
+		return nil
+	}
+
+	trip := r.Trips[tripKey]
+	if !r.tripRunsOnDay(trip, day) {
+		return nil
+	}
+
+	return trip
+}
+
+// tripAt returns the stop times of a trip on a day, including realtime updates, without checking whether it runs.
+func (r *RoutingData) tripAt(tripKey uint32, day uint32) *Trip {
+	if rt := r.realtimeTrip(tripKey, day); rt != nil && rt.Trip != nil {
+		return rt.Trip
+	}
+
+	return r.Trips[tripKey]
+}
+
+// tripRoute returns the route key of a trip, including added trips.
+func (r *RoutingData) tripRoute(tripKey uint32) uint32 {
+	if tripKey >= uint32(len(r.Trips)) {
+		return r.Realtime.AddedTrips[tripKey-uint32(len(r.Trips))].Route
+	}
+
+	return r.TripToRoute[tripKey]
+}
+
+// tripInformation returns the gtfs information of a trip, including added trips.
+func (r *RoutingData) tripInformation(tripKey uint32) *TripInformation {
+	if tripKey >= uint32(len(r.Trips)) {
+		return r.Realtime.AddedTrips[tripKey-uint32(len(r.Trips))].Information
+	}
+
+	return r.TripInformation[tripKey]
+}
+
+// earliestRealtimeTrip is earliestTrip for routing data with a realtime overlay. Trips scheduled up to MaxDelayMs
+// before minDeparture may still depart after it and trips scheduled up to MaxEarlyMs after the best departure may
+// still depart before it, so all trips in between are scanned for the one actually departing first. Added trips of
+// the route are considered as well.
+func (r *RoutingData) earliestRealtimeTrip(routeKey uint32, stopSeqKey uint32, minDeparture uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	search := uint64(0)
+	if minDeparture > uint64(r.Realtime.MaxDelayMs) {
+		search = minDeparture - uint64(r.Realtime.MaxDelayMs)
+	}
+
+	var best *Trip
+	bestKey := uint32(0)
+	bestDay := uint32(0)
+	bestDeparture := uint64(0)
+
+	route := r.Routes[routeKey]
+	first := r.Trips[route.Trips[0]]
+	tripKeyAt := r.tripOrder(routeKey, stopSeqKey)
+	day := r.serviceDay(first, search)
+
+	for i := uint32(0); i <= r.MaxTripDayLength && i <= day; i++ {
+		dayStart := r.dayStart(first, uint64(day-i))
+
+		searchInDay := uint64(0)
+		if search > dayStart {
+			searchInDay = search - dayStart
+		}
+		if searchInDay > math.MaxUint32 {
+			continue
+		}
+
+		start := sort.Search(len(route.Trips), func(j int) bool {
+			return r.Trips[tripKeyAt(j)].StopTimes[stopSeqKey].Departure >= uint32(searchInDay)
+		})
+
+		for j := start; j < len(route.Trips); j++ {
+			key := tripKeyAt(j)
+
+			scheduled := r.Trips[key].StopTimes[stopSeqKey].DepartureAt(dayStart)
+			if best != nil && scheduled >= bestDeparture+uint64(r.Realtime.MaxEarlyMs) {
+				break // later trips do not run early enough to depart first
+			}
+
+			trip := r.tripOnDay(key, day-i)
+			if trip == nil || !accept.accepts(trip, key, day-i) {
+				continue
+			}
+
+			dep := trip.StopTimes[stopSeqKey].DepartureAt(dayStart)
+			if dep >= minDeparture && (best == nil || dep < bestDeparture) {
+				best, bestKey, bestDay, bestDeparture = trip, key, day-i, dep
+			}
+		}
+	}
+
+	for _, key := range r.Realtime.Added[routeKey] {
+		added := r.Realtime.AddedTrips[key-uint32(len(r.Trips))]
+
+		if !accept.accepts(added.Trip, key, added.Day) {
+			continue
+		}
+
+		dep := added.Trip.StopTimes[stopSeqKey].DepartureAt(r.dayStart(added.Trip, uint64(added.Day)))
+		if dep >= minDeparture && (best == nil || dep < bestDeparture) {
+			best, bestKey, bestDay, bestDeparture = added.Trip, key, added.Day, dep
+		}
+	}
+
+	return best, bestKey, bestDay
+}
+
+// latestRealtimeTrip is latestTrip for routing data with a realtime overlay. Like earliestRealtimeTrip, all trips
+// scheduled between MaxDelayMs before the best arrival and MaxEarlyMs after maxArrival are scanned for the one
+// actually arriving last. Added trips of the route are considered as well.
+func (r *RoutingData) latestRealtimeTrip(routeKey uint32, stopSeqKey uint32, maxArrival uint64, accept tripFilter) (*Trip, uint32, uint32) {
+	search := maxArrival + uint64(r.Realtime.MaxEarlyMs)
+
+	var best *Trip
+	bestKey := uint32(0)
+	bestDay := uint32(0)
+	bestArrival := uint64(0)
+
+	route := r.Routes[routeKey]
+	first := r.Trips[route.Trips[0]]
+	tripKeyAt := r.tripOrder(routeKey, stopSeqKey)
+	day := r.serviceDay(first, search)
+
+	for i := uint32(0); i <= r.MaxTripDayLength && i <= day; i++ {
+		dayStart := r.dayStart(first, uint64(day-i))
+		if search < dayStart {
+			continue
+		}
+
+		searchInDay := search - dayStart
+		if searchInDay > math.MaxUint32 {
+			searchInDay = math.MaxUint32
+		}
+
+		end := sort.Search(len(route.Trips), func(j int) bool {
+			return r.Trips[tripKeyAt(j)].StopTimes[stopSeqKey].Arrival > uint32(searchInDay)
+		})
+
+		for j := end - 1; j >= 0; j-- {
+			key := tripKeyAt(j)
+
+			scheduled := r.Trips[key].StopTimes[stopSeqKey].ArrivalAt(dayStart)
+			if best != nil && scheduled+uint64(r.Realtime.MaxDelayMs) <= bestArrival {
+				break // earlier trips are not delayed enough to arrive last
+			}
+
+			trip := r.tripOnDay(key, day-i)
+			if trip == nil || !accept.accepts(trip, key, day-i) {
+				continue
+			}
+
+			arr := trip.StopTimes[stopSeqKey].ArrivalAt(dayStart)
+			if arr <= maxArrival && (best == nil || arr > bestArrival) {
+				best, bestKey, bestDay, bestArrival = trip, key, day-i, arr
+			}
+		}
+	}
+
+	for _, key := range r.Realtime.Added[routeKey] {
+		added := r.Realtime.AddedTrips[key-uint32(len(r.Trips))]
+
+		if !accept.accepts(added.Trip, key, added.Day) {
+			continue
+		}
+
+		arr := added.Trip.StopTimes[stopSeqKey].ArrivalAt(r.dayStart(added.Trip, uint64(added.Day)))
+		if arr <= maxArrival && (best == nil || arr > bestArrival) {
+			best, bestKey, bestDay, bestArrival = added.Trip, key, added.Day, arr
+		}
+	}
+
+	return best, bestKey, bestDay
+}
+
+// tripOrder returns the key of the i-th trip of the route in the order of their scheduled departure at stopSeqKey.
+func (r *RoutingData) tripOrder(routeKey uint32, stopSeqKey uint32) func(i int) uint32 {
+	route := r.Routes[routeKey]
+	reorder := r.Reorders[uint64(routeKey)<<32|uint64(stopSeqKey)]
+
+	return func(i int) uint32 {
+		if reorder == nil {
+			return route.Trips[i]
+		}
+		return route.Trips[reorder[i]]
+	}
+}
+
+// setRealtimeDelays sets the delays in seconds of a stopover of an updated trip and marks skipped stops as cancelled.
+// Added trips have no delays, as there is no schedule to compare them to.
+func (r *RoutingData) setRealtimeDelays(stopover *fptf.Stopover, rt *RealtimeTrip, tripKey uint32, stopSeqKey int) {
+	if rt.Skipped != nil && rt.Skipped[stopSeqKey] {
+		stopover.Meta = &RealtimeMeta{Cancelled: true}
+	}
+
+	if tripKey >= uint32(len(r.Trips)) || rt.Trip == nil {
+		return
+	}
+
+	scheduled := r.Trips[tripKey].StopTimes[stopSeqKey]
+	actual := rt.Trip.StopTimes[stopSeqKey]
+
+	stopover.ArrivalDelay = fptf.Delay((int(actual.Arrival) - int(scheduled.Arrival)) / 1000)
+	stopover.DepartureDelay = fptf.Delay((int(actual.Departure) - int(scheduled.Departure)) / 1000)
+}
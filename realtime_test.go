@@ -0,0 +1,169 @@
+package bifrost
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"testing"
+	"time"
+)
+
+func appendField(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func tripUpdateEntity(tripId string, startDate string, relationship uint64, stopTimeUpdates ...[]byte) []byte {
+	descriptor := appendField(nil, 1, []byte(tripId))
+	descriptor = appendField(descriptor, 3, []byte(startDate))
+	descriptor = appendVarintField(descriptor, 4, relationship)
+
+	update := appendField(nil, 1, descriptor)
+	for _, stopTimeUpdate := range stopTimeUpdates {
+		update = appendField(update, 2, stopTimeUpdate)
+	}
+
+	entity := appendField(nil, 1, []byte(tripId))
+	return appendField(entity, 3, update)
+}
+
+func newRealtimeTestData() *RoutingData {
+	hour := uint32(60 * 60 * 1000)
+	minute := uint32(60 * 1000)
+
+	return &RoutingData{
+		MaxTripDayLength: 0,
+		Services:         []*Service{{Weekdays: 0x7f, StartDay: 0, EndDay: 100000}},
+		Routes:           []*Route{{Stops: []uint64{0, 1, 2}, Trips: []uint32{0, 1}}},
+		Trips: []*Trip{
+			{StopTimes: []Stopover{{Arrival: 8 * hour, Departure: 8 * hour}, {Arrival: 8*hour + 10*minute, Departure: 8*hour + 10*minute}, {Arrival: 8*hour + 20*minute, Departure: 8*hour + 20*minute}}},
+			{StopTimes: []Stopover{{Arrival: 8*hour + 5*minute, Departure: 8*hour + 5*minute}, {Arrival: 8*hour + 15*minute, Departure: 8*hour + 15*minute}, {Arrival: 8*hour + 25*minute, Departure: 8*hour + 25*minute}}},
+		},
+		Vertices: []Vertex{
+			{Stop: &StopContext{Id: "a"}},
+			{Stop: &StopContext{Id: "b"}},
+			{Stop: &StopContext{Id: "c"}},
+		},
+		StopsIndex:       map[string]uint64{"a": 0, "b": 1, "c": 2},
+		GtfsRouteIndex:   []uint32{0},
+		RouteInformation: []*RouteInformation{{RouteId: "r", Type: 3}},
+		TripInformation:  []*TripInformation{{TripId: "t0"}, {TripId: "t1"}},
+		TripToRoute:      []uint32{0, 0},
+	}
+}
+
+func TestParseTripUpdates(t *testing.T) {
+	data := newRealtimeTestData()
+
+	day := uint32(19000)
+	startDate := time.UnixMilli(int64(day) * int64(DayInMs)).UTC().Format("20060102")
+
+	delayed := appendField(nil, 4, []byte("b"))
+	delayed = appendField(delayed, 2, appendVarintField(nil, 1, 600))
+
+	feed := appendField(nil, 2, tripUpdateEntity("t0", startDate, rtTripScheduled, delayed))
+	feed = appendField(feed, 2, tripUpdateEntity("t1", startDate, rtTripCanceled))
+
+	realtime, err := data.ParseTripUpdates(feed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(realtime.Trips) != 2 || realtime.MaxDelayMs != 600000 {
+		t.Fatalf("expected two updated trips delayed by up to 10 minutes, got %d trips and %d ms", len(realtime.Trips), realtime.MaxDelayMs)
+	}
+
+	data = data.WithRealtime(realtime)
+
+	if data.tripOnDay(1, day) != nil {
+		t.Fatal("expected cancelled trip not to run")
+	}
+
+	// the trip scheduled at 8:10 departs at 8:20 and the one scheduled at 8:15 is cancelled
+	minDeparture := uint64(day)*uint64(DayInMs) + uint64(8*60+12)*60*1000
+	trip, tripKey, _ := data.earliestTrip(0, 1, minDeparture, nil)
+	if trip == nil || tripKey != 0 {
+		t.Fatalf("expected delayed trip 0, got %d", tripKey)
+	}
+
+	if trip.StopTimes[0].Departure != data.Trips[0].StopTimes[0].Departure {
+		t.Fatal("expected no delay before the first updated stop")
+	}
+
+	leg := data.getTransitTrip(0, 1, 2, uint64(day))
+	if leg.DepartureDelay == nil || *leg.DepartureDelay != 600 || leg.ArrivalDelay == nil || *leg.ArrivalDelay != 600 {
+		t.Fatalf("expected delay to be propagated to the last stop, got %+v", leg)
+	}
+}
+
+// withShiftedTrips returns the test data with a realtime overlay, that shifts trip 0 and 1 on the day by the delays.
+func withShiftedTrips(data *RoutingData, day uint32, delays ...int64) *RoutingData {
+	realtime := &Realtime{Trips: make(map[uint64]*RealtimeTrip)}
+
+	for tripKey, delay := range delays {
+		shifted := &Trip{}
+		for _, stopTime := range data.Trips[tripKey].StopTimes {
+			shifted.StopTimes = append(shifted.StopTimes, Stopover{
+				Arrival:   shiftStopTime(stopTime.Arrival, delay),
+				Departure: shiftStopTime(stopTime.Departure, delay),
+			})
+		}
+
+		realtime.Trips[uint64(tripKey)<<32|uint64(day)] = &RealtimeTrip{Trip: shifted, Day: day}
+		realtime.addDelay(delay)
+	}
+
+	return data.WithRealtime(realtime)
+}
+
+func TestRealtimeTripsWithEqualSchedule(t *testing.T) {
+	data := newRealtimeTestData()
+	data.Trips[1].StopTimes = append([]Stopover{}, data.Trips[0].StopTimes...)
+
+	day := uint32(19000)
+	minute := uint64(60 * 1000)
+	dayStart := uint64(day) * uint64(DayInMs)
+
+	// both trips are scheduled at 8:00, the first one in the order of the route is delayed by 30 minutes
+	data = withShiftedTrips(data, day, int64(30*minute), 0)
+
+	_, tripKey, _ := data.earliestTrip(0, 0, dayStart+7*60*minute, nil)
+	if tripKey != 1 {
+		t.Fatalf("expected the trip on time with the same schedule, got trip %d", tripKey)
+	}
+
+	// leaving at 8:10, the delayed trip arrives last
+	_, tripKey, _ = data.latestTrip(0, 1, dayStart+8*60*minute+45*minute, nil)
+	if tripKey != 0 {
+		t.Fatalf("expected the delayed trip with the same schedule, got trip %d", tripKey)
+	}
+}
+
+func TestRealtimeTripRunningEarly(t *testing.T) {
+	data := newRealtimeTestData()
+
+	day := uint32(19000)
+	minute := uint64(60 * 1000)
+	dayStart := uint64(day) * uint64(DayInMs)
+
+	// the trip scheduled at 8:05 runs 10 minutes early and leaves before the one at 8:00
+	data = withShiftedTrips(data, day, 0, -int64(10*minute))
+
+	if data.Realtime.MaxEarlyMs != uint32(10*minute) {
+		t.Fatalf("expected trips to run up to 10 minutes early, got %d ms", data.Realtime.MaxEarlyMs)
+	}
+
+	trip, tripKey, _ := data.earliestTrip(0, 0, dayStart+7*60*minute+50*minute, nil)
+	if tripKey != 1 || trip.StopTimes[0].Departure != uint32(7*60*minute+55*minute) {
+		t.Fatalf("expected the early trip leaving at 7:55, got trip %d", tripKey)
+	}
+
+	// it arrives at 8:05 at the second stop, the trip on time at 8:10
+	_, tripKey, _ = data.latestTrip(0, 1, dayStart+8*60*minute+5*minute, nil)
+	if tripKey != 1 {
+		t.Fatalf("expected the early trip scheduled after the latest arrival, got trip %d", tripKey)
+	}
+}
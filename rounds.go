@@ -1,27 +1,106 @@
 package bifrost
 
+import "context"
+
+// cancelCheckInterval is the number of vertices a dijkstra search settles between checks of the context.
+const cancelCheckInterval = 1024
+
+// Round holds the labels of the vertices reached in a round of the search, keyed by vertex.
+type Round = IndexMap[StopArrival]
+
+// Rounds holds the state of a search. Labels, markings and queue are stored densely by vertex or route, so they are
+// reused by the next search without clearing more than the entries of the previous one.
 type Rounds struct {
-	Rounds                 []map[uint64]StopArrival
-	MarkedStops            map[uint64]bool
-	MarkedStopsForTransfer map[uint64]bool
-	EarliestArrivals       map[uint64]uint64
-	Queue                  map[uint32]uint32
+	Rounds                 []*Round
+	SharedRounds           []*Round // labels of rides on shared vehicles, per round
+	MarkedStops            *VertexSet
+	MarkedStopsForTransfer *VertexSet
+	EarliestArrivals       *IndexMap[uint64]
+	Queue                  *IndexMap[uint32] // route -> stop sequence key, at which the route is scanned from
+
+	street *streetSearch // queue and nodes of the street searches, reused by every transfer round
+
+	TransitModes TransitMode // transit modes the query may use, 0 allows all
+	Access       *Round      // labels of the drive or cycle to the first stop, nil if transit is reached on foot
+	Egress       *Round      // labels of the backwards drive from the destination, nil if it is reached on foot
+
+	accessSearch *Rounds // rounds of the street search to the first stop, reused by later searches
+	egressSearch *Rounds // rounds of the street search from the destination, reused by later searches
+
+	ctx context.Context // cancels the search, nil outside of RouteContext and its counterparts
 }
 
 func (b *Bifrost) NewRounds() *Rounds {
-	rounds := make([]map[uint64]StopArrival, (b.TransferLimit+1)*2+2)
+	vertices, routes := 0, 0
+	if b.Data != nil {
+		vertices, routes = len(b.Data.Vertices), len(b.Data.Routes)
+	}
+
+	rounds := make([]*Round, (b.TransferLimit+1)*2+2)
+	sharedRounds := make([]*Round, len(rounds))
 
 	for i := range rounds {
-		rounds[i] = make(map[uint64]StopArrival)
+		rounds[i] = newIndexMap[StopArrival](vertices)
+		sharedRounds[i] = newIndexMap[StopArrival](vertices)
 	}
 
 	return &Rounds{
 		Rounds:                 rounds,
-		MarkedStops:            make(map[uint64]bool),
-		MarkedStopsForTransfer: make(map[uint64]bool),
-		EarliestArrivals:       make(map[uint64]uint64),
-		Queue:                  make(map[uint32]uint32, 10000),
+		SharedRounds:           sharedRounds,
+		MarkedStops:            newVertexSet(vertices),
+		MarkedStopsForTransfer: newVertexSet(vertices),
+		EarliestArrivals:       newIndexMap[uint64](vertices),
+		Queue:                  newIndexMap[uint32](routes),
+		street:                 newStreetSearch(vertices),
+	}
+}
+
+// cancelled returns true, if the context of the search is done. The search then stops early and its result is
+// discarded.
+func (r *Rounds) cancelled() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+// searchRounds returns empty rounds for a street search, that runs as part of the search of r, like the drive to the
+// first stop. They are kept in search to be reused by the next search of r and are cancelled together with r.
+func (b *Bifrost) searchRounds(r *Rounds, search **Rounds) *Rounds {
+	if *search == nil {
+		*search = b.NewRounds()
+	}
+
+	rounds := *search
+	rounds.NewSession()
+	rounds.ctx = r.ctx
+	return rounds
+}
+
+// searchWithContext runs the search, that uses rounds, until it finishes or ctx is done. Returns the error of ctx in
+// the latter case.
+func searchWithContext[T any](ctx context.Context, rounds *Rounds, search func() (T, error)) (T, error) {
+	var cancelled T
+
+	err := ctx.Err()
+	if err != nil {
+		return cancelled, err
+	}
+
+	rounds.ctx = ctx
+	defer func() {
+		rounds.ctx = nil
+	}()
+
+	result, err := search()
+
+	if ctx.Err() != nil {
+		return cancelled, ctx.Err()
 	}
+
+	return result, err
+}
+
+// routeAllowed returns true, if the mode of the route may be used in the query.
+func (r *Rounds) routeAllowed(route *Route) bool {
+	return r.TransitModes == 0 || route.Mode&r.TransitModes != 0
 }
 
 type StopArrival struct {
@@ -34,54 +113,22 @@ type StopArrival struct {
 
 	TransferTime uint32 // time in ms to walk or cycle to this stop from the previous stop
 	Vehicles     uint8  // bitmask of vehicles available at this stop
+	InSeat       bool   // the trip was entered (left in reverse searches) by staying seated in the vehicle of the block
 }
 
 func (r *Rounds) NewSession() {
 	r.ResetRounds()
 
-	for i := range r.MarkedStops {
-		//r.MarkedStops[i] = false
-		delete(r.MarkedStops, i)
-	}
-
-	for i := range r.MarkedStopsForTransfer {
-		//r.MarkedStopsForTransfer[i] = false
-		delete(r.MarkedStopsForTransfer, i)
-	}
-
-	for i := range r.EarliestArrivals {
-		//r.EarliestArrivals[i] = ArrivalTimeNotReached
-		delete(r.EarliestArrivals, i)
-	}
-
-	for k := range r.Queue {
-		delete(r.Queue, k)
-	}
+	r.MarkedStops.Reset()
+	r.MarkedStopsForTransfer.Reset()
+	r.EarliestArrivals.Reset()
+	r.Queue.Reset()
 }
 
+// ResetRounds removes the labels of all rounds. It takes time in the number of labels, not in the number of vertices.
 func (r *Rounds) ResetRounds() {
-	done := make(chan bool)
-
-	maxThreads := 12
-
-	free := make(chan bool, maxThreads)
-
-	for i := 0; i < maxThreads; i++ {
-		free <- true
-	}
-
 	for i := range r.Rounds {
-		go func(i int) {
-			<-free
-			for k := range r.Rounds[i] {
-				delete(r.Rounds[i], k)
-			}
-			done <- true
-			free <- true
-		}(i)
-	}
-
-	for i := 0; i < len(r.Rounds); i++ {
-		<-done
+		r.Rounds[i].Reset()
+		r.SharedRounds[i].Reset()
 	}
 }
@@ -0,0 +1,153 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newTestCity returns a grid of n x n streets with bus lines on every fourth street in both directions. Buses stop at
+// every fourth crossing and run every five minutes during the day.
+func newTestCity(n int) *RoutingData {
+	const spacing = 4
+
+	minute := uint32(60 * 1000)
+
+	r := &RoutingData{
+		Services:    []*Service{{Weekdays: 0x7f, StartDay: 0, EndDay: 100000}},
+		Vertices:    make([]Vertex, n*n),
+		StreetGraph: make([][]Arc, n*n),
+	}
+
+	vertex := func(row, col int) uint64 {
+		return uint64(row*n + col)
+	}
+
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			v := vertex(row, col)
+			r.Vertices[v] = Vertex{Latitude: 48 + float64(row)*0.0007, Longitude: 11.5 + float64(col)*0.001}
+
+			for _, neighbour := range [][2]int{{row - 1, col}, {row + 1, col}, {row, col - 1}, {row, col + 1}} {
+				if neighbour[0] < 0 || neighbour[0] >= n || neighbour[1] < 0 || neighbour[1] >= n {
+					continue
+				}
+
+				r.StreetGraph[v] = append(r.StreetGraph[v], Arc{Target: vertex(neighbour[0], neighbour[1]), WalkDistance: minute})
+			}
+		}
+	}
+
+	r.StopToRoutes = make([][]StopRoutePair, n*n)
+
+	addLine := func(stops []uint64) {
+		routeKey := uint32(len(r.Routes))
+		route := &Route{Stops: stops, Mode: TransitModeBus}
+
+		for start := 5 * 60 * minute; start < 23*60*minute; start += 5 * minute {
+			trip := &Trip{}
+			for i := range stops {
+				t := start + uint32(i)*2*minute
+				trip.StopTimes = append(trip.StopTimes, Stopover{Arrival: t, Departure: t})
+			}
+
+			route.Trips = append(route.Trips, uint32(len(r.Trips)))
+			r.Trips = append(r.Trips, trip)
+			r.TripToRoute = append(r.TripToRoute, routeKey)
+			r.TripInformation = append(r.TripInformation, &TripInformation{})
+		}
+
+		for i, stop := range stops {
+			r.StopToRoutes[stop] = append(r.StopToRoutes[stop], StopRoutePair{Route: routeKey, StopKeyInTrip: uint32(i)})
+			r.Vertices[stop].Stop = &StopContext{}
+		}
+
+		r.Routes = append(r.Routes, route)
+		r.GtfsRouteIndex = append(r.GtfsRouteIndex, routeKey)
+		r.RouteInformation = append(r.RouteInformation, &RouteInformation{Type: 3})
+	}
+
+	for line := 0; line < n; line += spacing {
+		var row, col, rowReverse, colReverse []uint64
+		for i := 0; i < n; i += spacing {
+			row = append(row, vertex(line, i))
+			col = append(col, vertex(i, line))
+			rowReverse = append(rowReverse, vertex(line, n-1-i))
+			colReverse = append(colReverse, vertex(n-1-i, line))
+		}
+
+		addLine(row)
+		addLine(col)
+		addLine(rowReverse)
+		addLine(colReverse)
+	}
+
+	r.RebuildVertexTree()
+
+	return r
+}
+
+// newLineTestRouter returns a router on a test city with 17 x 17 crossings, whose streets take walkingMs to walk.
+// Vertex 0 is the first stop of the bus line along the first row, which reaches vertex 16 after 8 minutes. From there,
+// a bus line along the last column reaches vertex 288 after another 8 minutes.
+func newLineTestRouter(walkingMs uint32) *Bifrost {
+	b := *DefaultBifrost
+	b.Data = newTestCity(17)
+
+	for _, arcs := range b.Data.StreetGraph {
+		for i := range arcs {
+			arcs[i].WalkDistance = walkingMs
+		}
+	}
+
+	b.Data.RebuildReverseStreetGraph()
+
+	return &b
+}
+
+// addTestRoute adds a route with a single trip, that calls at the stops at the given times of day.
+func addTestRoute(r *RoutingData, stops []uint64, times []uint32) {
+	routeKey := uint32(len(r.Routes))
+	trip := &Trip{}
+
+	for i, stop := range stops {
+		trip.StopTimes = append(trip.StopTimes, Stopover{Arrival: times[i], Departure: times[i]})
+		r.StopToRoutes[stop] = append(r.StopToRoutes[stop], StopRoutePair{Route: routeKey, StopKeyInTrip: uint32(i)})
+	}
+
+	r.Routes = append(r.Routes, &Route{Stops: stops, Trips: []uint32{uint32(len(r.Trips))}, Mode: TransitModeBus})
+	r.Trips = append(r.Trips, trip)
+	r.TripToRoute = append(r.TripToRoute, routeKey)
+	r.TripInformation = append(r.TripInformation, &TripInformation{})
+	r.GtfsRouteIndex = append(r.GtfsRouteIndex, routeKey)
+	r.RouteInformation = append(r.RouteInformation, &RouteInformation{Type: 3})
+}
+
+func BenchmarkRoute(b *testing.B) {
+	const n = 200
+
+	router := *DefaultBifrost
+	router.Data = newTestCity(n)
+
+	departure := time.Date(2023, 12, 12, 8, 30, 0, 0, time.UTC)
+	random := rand.New(rand.NewSource(1))
+
+	location := func() *fptf.Location {
+		return &fptf.Location{
+			Latitude:  48 + random.Float64()*float64(n-1)*0.0007,
+			Longitude: 11.5 + random.Float64()*float64(n-1)*0.001,
+		}
+	}
+
+	rounds := router.NewRounds()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := router.Route(rounds, []SourceLocation{{Location: location(), Departure: departure}}, location(), ModeTransit, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
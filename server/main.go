@@ -1,23 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/Vector-Hector/bifrost"
 	"github.com/Vector-Hector/fptf"
 	"github.com/gin-gonic/gin"
 	"math"
-	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type JourneyRequest struct {
-	Origin      *fptf.Location `json:"origin"`
-	Destination *fptf.Location `json:"destination"`
-	Departure   time.Time      `json:"departure"`
-	Modes       []fptf.Mode    `json:"modes"`
+	Origin         *fptf.Location `json:"origin"`
+	Destination    *fptf.Location `json:"destination"`
+	Departure      time.Time      `json:"departure"`
+	Modes          []fptf.Mode    `json:"modes"`
+	ArriveBy       bool           `json:"arriveBy"`       // interpret departure as the latest arrival at the destination
+	DepartureUntil time.Time      `json:"departureUntil"` // end of the departure window for range queries
+	Wheelchair     bool           `json:"wheelchair"`     // only use wheelchair accessible trips, stops and ways
+	BikeAndRide    bool           `json:"bikeAndRide"`    // park the bicycle instead of taking it on board
+	SharedMobility bool           `json:"sharedMobility"` // rent vehicles of the GBFS feeds on walks
+	AvoidNoService bool           `json:"avoidNoService"` // do not use trips at stops with NO_SERVICE alerts
 }
 
 type StringSlice []string
@@ -53,12 +61,28 @@ func SemaphoreMiddleware(maxConcurrentRequests int) gin.HandlerFunc {
 func main() {
 	var osmPath StringSlice
 	var gtfsPath StringSlice
+	var gbfsPath StringSlice
+	var feedIds StringSlice
 
-	flag.Var(&osmPath, "osm", "path to an osm pbf file")
-	flag.Var(&gtfsPath, "gtfs", "path to a gtfs zip file")
+	flag.Var(&osmPath, "osm", "path to an osm pbf file, may be given multiple times for neighbouring extracts")
+	flag.Var(&gtfsPath, "gtfs", "path to a gtfs zip file or directory")
+	flag.Var(&gbfsPath, "gbfs", "directory or http base url of a gbfs feed")
+	flag.Var(&feedIds, "feed-id", "id prefixed to the ids of the gtfs feed at the same position")
 	bifrostPath := flag.String("bifrost", "data.bifrost", "path to bifrost cache")
 	numHandlerThreads := flag.Int("threads", 12, "number of handler threads")
+	requestTimeout := flag.Duration("timeout", 10*time.Second, "maximum time to route a request, 0 for no limit")
 	onlyBuild := flag.Bool("only-build", false, "only build the bifrost cache")
+	failOnOutdatedCache := flag.Bool("fail-on-outdated-cache", false, "exit instead of rebuilding the bifrost cache, if the gtfs or osm files or parameters changed")
+	walkingCriterion := flag.Bool("walking-criterion", false, "also return journeys with less walking")
+	allowPhoneAgencyStops := flag.Bool("allow-phone-agency-stops", false, "allow stops where the agency must be phoned to board or alight")
+	tripUpdatesPath := flag.String("trip-updates", "", "path or url of a gtfs realtime trip updates feed")
+	tripUpdatesInterval := flag.Duration("trip-updates-interval", 30*time.Second, "interval in which the trip updates are read again")
+	alertsPath := flag.String("alerts", "", "path or url of a gtfs realtime service alerts feed")
+	alertsInterval := flag.Duration("alerts-interval", time.Minute, "interval in which the alerts are read again")
+	mergeStationsDistance := flag.Float64("merge-stations-distance", 0, "maximum distance in meters between stops of different gtfs feeds to merge them into one station, 0 to not merge stations")
+	mergeStationsTransfer := flag.Duration("merge-stations-transfer", 0, "transfer time between the stops of a merged station, 0 to use the walking time")
+	stationReportPath := flag.String("station-report", "", "path to write the merged stations to as json")
+	realtimeFeedId := flag.String("realtime-feed-id", "", "feed id of the gtfs feed, that the trip updates and alerts refer to")
 
 	flag.Parse()
 
@@ -66,10 +90,32 @@ func main() {
 
 	fmt.Println("Loading raptor data")
 	b := bifrost.DefaultBifrost
+	b.WalkingCriterion = *walkingCriterion
+	b.AllowPhoneAgencyStops = *allowPhoneAgencyStops
+
+	var stationMerge *bifrost.StationMergeOptions
+	if *mergeStationsDistance > 0 {
+		stationMerge = &bifrost.StationMergeOptions{
+			MaxDistanceMeters: *mergeStationsDistance,
+			MinNameSimilarity: bifrost.DefaultStationMergeOptions.MinNameSimilarity,
+			TransferMs:        uint32(mergeStationsTransfer.Milliseconds()),
+		}
+	}
+
+	outdatedCache := bifrost.OutdatedCacheRebuild
+	if *failOnOutdatedCache {
+		outdatedCache = bifrost.OutdatedCacheError
+	}
+
 	err := b.LoadData(&bifrost.LoadOptions{
-		OsmPaths:    osmPath,
-		GtfsPaths:   gtfsPath,
-		BifrostPath: *bifrostPath,
+		OsmPaths:          osmPath,
+		GtfsPaths:         gtfsPath,
+		GtfsFeedIds:       feedIds,
+		BifrostPath:       *bifrostPath,
+		GbfsPaths:         gbfsPath,
+		StationMerge:      stationMerge,
+		StationReportPath: *stationReportPath,
+		OutdatedCache:     outdatedCache,
 	})
 	if err != nil {
 		panic(err)
@@ -81,20 +127,34 @@ func main() {
 		return
 	}
 
-	const roundChanSize = 200
+	const maxHandlerThreads = 200
+
+	if *numHandlerThreads < 1 {
+		*numHandlerThreads = 1
+	}
+
+	if *numHandlerThreads > maxHandlerThreads {
+		*numHandlerThreads = maxHandlerThreads
+	}
 
-	roundChan := make(chan *bifrost.Rounds, roundChanSize)
+	// rounds are reused by the requests, as their labels are stored densely by vertex. The semaphore makes sure there
+	// is always a free one.
+	roundChan := make(chan *bifrost.Rounds, *numHandlerThreads)
 
-	for i := 0; i < roundChanSize; i++ {
+	for i := 0; i < *numHandlerThreads; i++ {
 		roundChan <- b.NewRounds()
 	}
 
-	if *numHandlerThreads < 1 {
-		*numHandlerThreads = 1
+	var realtime atomic.Pointer[bifrost.Realtime]
+
+	if *tripUpdatesPath != "" {
+		go pollTripUpdates(b, *tripUpdatesPath, *realtimeFeedId, *tripUpdatesInterval, &realtime)
 	}
 
-	if *numHandlerThreads > roundChanSize {
-		*numHandlerThreads = roundChanSize
+	var alerts atomic.Pointer[bifrost.Alerts]
+
+	if *alertsPath != "" {
+		go pollAlerts(*alertsPath, *realtimeFeedId, *alertsInterval, &alerts)
 	}
 
 	fmt.Println("Startup took", time.Since(start))
@@ -104,7 +164,11 @@ func main() {
 	engine.Use(SemaphoreMiddleware(*numHandlerThreads))
 
 	engine.POST("/bifrost", func(c *gin.Context) {
-		handle(c, b)
+		handle(c, b, roundChan, realtime.Load(), alerts.Load(), *requestTimeout)
+	})
+
+	engine.POST("/bifrost/range", func(c *gin.Context) {
+		handleRange(c, b, roundChan, realtime.Load(), alerts.Load(), *requestTimeout)
 	})
 
 	err = engine.Run(":8090")
@@ -113,32 +177,189 @@ func main() {
 	}
 }
 
-func handle(c *gin.Context, b *bifrost.Bifrost) {
-	defer func() {
-		r := recover()
-
-		if r == nil {
-			return
+// pollTripUpdates reads the trip updates periodically. If reading fails, the previous updates are kept.
+func pollTripUpdates(b *bifrost.Bifrost, source string, feedId string, interval time.Duration, realtime *atomic.Pointer[bifrost.Realtime]) {
+	for {
+		updates, err := b.ReadTripUpdates(source, feedId)
+		if err != nil {
+			fmt.Println("error reading trip updates:", err)
+		} else {
+			realtime.Store(updates)
 		}
 
-		if _, ok := r.(bifrost.NoRouteError); ok {
-			c.JSON(404, gin.H{
-				"error": "no route found",
-			})
-			return
+		time.Sleep(interval)
+	}
+}
+
+// pollAlerts reads the service alerts periodically. If reading fails, the previous alerts are kept.
+func pollAlerts(source string, feedId string, interval time.Duration, alerts *atomic.Pointer[bifrost.Alerts]) {
+	for {
+		read, err := bifrost.ReadAlerts(source, feedId)
+		if err != nil {
+			fmt.Println("error reading alerts:", err)
+		} else {
+			alerts.Store(read)
 		}
 
-		fmt.Println("Recovered in f", r)
+		time.Sleep(interval)
+	}
+}
 
-		debug.PrintStack()
+func handle(c *gin.Context, b *bifrost.Bifrost, roundChan chan *bifrost.Rounds, realtime *bifrost.Realtime, alerts *bifrost.Alerts, timeout time.Duration) {
+	req, ok := readRequest(c)
+	if !ok {
+		return
+	}
+
+	t := time.Now()
 
-		c.String(500, "Internal server error: %v", r)
+	query := *b
+	query.Wheelchair = req.Wheelchair
+	query.BikeAndRide = req.BikeAndRide
+	query.SharedMobility = req.SharedMobility
+	query.AvoidNoService = req.AvoidNoService
+
+	if realtime != nil {
+		query.Data = query.Data.WithRealtime(realtime)
+	}
+
+	if alerts != nil {
+		query.Data = query.Data.WithAlerts(alerts)
+	}
+
+	rounds := <-roundChan
+	defer func() {
+		roundChan <- rounds
 	}()
 
+	ctx, cancel := requestContext(c, timeout)
+	defer cancel()
+
+	routePareto := query.RouteParetoContext
+	if req.ArriveBy {
+		routePareto = query.RouteParetoArriveByContext
+	}
+
+	journeys, err := routePareto(ctx, rounds, []bifrost.SourceLocation{{
+		Location:  req.Origin,
+		Departure: req.Departure,
+	}}, req.Destination, req.Modes, false)
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+
+	fmt.Println("Routing took", time.Since(t))
+
+	c.JSON(200, journeys)
+}
+
+func handleRange(c *gin.Context, b *bifrost.Bifrost, roundChan chan *bifrost.Rounds, realtime *bifrost.Realtime, alerts *bifrost.Alerts, timeout time.Duration) {
+	req, ok := readRequest(c)
+	if !ok {
+		return
+	}
+
+	if !req.DepartureUntil.After(req.Departure) {
+		c.JSON(400, gin.H{
+			"error": "invalid departure window",
+		})
+		return
+	}
+
+	t := time.Now()
+
+	query := *b
+	query.Wheelchair = req.Wheelchair
+	query.BikeAndRide = req.BikeAndRide
+	query.SharedMobility = req.SharedMobility
+	query.AvoidNoService = req.AvoidNoService
+
+	if realtime != nil {
+		query.Data = query.Data.WithRealtime(realtime)
+	}
+
+	if alerts != nil {
+		query.Data = query.Data.WithAlerts(alerts)
+	}
+
+	rounds := <-roundChan
+	defer func() {
+		roundChan <- rounds
+	}()
+
+	ctx, cancel := requestContext(c, timeout)
+	defer cancel()
+
+	journeys, err := query.RouteRangeContext(ctx, rounds, []bifrost.SourceLocation{{
+		Location:  req.Origin,
+		Departure: req.Departure,
+	}}, req.Destination, req.Modes, req.DepartureUntil.Sub(req.Departure), false)
+	if err != nil {
+		writeRouteError(c, err)
+		return
+	}
+
+	fmt.Println("Range routing took", time.Since(t))
+
+	c.JSON(200, journeys)
+}
+
+// requestContext returns the context of a routing request. It is cancelled, when the client disconnects or the timeout
+// is over.
+func requestContext(c *gin.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(c.Request.Context())
+	}
+
+	return context.WithTimeout(c.Request.Context(), timeout)
+}
+
+// writeRouteError writes the response for an error returned by routing. Queries without a journey are answered with
+// 404, queries that took too long with 504, other errors are internal.
+func writeRouteError(c *gin.Context, err error) {
+	var noRoute bifrost.NoRouteError
+	var unreachable *bifrost.UnreachableError
+	var departure *bifrost.DepartureError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(504, gin.H{
+			"error": "routing timed out",
+		})
+	case errors.Is(err, context.Canceled):
+		c.JSON(503, gin.H{
+			"error": "request cancelled",
+		})
+	case errors.As(err, &noRoute):
+		c.JSON(404, gin.H{
+			"error": "no route found",
+		})
+	case errors.As(err, &unreachable):
+		c.JSON(404, gin.H{
+			"error": unreachable.Error(),
+		})
+	case errors.As(err, &departure):
+		c.JSON(400, gin.H{
+			"error": departure.Error(),
+		})
+	default:
+		fmt.Println("error routing:", err)
+
+		c.String(500, "Internal server error: %v", err)
+	}
+}
+
+// readRequest reads and validates the journey request. If it is invalid, an error response is written and false is
+// returned.
+func readRequest(c *gin.Context) (*JourneyRequest, bool) {
 	req := &JourneyRequest{}
 	err := json.NewDecoder(c.Request.Body).Decode(req)
 	if err != nil {
-		panic(err)
+		c.JSON(400, gin.H{
+			"error": "invalid request: " + err.Error(),
+		})
+		return nil, false
 	}
 
 	// validate request
@@ -146,43 +367,29 @@ func handle(c *gin.Context, b *bifrost.Bifrost) {
 		c.JSON(400, gin.H{
 			"error": "invalid origin",
 		})
-		return
+		return nil, false
 	}
 
 	if req.Destination == nil || math.Abs(req.Destination.Longitude) < 0.0001 || math.Abs(req.Destination.Latitude) < 0.0001 {
 		c.JSON(400, gin.H{
 			"error": "invalid destination",
 		})
-		return
+		return nil, false
 	}
 
 	if req.Departure.IsZero() {
 		c.JSON(400, gin.H{
 			"error": "invalid departure",
 		})
-		return
+		return nil, false
 	}
 
 	if len(req.Modes) == 0 {
 		c.JSON(400, gin.H{
 			"error": "invalid modes",
 		})
-		return
+		return nil, false
 	}
 
-	t := time.Now()
-
-	rounds := b.NewRounds()
-
-	journey, err := b.Route(rounds, []bifrost.SourceLocation{{
-		Location:  req.Origin,
-		Departure: req.Departure,
-	}}, req.Destination, req.Modes, false)
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Println("Routing took", time.Since(t))
-
-	c.JSON(200, journey)
+	return req, true
 }
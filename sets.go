@@ -0,0 +1,203 @@
+package bifrost
+
+import "math/bits"
+
+// IndexMap maps small integer keys, like vertices or routes, to values. It is a sparse set: the entries are stored
+// densely in the order their keys were added and a slice indexed by key holds the position of each entry, so lookups
+// do not hash and Reset only forgets the added entries instead of clearing the whole index. The zero value is an empty
+// map, and like a nil map, a nil *IndexMap can be read but not written.
+type IndexMap[T any] struct {
+	index  []uint32 // key -> position of the entry, only valid if the key is stored at that position
+	keys   []uint64
+	values []T
+	size   int // length of the index allocated on first use, usually the number of vertices or routes
+}
+
+// newIndexMap returns an empty map, whose index is allocated for keys below size once the first entry is added.
+func newIndexMap[T any](size int) *IndexMap[T] {
+	return &IndexMap[T]{size: size}
+}
+
+func (m *IndexMap[T]) position(key uint64) (int, bool) {
+	if m == nil || key >= uint64(len(m.index)) {
+		return 0, false
+	}
+
+	i := int(m.index[key])
+	return i, i < len(m.keys) && m.keys[i] == key
+}
+
+// Get returns the value of the key and whether it was added.
+func (m *IndexMap[T]) Get(key uint64) (T, bool) {
+	i, ok := m.position(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	return m.values[i], true
+}
+
+// Has returns true, if the key was added.
+func (m *IndexMap[T]) Has(key uint64) bool {
+	_, ok := m.position(key)
+	return ok
+}
+
+// Set adds the key or replaces its value.
+func (m *IndexMap[T]) Set(key uint64, value T) {
+	if i, ok := m.position(key); ok {
+		m.values[i] = value
+		return
+	}
+
+	if key >= uint64(len(m.index)) {
+		m.grow(key)
+	}
+
+	m.index[key] = uint32(len(m.keys))
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *IndexMap[T]) grow(key uint64) {
+	length := 2 * len(m.index)
+	if length < m.size {
+		length = m.size
+	}
+	if uint64(length) <= key {
+		length = int(key) + 1
+	}
+
+	index := make([]uint32, length)
+	copy(index, m.index)
+	m.index = index
+}
+
+// Len returns the number of entries.
+func (m *IndexMap[T]) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return len(m.keys)
+}
+
+// Entry returns the key and value of the i-th added entry. Entries added while iterating are appended.
+func (m *IndexMap[T]) Entry(i int) (uint64, T) {
+	return m.keys[i], m.values[i]
+}
+
+// Reset removes all entries in the time of their number.
+func (m *IndexMap[T]) Reset() {
+	m.keys = m.keys[:0]
+	m.values = m.values[:0]
+}
+
+// VertexSet is a set of vertices stored as a bitset. It keeps the words, that vertices were added to, so iterating and
+// resetting take time in the number of those words instead of the number of vertices. The zero value is an empty set.
+type VertexSet struct {
+	words  []uint64
+	listed []uint64 // bit i is set, if word i is in used
+	used   []uint32 // words, that vertices were added to since the last reset
+	count  int
+	size   int // number of vertices the set is allocated for on first use
+}
+
+// newVertexSet returns an empty set, that is allocated for size vertices once the first vertex is added.
+func newVertexSet(size int) *VertexSet {
+	return &VertexSet{size: size}
+}
+
+// Add adds the vertex to the set.
+func (s *VertexSet) Add(vertex uint64) {
+	word := vertex / 64
+	if word >= uint64(len(s.words)) {
+		s.grow(word)
+	}
+
+	bit := uint64(1) << (vertex % 64)
+	if s.words[word]&bit != 0 {
+		return
+	}
+
+	s.words[word] |= bit
+	s.count++
+
+	listedBit := uint64(1) << (word % 64)
+	if s.listed[word/64]&listedBit == 0 {
+		s.listed[word/64] |= listedBit
+		s.used = append(s.used, uint32(word))
+	}
+}
+
+func (s *VertexSet) grow(word uint64) {
+	length := 2 * len(s.words)
+	if length < (s.size+63)/64 {
+		length = (s.size + 63) / 64
+	}
+	if uint64(length) <= word {
+		length = int(word) + 1
+	}
+
+	words := make([]uint64, length)
+	copy(words, s.words)
+	s.words = words
+
+	listed := make([]uint64, (length+63)/64)
+	copy(listed, s.listed)
+	s.listed = listed
+}
+
+// Remove removes the vertex from the set.
+func (s *VertexSet) Remove(vertex uint64) {
+	word := vertex / 64
+	if word >= uint64(len(s.words)) {
+		return
+	}
+
+	bit := uint64(1) << (vertex % 64)
+	if s.words[word]&bit == 0 {
+		return
+	}
+
+	s.words[word] &^= bit
+	s.count--
+}
+
+// Has returns true, if the vertex is in the set.
+func (s *VertexSet) Has(vertex uint64) bool {
+	word := vertex / 64
+	return word < uint64(len(s.words)) && s.words[word]&(1<<(vertex%64)) != 0
+}
+
+// Len returns the number of vertices in the set.
+func (s *VertexSet) Len() int {
+	return s.count
+}
+
+// Each calls f for every vertex in the set. The current vertex may be removed by f, other changes of the set may or may
+// not be seen by the iteration.
+func (s *VertexSet) Each(f func(vertex uint64)) {
+	for _, word := range s.used {
+		bitsLeft := s.words[word]
+
+		for bitsLeft != 0 {
+			bit := bits.TrailingZeros64(bitsLeft)
+			bitsLeft &= bitsLeft - 1
+
+			f(uint64(word)*64 + uint64(bit))
+		}
+	}
+}
+
+// Reset removes all vertices in the time of the words they were added to.
+func (s *VertexSet) Reset() {
+	for _, word := range s.used {
+		s.words[word] = 0
+		s.listed[word/64] = 0
+	}
+
+	s.used = s.used[:0]
+	s.count = 0
+}
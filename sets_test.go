@@ -0,0 +1,80 @@
+package bifrost
+
+import "testing"
+
+func TestIndexMap(t *testing.T) {
+	m := newIndexMap[uint64](4)
+
+	var empty *IndexMap[uint64]
+	if empty.Has(1) || empty.Len() != 0 {
+		t.Fatal("expected nil map to be empty")
+	}
+
+	m.Set(2, 20)
+	m.Set(9, 90) // beyond the size hint
+	m.Set(2, 21)
+
+	if m.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", m.Len())
+	}
+
+	if v, ok := m.Get(2); !ok || v != 21 {
+		t.Fatalf("expected 21 for key 2, got %d, %v", v, ok)
+	}
+
+	if k, v := m.Entry(1); k != 9 || v != 90 {
+		t.Fatalf("expected second entry 9: 90, got %d: %d", k, v)
+	}
+
+	m.Reset()
+
+	if m.Len() != 0 || m.Has(2) || m.Has(9) {
+		t.Fatal("expected map to be empty after reset")
+	}
+
+	// the stale index of key 9 points to the new entry of key 3
+	m.Set(3, 30)
+	if m.Has(9) {
+		t.Fatal("expected key 9 to stay removed")
+	}
+}
+
+func TestVertexSet(t *testing.T) {
+	s := newVertexSet(100)
+
+	for _, v := range []uint64{3, 64, 65, 3, 250} {
+		s.Add(v)
+	}
+	s.Remove(64)
+	s.Remove(7)
+
+	if s.Len() != 3 || !s.Has(3) || !s.Has(65) || !s.Has(250) || s.Has(64) {
+		t.Fatalf("unexpected set of %d vertices", s.Len())
+	}
+
+	var vertices []uint64
+	s.Each(func(v uint64) {
+		vertices = append(vertices, v)
+		s.Remove(v)
+	})
+
+	if len(vertices) != 3 || s.Len() != 0 {
+		t.Fatalf("expected to visit and remove 3 vertices, got %v", vertices)
+	}
+
+	s.Add(65)
+	s.Reset()
+
+	if s.Len() != 0 || s.Has(65) {
+		t.Fatal("expected set to be empty after reset")
+	}
+
+	count := 0
+	s.Each(func(uint64) {
+		count++
+	})
+
+	if count != 0 {
+		t.Fatalf("expected no vertices after reset, visited %d", count)
+	}
+}
@@ -0,0 +1,143 @@
+package bifrost
+
+import "github.com/Vector-Hector/fptf"
+
+// pushNodeFunc adds or updates a node in the queue of runTransferRound. Nodes with a Shared station are riding a
+// shared vehicle.
+type pushNodeFunc func(update dijkstraNode)
+
+// pickUpSharedVehicle rents a shared vehicle, if the walk of node reached a station with available vehicles. The ride
+// starts after SharingMs and is labelled in the shared round.
+func (b *Bifrost) pickUpSharedVehicle(rounds *Rounds, target uint64, current int, node *dijkstraNode, push pushNodeFunc) {
+	station, ok := b.Data.SharingStations[node.Vertex]
+	if !ok || !station.canPickUp() {
+		return
+	}
+
+	sharedRound := rounds.SharedRounds[current+1]
+	arrival := node.Arrival + b.SharingMs
+
+	if existing, ok := sharedRound.Get(node.Vertex); ok && existing.Arrival <= arrival {
+		return
+	}
+
+	if targetEa, ok := rounds.EarliestArrivals.Get(target); ok && targetEa <= arrival {
+		return
+	}
+
+	sharedRound.Set(node.Vertex, StopArrival{
+		Arrival:   arrival,
+		Trip:      TripIdOrigin,
+		Departure: node.Arrival,
+	})
+
+	push(dijkstraNode{
+		Arrival:      arrival,
+		Vertex:       node.Vertex,
+		TransferTime: node.TransferTime,
+		Shared:       station,
+		SharedFrom:   node.Vertex,
+	})
+}
+
+// rideSharedVehicle relaxes the cycleable arcs of a node riding a shared vehicle. Where the vehicle can be returned,
+// the walk continues after SharingMs with a TripIdShared label.
+func (b *Bifrost) rideSharedVehicle(rounds *Rounds, target uint64, current int, node *dijkstraNode, push pushNodeFunc) {
+	sharedRound := rounds.SharedRounds[current+1]
+	next := rounds.Rounds[current+1]
+
+	for _, arc := range b.Data.StreetGraph[node.Vertex] {
+		if arc.CycleDistance == 0 {
+			continue
+		}
+
+		sharedTime := node.SharedTime + arc.CycleDistance
+		if sharedTime > b.MaxCyclingMs {
+			continue
+		}
+
+		arrival := node.Arrival + uint64(arc.CycleDistance)
+
+		targetEa, targetOk := rounds.EarliestArrivals.Get(target)
+		if targetOk && targetEa <= arrival {
+			continue
+		}
+
+		if existing, ok := sharedRound.Get(arc.Target); ok && existing.Arrival <= arrival {
+			continue
+		}
+
+		sharedRound.Set(arc.Target, StopArrival{
+			Arrival:      arrival,
+			Trip:         TripIdCycle,
+			EnterKey:     node.Vertex,
+			Departure:    node.Arrival,
+			TransferTime: sharedTime,
+		})
+
+		push(dijkstraNode{
+			Arrival:      arrival,
+			Vertex:       arc.Target,
+			TransferTime: node.TransferTime,
+			Shared:       node.Shared,
+			SharedFrom:   node.SharedFrom,
+			SharedTime:   sharedTime,
+		})
+
+		station, ok := b.Data.SharingStations[arc.Target]
+		if !node.Shared.FreeFloating && (!ok || !station.canReturn(node.Shared)) {
+			continue
+		}
+
+		returned := arrival + b.SharingMs
+
+		ea, ok := rounds.EarliestArrivals.Get(arc.Target)
+		if (ok && ea <= returned) || (targetOk && targetEa <= returned) {
+			continue
+		}
+
+		next.Set(arc.Target, StopArrival{
+			Arrival:      returned,
+			Trip:         TripIdShared,
+			EnterKey:     node.SharedFrom,
+			Departure:    arrival,
+			TransferTime: node.TransferTime,
+			Vehicles:     1 << VehicleTypeWalking,
+		})
+		rounds.MarkedStops.Add(arc.Target)
+		rounds.EarliestArrivals.Set(arc.Target, returned)
+
+		push(dijkstraNode{
+			Arrival:      returned,
+			Vertex:       arc.Target,
+			TransferTime: node.TransferTime,
+		})
+	}
+}
+
+// getSharedTrip returns the ride on a shared vehicle ending with the TripIdShared label at position of the given round,
+// and the vertex it was rented at. The leg names the operator and the stations.
+func (b *Bifrost) getSharedTrip(rounds *Rounds, round int, position uint64) (*fptf.Trip, uint64, error) {
+	trip, pickUp, err := GetTripFromTransfer(b.Data, rounds.SharedRounds[round], position, TripIdCycle)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	station := b.Data.SharingStations[pickUp]
+
+	trip.SubMode = station.FormFactor
+	trip.Operator = &fptf.Operator{
+		Id:   station.System,
+		Name: station.Operator,
+	}
+
+	trip.Origin.Station.Id = station.Id
+	trip.Origin.Station.Name = station.Name
+
+	if returnStation, ok := b.Data.SharingStations[position]; ok && !returnStation.FreeFloating {
+		trip.Destination.Station.Id = returnStation.Id
+		trip.Destination.Station.Name = returnStation.Name
+	}
+
+	return trip, pickUp, nil
+}
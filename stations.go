@@ -0,0 +1,240 @@
+package bifrost
+
+import (
+	"fmt"
+	"github.com/kyroy/kdtree"
+	"github.com/kyroy/kdtree/kdrange"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// StationMergeOptions configures, which stops of different gtfs feeds MergeStations considers to be the same station.
+type StationMergeOptions struct {
+	MaxDistanceMeters float64 // maximum distance between two stops of a station
+	MinNameSimilarity float64 // minimum similarity of the stop names between 0 and 1, see nameSimilarity
+	TransferMs        uint32  // time of a transfer between the stops of a station. If 0, the walking time is used
+}
+
+var DefaultStationMergeOptions = &StationMergeOptions{
+	MaxDistanceMeters: 200,
+	MinNameSimilarity: 0.5,
+}
+
+// StationCluster is a station published by multiple gtfs feeds, as built by MergeStations.
+type StationCluster struct {
+	Name      string   `json:"name"` // name of the first stop
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Stops     []string `json:"stops"`     // gtfs stop ids, sorted
+	Transfers int      `json:"transfers"` // number of transfer arcs added between the stops
+}
+
+// MergeStations clusters the stops of different gtfs feeds, that are close to each other and have similar names, and
+// connects the stops of a cluster with direct transfer arcs. Without them, transfers between the feeds have to walk
+// through the street graph, which is slow or impossible for stops far from the closest street vertex. Stops of the
+// same feed are never connected, as the feed defines its own transfers. Returns the clusters.
+func (b *Bifrost) MergeStations(options *StationMergeOptions) []*StationCluster {
+	if options == nil {
+		options = DefaultStationMergeOptions
+	}
+
+	points := make([]kdtree.Point, 0)
+	for i, vertex := range b.Data.Vertices {
+		if vertex.Stop == nil {
+			continue
+		}
+
+		points = append(points, &GeoPoint{
+			Latitude:  vertex.Latitude,
+			Longitude: vertex.Longitude,
+			VertKey:   uint64(i),
+		})
+	}
+
+	tree := kdtree.New(points)
+
+	parents := make(map[uint64]uint64) // union find forest of the clustered stops
+	find := func(stop uint64) uint64 {
+		for {
+			parent := parents[stop]
+			if parent == stop {
+				return stop
+			}
+			parents[stop] = parents[parent]
+			stop = parent
+		}
+	}
+
+	union := func(a uint64, b uint64) {
+		for _, stop := range []uint64{a, b} {
+			if _, ok := parents[stop]; !ok {
+				parents[stop] = stop
+			}
+		}
+		parents[find(b)] = find(a)
+	}
+
+	latDelta := options.MaxDistanceMeters / 111000
+
+	for _, point := range points {
+		from := point.(*GeoPoint)
+
+		lonDelta := latDelta / math.Max(math.Cos(from.Latitude*math.Pi/180), 0.01)
+
+		candidates := tree.RangeSearch(kdrange.New(
+			from.Latitude-latDelta, from.Latitude+latDelta,
+			from.Longitude-lonDelta, from.Longitude+lonDelta,
+		))
+
+		for _, candidate := range candidates {
+			to := candidate.(*GeoPoint)
+
+			if to.VertKey <= from.VertKey || !sameStation(&b.Data.Vertices[from.VertKey], &b.Data.Vertices[to.VertKey], options) {
+				continue
+			}
+
+			union(from.VertKey, to.VertKey)
+		}
+	}
+
+	members := make(map[uint64][]uint64)
+	for stop := range parents {
+		root := find(stop)
+		members[root] = append(members[root], stop)
+	}
+
+	clusters := make([]*StationCluster, 0, len(members))
+
+	for _, stops := range members {
+		sort.Slice(stops, func(i, j int) bool {
+			return stops[i] < stops[j]
+		})
+
+		clusters = append(clusters, b.connectStation(stops, options))
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Stops[0] < clusters[j].Stops[0]
+	})
+
+	b.Data.RebuildReverseStreetGraph()
+
+	fmt.Println("Merged", len(clusters), "stations of different feeds")
+
+	return clusters
+}
+
+// sameStation returns true, if the stops of the vertices belong to different feeds, are close to each other and have
+// similar names.
+func sameStation(from *Vertex, to *Vertex, options *StationMergeOptions) bool {
+	if from.Stop.Feed == to.Stop.Feed {
+		return false
+	}
+
+	if Distance(from.Latitude, from.Longitude, to.Latitude, to.Longitude, "K")*1000 > options.MaxDistanceMeters {
+		return false
+	}
+
+	return nameSimilarity(from.Stop.Name, to.Stop.Name) >= options.MinNameSimilarity
+}
+
+// connectStation adds transfer arcs between the stops of a cluster, that are the same station by sameStation. A
+// cluster is joined transitively, so two of its stops may be too far apart or too differently named to be connected.
+func (b *Bifrost) connectStation(stops []uint64, options *StationMergeOptions) *StationCluster {
+	first := &b.Data.Vertices[stops[0]]
+
+	cluster := &StationCluster{
+		Name:      first.Stop.Name,
+		Latitude:  first.Latitude,
+		Longitude: first.Longitude,
+		Stops:     make([]string, 0, len(stops)),
+	}
+
+	for _, from := range stops {
+		fromVertex := &b.Data.Vertices[from]
+		cluster.Stops = append(cluster.Stops, fromVertex.Stop.Id)
+
+		for _, to := range stops {
+			toVertex := &b.Data.Vertices[to]
+
+			if !sameStation(fromVertex, toVertex, options) || b.hasStreetArc(from, to) {
+				continue
+			}
+
+			dist := options.TransferMs
+			if dist == 0 {
+				dist = distanceMs(fromVertex, toVertex, b.WalkingSpeed)
+			}
+
+			b.Data.StreetGraph[from] = append(b.Data.StreetGraph[from], Arc{
+				Target:       to,
+				WalkDistance: dist,
+			})
+			cluster.Transfers++
+		}
+	}
+
+	sort.Strings(cluster.Stops)
+
+	return cluster
+}
+
+// normalizeStopName lower cases the name and replaces everything but letters and digits by single spaces.
+func normalizeStopName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(fields, " ")
+}
+
+// nameSimilarity returns the dice coefficient of the letter pairs of both normalized stop names, or 1 if one of them
+// contains the other, e.g. "Hauptbahnhof" and "Hauptbahnhof (Tief)".
+func nameSimilarity(a string, b string) float64 {
+	a = normalizeStopName(a)
+	b = normalizeStopName(b)
+
+	if a == "" || b == "" {
+		return 0
+	}
+
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return 1
+	}
+
+	pairs := func(s string) map[string]int {
+		runes := []rune(s)
+		counts := make(map[string]int)
+		for i := 1; i < len(runes); i++ {
+			counts[string(runes[i-1:i+1])]++
+		}
+		return counts
+	}
+
+	aPairs := pairs(a)
+	bPairs := pairs(b)
+
+	total := 0
+	common := 0
+
+	for pair, count := range aPairs {
+		total += count
+		if other := bPairs[pair]; other < count {
+			common += other
+		} else {
+			common += count
+		}
+	}
+
+	for _, count := range bPairs {
+		total += count
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return 2 * float64(common) / float64(total)
+}
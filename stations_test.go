@@ -0,0 +1,109 @@
+package bifrost
+
+import (
+	"testing"
+)
+
+func testStops(feedId string, stops ...Vertex) *RoutingData {
+	data := &RoutingData{
+		Timezones:  []*Timezone{{Name: "UTC"}},
+		StopsIndex: make(map[string]uint64),
+	}
+
+	for i, stop := range stops {
+		stop.Stop.Id = feedId + ":" + stop.Stop.Id
+		data.Vertices = append(data.Vertices, stop)
+		data.StopsIndex[stop.Stop.Id] = uint64(i)
+	}
+
+	return data
+}
+
+func TestMergeStations(t *testing.T) {
+	b := *DefaultBifrost
+
+	err := b.MergeData(testStops("db",
+		Vertex{Latitude: 48.1402, Longitude: 11.5600, Stop: &StopContext{Id: "hbf", Name: "München Hbf"}},
+		Vertex{Latitude: 48.1378, Longitude: 11.5757, Stop: &StopContext{Id: "marienplatz", Name: "Marienplatz"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.MergeData(testStops("mvv",
+		Vertex{Latitude: 48.1405, Longitude: 11.5605, Stop: &StopContext{Id: "hbf", Name: "Hauptbahnhof (München Hbf)"}},
+		Vertex{Latitude: 48.1380, Longitude: 11.5760, Stop: &StopContext{Id: "rathaus", Name: "Rathaus"}},
+		Vertex{Latitude: 48.1403, Longitude: 11.5601, Stop: &StopContext{Id: "hbf-tief", Name: "München Hbf (tief)"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if feed := b.Data.Vertices[b.Data.StopsIndex["mvv:hbf"]].Stop.Feed; feed != 1 {
+		t.Fatalf("expected the stops of the second feed to be of feed 1, got %d", feed)
+	}
+
+	clusters := b.MergeStations(&StationMergeOptions{
+		MaxDistanceMeters: 100,
+		MinNameSimilarity: 0.5,
+		TransferMs:        120000,
+	})
+
+	if len(clusters) != 1 {
+		t.Fatalf("expected only the main station to be merged, got %+v", clusters)
+	}
+
+	cluster := clusters[0]
+	if len(cluster.Stops) != 3 || cluster.Stops[0] != "db:hbf" || cluster.Transfers != 4 {
+		t.Fatalf("expected the three main station stops connected by 4 transfers, got %+v", cluster)
+	}
+
+	hbf := b.Data.StopsIndex["db:hbf"]
+	mvvHbf := b.Data.StopsIndex["mvv:hbf"]
+
+	if !b.hasStreetArc(hbf, mvvHbf) || !b.hasStreetArc(mvvHbf, hbf) {
+		t.Fatal("expected transfer arcs between the feeds")
+	}
+
+	if b.hasStreetArc(mvvHbf, b.Data.StopsIndex["mvv:hbf-tief"]) {
+		t.Fatal("expected no transfer arcs within a feed")
+	}
+
+	if arc := b.Data.StreetGraph[hbf][0]; arc.WalkDistance != 120000 {
+		t.Fatalf("expected the configured transfer time, got %d", arc.WalkDistance)
+	}
+}
+
+func TestMergeStationsChain(t *testing.T) {
+	b := *DefaultBifrost
+
+	// the stops of three feeds are 78 m apart from each other in a line, so the outer ones are 156 m apart
+	for i, feedId := range []string{"a", "b", "c"} {
+		err := b.MergeData(testStops(feedId,
+			Vertex{Latitude: 48.1270 + float64(i)*0.0007, Longitude: 11.6040, Stop: &StopContext{Id: "ost", Name: "Ostbahnhof"}},
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters := b.MergeStations(&StationMergeOptions{
+		MaxDistanceMeters: 100,
+		MinNameSimilarity: 0.5,
+	})
+
+	if len(clusters) != 1 || len(clusters[0].Stops) != 3 || clusters[0].Transfers != 4 {
+		t.Fatalf("expected one station of three stops connected by 4 transfers, got %+v", clusters)
+	}
+
+	a := b.Data.StopsIndex["a:ost"]
+	c := b.Data.StopsIndex["c:ost"]
+
+	if b.hasStreetArc(a, c) || b.hasStreetArc(c, a) {
+		t.Fatal("expected no transfer arcs between stops farther apart than the maximum distance")
+	}
+
+	if len(b.Data.ReverseStreetGraph) != len(b.Data.StreetGraph) || len(b.Data.ReverseStreetGraph[a]) != 1 {
+		t.Fatalf("expected the reverse street graph to contain the transfer arcs, got %v", b.Data.ReverseStreetGraph)
+	}
+}
@@ -8,33 +8,102 @@ import (
 	"fmt"
 	"github.com/artonge/go-gtfs"
 	"io"
+	"io/fs"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 )
 
+// GTFSFile is a gtfs feed, whose txt files are read from the root of Source. The source may be a zip file, a
+// directory or any other fs.FS, like an embed.FS or fstest.MapFS.
 type GTFSFile struct {
-	Reader *zip.ReadCloser
+	Source fs.FS
+	FeedId string // prefixed to the agency, stop, route, trip and service ids of the feed, see PrefixId
+
+	closer io.Closer // closes the zip file, if the feed was opened from one
+	row    FeedError // file and line of the row, that is currently iterated
+}
+
+// FeedError is returned, if a row of a gtfs feed is malformed.
+type FeedError struct {
+	File string // name of the txt file in the feed
+	Line int    // line of the row in the file, starting at 1 for the header
+	Err  error
+}
+
+func (e *FeedError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *FeedError) Unwrap() error {
+	return e.Err
+}
+
+// RowError returns a FeedError at the row, that is currently iterated. Handlers use it to report invalid values.
+func (g *GTFSFile) RowError(err error) error {
+	return &FeedError{
+		File: g.row.File,
+		Line: g.row.Line,
+		Err:  err,
+	}
 }
 
 func (g *GTFSFile) Close() error {
-	return g.Reader.Close()
+	if g.closer == nil {
+		return nil
+	}
+
+	return g.closer.Close()
 }
 
+// OpenGTFS opens a gtfs feed from a zip file or an unzipped directory.
 func OpenGTFS(path string) (*GTFSFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return NewGTFS(os.DirFS(path)), nil
+	}
+
 	reader, err := zip.OpenReader(path)
 	if err != nil {
 		return nil, err
 	}
 
 	return &GTFSFile{
-		Reader: reader,
+		Source: reader,
+		closer: reader,
 	}, nil
 }
 
+// PrefixId returns the id of an entity of the feed with the given id. Ids of feeds without id and empty ids, which
+// refer to no entity, are not changed.
+func PrefixId(feedId string, id string) string {
+	if feedId == "" || id == "" {
+		return id
+	}
+
+	return feedId + ":" + id
+}
+
+func (g *GTFSFile) prefix(ids ...*string) {
+	for _, id := range ids {
+		*id = PrefixId(g.FeedId, *id)
+	}
+}
+
+// NewGTFS reads a gtfs feed from a file system. Closing it does not close the file system.
+func NewGTFS(source fs.FS) *GTFSFile {
+	return &GTFSFile{
+		Source: source,
+	}
+}
+
 func (g *GTFSFile) CountRows(fileName string) (int, error) {
-	f, err := g.Reader.Open(fileName)
+	f, err := g.Source.Open(fileName)
 	if err != nil {
 		return 0, err
 	}
@@ -55,71 +124,98 @@ func (g *GTFSFile) CountRows(fileName string) (int, error) {
 }
 
 func (g *GTFSFile) Exists(fileName string) bool {
-	for _, f := range g.Reader.File {
-		if f.Name == fileName {
-			return true
-		}
-	}
+	_, err := fs.Stat(g.Source, fileName)
+	return err == nil
+}
 
-	return false
+func (g *GTFSFile) IterateAgencies(handler func(int, *gtfs.Agency) bool) error {
+	return iterateCsvFile(g, "agency.txt", ',', gtfs.Agency{}, func(index int, out *gtfs.Agency) bool {
+		g.prefix(&out.ID)
+		return handler(index, out)
+	})
 }
 
-func (g *GTFSFile) IterateStops(handler func(int, *gtfs.Stop) bool) error {
-	return iterateCsvFile(g, "stops.txt", ',', gtfs.Stop{}, func(index int, out *gtfs.Stop) bool {
+func (g *GTFSFile) IterateStops(handler func(int, *Stop) bool) error {
+	return iterateCsvFile(g, "stops.txt", ',', Stop{}, func(index int, out *Stop) bool {
+		g.prefix(&out.ID, &out.Parent)
 		return handler(index, out)
 	})
 }
 
 func (g *GTFSFile) IterateServices(handler func(int, *gtfs.Calendar) bool) error {
 	return iterateCsvFile(g, "calendar.txt", ',', gtfs.Calendar{}, func(index int, out *gtfs.Calendar) bool {
+		g.prefix(&out.ServiceID)
 		return handler(index, out)
 	})
 }
 
 func (g *GTFSFile) IterateCalendarDates(handler func(int, *gtfs.CalendarDate) bool) error {
 	return iterateCsvFile(g, "calendar_dates.txt", ',', gtfs.CalendarDate{}, func(index int, out *gtfs.CalendarDate) bool {
+		g.prefix(&out.ServiceID)
 		return handler(index, out)
 	})
 }
 
 func (g *GTFSFile) IterateRoutes(handler func(int, *gtfs.Route) bool) error {
 	return iterateCsvFile(g, "routes.txt", ',', gtfs.Route{}, func(index int, out *gtfs.Route) bool {
+		g.prefix(&out.ID, &out.AgencyID)
+		return handler(index, out)
+	})
+}
+
+func (g *GTFSFile) IterateTrips(handler func(int, *Trip) bool) error {
+	return iterateCsvFile(g, "trips.txt", ',', Trip{}, func(index int, out *Trip) bool {
+		g.prefix(&out.ID, &out.RouteID, &out.ServiceID)
+		return handler(index, out)
+	})
+}
+
+func (g *GTFSFile) IterateStopTimes(handler func(int, *StopTime) bool) error {
+	return iterateCsvFile(g, "stop_times.txt", ',', StopTime{}, func(index int, out *StopTime) bool {
+		g.prefix(&out.TripID, &out.StopID)
 		return handler(index, out)
 	})
 }
 
-func (g *GTFSFile) IterateTrips(handler func(int, *gtfs.Trip) bool) error {
-	return iterateCsvFile(g, "trips.txt", ',', gtfs.Trip{}, func(index int, out *gtfs.Trip) bool {
+func (g *GTFSFile) IterateFrequencies(handler func(int, *gtfs.Frequency) bool) error {
+	return iterateCsvFile(g, "frequencies.txt", ',', gtfs.Frequency{}, func(index int, out *gtfs.Frequency) bool {
+		g.prefix(&out.TripId)
 		return handler(index, out)
 	})
 }
 
-func (g *GTFSFile) IterateStopTimes(handler func(int, *gtfs.StopTime) bool) error {
-	return iterateCsvFile(g, "stop_times.txt", ',', gtfs.StopTime{}, func(index int, out *gtfs.StopTime) bool {
+func (g *GTFSFile) IterateTransfers(handler func(int, *Transfer) bool) error {
+	return iterateCsvFile(g, "transfers.txt", ',', Transfer{}, func(index int, out *Transfer) bool {
+		g.prefix(&out.FromStopID, &out.ToStopID, &out.FromRouteID, &out.ToRouteID, &out.FromTripID, &out.ToTripID)
 		return handler(index, out)
 	})
 }
 
 func iterateCsvFile[T any](g *GTFSFile, fileName string, comma rune, outInstance T, handler func(int, *T) bool) error {
-	f, err := g.Reader.Open(fileName)
+	f, err := g.Source.Open(fileName)
 	if err != nil {
 		return err
 	}
 
 	defer f.Close()
 
-	return iterateCsvReader(f, comma, outInstance, handler)
+	g.row = FeedError{File: fileName}
+
+	return iterateCsvReader(f, comma, outInstance, &g.row, handler)
 }
 
-func iterateCsvReader[T any](f io.Reader, comma rune, outInstance T, handler func(int, *T) bool) error {
+// iterateCsvReader calls the handler for each row of the csv file, until it returns false. The row is updated to the
+// line of the row, that is handled.
+func iterateCsvReader[T any](f io.Reader, comma rune, outInstance T, row *FeedError, handler func(int, *T) bool) error {
 	f = skipBOM(f)
 
 	r := csv.NewReader(f)
 	r.Comma = comma
+	r.FieldsPerRecord = -1 // trailing empty fields are often left out
 
 	header, err := r.Read()
 	if err != nil {
-		return err
+		return &FeedError{File: row.File, Line: 1, Err: err}
 	}
 
 	headerMap := make(map[string]int)
@@ -136,15 +232,25 @@ func iterateCsvReader[T any](f io.Reader, comma rune, outInstance T, handler fun
 
 	for {
 		line, err := r.Read()
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
 
-		err = readLine(line, headerMap, currentStruct)
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return &FeedError{File: row.File, Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+
 		if err != nil {
 			return err
 		}
 
+		row.Line, _ = r.FieldPos(0)
+
+		err = readLine(line, headerMap, currentStruct)
+		if err != nil {
+			return &FeedError{File: row.File, Line: row.Line, Err: err}
+		}
+
 		t := currentStruct.Interface().(T)
 
 		if !handler(pos, &t) {
@@ -256,7 +362,7 @@ func readLine(line []string, headerMap map[string]int, out reflect.Value) error
 		}
 
 		propertyPosition, ok := headerMap[propertyTag]
-		if !ok {
+		if !ok || propertyPosition >= len(line) {
 			continue
 		}
 
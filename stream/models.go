@@ -0,0 +1,56 @@
+package stream
+
+// Stop is a row of stops.txt. Unlike gtfs.Stop, it includes the wheelchair boarding and stop timezone columns.
+type Stop struct {
+	ID                 string  `csv:"stop_id"`
+	Code               string  `csv:"stop_code"`
+	Name               string  `csv:"stop_name"`
+	Description        string  `csv:"stop_desc"`
+	Latitude           float64 `csv:"stop_lat"`
+	Longitude          float64 `csv:"stop_lon"`
+	Type               string  `csv:"location_type"`
+	Parent             string  `csv:"parent_station"`
+	ZoneId             string  `csv:"zone_id"`
+	WheelchairBoarding uint8   `csv:"wheelchair_boarding"`
+	Timezone           string  `csv:"stop_timezone"`
+}
+
+// Trip is a row of trips.txt. Unlike gtfs.Trip, it includes the block, wheelchair and bikes columns.
+type Trip struct {
+	ID          string `csv:"trip_id"`
+	Name        string `csv:"trip_short_name"`
+	RouteID     string `csv:"route_id"`
+	ServiceID   string `csv:"service_id"`
+	ShapeID     string `csv:"shape_id"`
+	DirectionID string `csv:"direction_id"`
+	Headsign    string `csv:"trip_headsign"`
+	BlockID     string `csv:"block_id"`
+
+	WheelchairAccessible uint8 `csv:"wheelchair_accessible"`
+	BikesAllowed         uint8 `csv:"bikes_allowed"`
+}
+
+// Transfer is a row of transfers.txt. Unlike gtfs.Transfer, it includes the route and trip columns.
+type Transfer struct {
+	FromStopID  string `csv:"from_stop_id"`
+	ToStopID    string `csv:"to_stop_id"`
+	FromRouteID string `csv:"from_route_id"`
+	ToRouteID   string `csv:"to_route_id"`
+	FromTripID  string `csv:"from_trip_id"`
+	ToTripID    string `csv:"to_trip_id"`
+	Type        int    `csv:"transfer_type"`
+	MinTime     int    `csv:"min_transfer_time"` // in seconds
+}
+
+// StopTime is a row of stop_times.txt. Unlike gtfs.StopTime, it includes the pickup and drop off columns.
+type StopTime struct {
+	StopID       string  `csv:"stop_id"`
+	StopSeq      uint32  `csv:"stop_sequence"`
+	StopHeadSign string  `csv:"stop_headsign"`
+	TripID       string  `csv:"trip_id"`
+	Shape        float64 `csv:"shape_dist_traveled"`
+	Departure    string  `csv:"departure_time"`
+	Arrival      string  `csv:"arrival_time"`
+	PickupType   uint8   `csv:"pickup_type"`
+	DropOffType  uint8   `csv:"drop_off_type"`
+}
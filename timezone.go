@@ -0,0 +1,169 @@
+package bifrost
+
+import (
+	"github.com/Vector-Hector/fptf"
+	"sync"
+	"time"
+)
+
+// Timezone is the agency timezone of a gtfs feed. Stop times of a service day are counted from noon minus 12h of the
+// day in this timezone, which is not midnight on days with a DST change. The UTC offsets are precomputed for the days
+// the services of the feed run on, so the start of a service day is a lookup while routing.
+type Timezone struct {
+	Name     string  `json:"name"`     // IANA timezone name, e.g. Europe/Berlin
+	FirstDay uint32  `json:"firstDay"` // unix day of the first offset
+	Offsets  []int32 `json:"offsets"`  // day - FirstDay -> utc offset in seconds at noon of the day
+}
+
+var locations sync.Map // timezone name -> *time.Location
+
+// loadLocation returns the location of a timezone name. Locations are cached, as loading them reads the tz database.
+// Unknown names fall back to UTC.
+func loadLocation(name string) *time.Location {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	locations.Store(name, loc)
+	return loc
+}
+
+// NewTimezone precomputes the offsets of the timezone between the first and the last day, both including.
+func NewTimezone(name string, firstDay uint32, lastDay uint32) (*Timezone, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tz := &Timezone{
+		Name:     name,
+		FirstDay: firstDay,
+	}
+
+	if lastDay >= firstDay {
+		tz.Offsets = make([]int32, lastDay-firstDay+1)
+	}
+
+	for i := range tz.Offsets {
+		tz.Offsets[i] = noonOffset(loc, firstDay+uint32(i))
+	}
+
+	return tz, nil
+}
+
+// noonOffset returns the utc offset in seconds at noon of the unix day in the location.
+func noonOffset(loc *time.Location, day uint32) int32 {
+	date := time.Unix(int64(day)*int64(DayInMs/1000), 0).UTC()
+	_, offset := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, loc).Zone()
+	return int32(offset)
+}
+
+// offset returns the utc offset in seconds at noon of the unix day. Days outside the precomputed ones are computed.
+func (tz *Timezone) offset(day uint32) int32 {
+	if day >= tz.FirstDay && day-tz.FirstDay < uint32(len(tz.Offsets)) {
+		return tz.Offsets[day-tz.FirstDay]
+	}
+
+	return noonOffset(loadLocation(tz.Name), day)
+}
+
+// DayStart returns the unix ms of noon minus 12h of the unix day.
+func (tz *Timezone) DayStart(day uint64) uint64 {
+	return uint64(int64(day)*int64(DayInMs) - int64(tz.offset(uint32(day)))*1000)
+}
+
+// dayStart returns the unix ms, from which the stop times of the trip on the service day are counted. Without
+// timezones, service days start at UTC midnight.
+func (r *RoutingData) dayStart(trip *Trip, day uint64) uint64 {
+	if len(r.Timezones) == 0 {
+		return day * uint64(DayInMs)
+	}
+
+	return r.Timezones[r.Services[trip.Service].Timezone].DayStart(day)
+}
+
+// serviceDay returns the service day of the trip, that the unix ms are in.
+func (r *RoutingData) serviceDay(trip *Trip, ms uint64) uint32 {
+	day := ms / uint64(DayInMs)
+
+	if r.dayStart(trip, day+1) <= ms {
+		return uint32(day + 1)
+	}
+
+	if day > 0 && r.dayStart(trip, day) > ms {
+		return uint32(day - 1)
+	}
+
+	return uint32(day)
+}
+
+// GetTimeAt returns the unix ms as time in the timezone of the stop at vertex. Other vertices use the timezone of
+// GetTime.
+func (r *RoutingData) GetTimeAt(ms uint64, vertex uint64) fptf.TimeNullable {
+	return r.getTimeIn(ms, r.stopTimezone(vertex))
+}
+
+// getTimeOfTrip returns the unix ms as time in the timezone of the stop at vertex, or in the agency timezone of the
+// trip, if the stop has none.
+func (r *RoutingData) getTimeOfTrip(ms uint64, trip *Trip, vertex uint64) fptf.TimeNullable {
+	timezone := r.stopTimezone(vertex)
+	if timezone == "" && len(r.Timezones) > 0 {
+		timezone = r.Timezones[r.Services[trip.Service].Timezone].Name
+	}
+
+	return r.getTimeIn(ms, timezone)
+}
+
+// getTimeIn returns the unix ms as time in the named timezone, or in the timezone of GetTime, if the name is empty.
+func (r *RoutingData) getTimeIn(ms uint64, timezone string) fptf.TimeNullable {
+	if timezone == "" {
+		return r.GetTime(ms)
+	}
+
+	return fptf.TimeNullable{
+		Time: time.UnixMilli(int64(ms)).In(loadLocation(timezone)),
+	}
+}
+
+// stopTimezone returns the timezone of the stop at vertex, which is its stop_timezone or the agency timezone of its
+// feed. Returns an empty string for vertices, that are no stops.
+func (r *RoutingData) stopTimezone(vertex uint64) string {
+	stop := r.Vertices[vertex].Stop
+	if stop == nil {
+		return ""
+	}
+
+	if stop.Timezone == "" && int(stop.Feed) < len(r.Timezones) {
+		return r.Timezones[stop.Feed].Name
+	}
+
+	return stop.Timezone
+}
+
+// getTimeOnPath returns the unix ms as time in the timezone of the stop at vertex, or in the timezone of the street
+// leg, see pathTimezone, if the vertex is no stop.
+func (r *RoutingData) getTimeOnPath(ms uint64, vertex uint64, pathTimezone string) fptf.TimeNullable {
+	timezone := r.stopTimezone(vertex)
+	if timezone == "" {
+		timezone = pathTimezone
+	}
+
+	return r.getTimeIn(ms, timezone)
+}
+
+// pathTimezone returns the timezone of the first stop on the path of a street leg. The street vertices of a walk to
+// or from a stop show the time of that stop, only legs without any stop use the timezone of GetTime.
+func (r *RoutingData) pathTimezone(path []uint64) string {
+	for _, vertex := range path {
+		if timezone := r.stopTimezone(vertex); timezone != "" {
+			return timezone
+		}
+	}
+
+	return ""
+}
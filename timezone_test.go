@@ -0,0 +1,93 @@
+package bifrost
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezoneServiceDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+
+	// clocks are set forward on 2023-03-26 in Berlin
+	firstDay := uint32(time.Date(2023, 3, 20, 0, 0, 0, 0, time.UTC).Unix() / int64(DayInMs/1000))
+
+	tz, err := NewTimezone("Europe/Berlin", firstDay, firstDay+14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newRealtimeTestData()
+	data.Timezones = []*Timezone{tz}
+	for _, stop := range data.Vertices {
+		stop.Stop.Timezone = tz.Name
+	}
+
+	for _, date := range []time.Time{
+		time.Date(2023, 3, 25, 8, 0, 0, 0, berlin),
+		time.Date(2023, 3, 26, 8, 0, 0, 0, berlin),
+		time.Date(2023, 3, 27, 8, 0, 0, 0, berlin),
+	} {
+		minDeparture := uint64(date.Add(-time.Minute).UnixMilli())
+
+		trip, tripKey, day := data.earliestTrip(0, 0, minDeparture, nil)
+		if trip == nil || tripKey != 0 {
+			t.Fatalf("expected trip 0 on %v, got %d", date, tripKey)
+		}
+
+		dep := trip.StopTimes[0].DepartureAt(data.dayStart(trip, uint64(day)))
+		if dep != uint64(date.UnixMilli()) {
+			t.Fatalf("expected departure at %v, got %v", date, time.UnixMilli(int64(dep)))
+		}
+
+		local := data.GetTimeAt(dep, 0).Time
+		if local.Hour() != 8 || local.Location().String() != "Europe/Berlin" {
+			t.Fatalf("expected local departure at 8:00, got %v", local)
+		}
+	}
+}
+
+func TestTimezoneOfFeed(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("no timezone database:", err)
+	}
+
+	day := uint32(time.Date(2023, 12, 12, 0, 0, 0, 0, time.UTC).Unix() / int64(DayInMs/1000))
+
+	berlin, err := NewTimezone("Europe/Berlin", day, day+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := NewTimezone("America/New_York", day, day+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stops and the trips are of the second feed, vertex 3 is a street vertex next to stop 0
+	data := newRealtimeTestData()
+	data.Timezones = []*Timezone{berlin, newYork}
+	data.Services[0].Timezone = 1
+	data.Vertices = append(data.Vertices, Vertex{})
+	for i := 0; i < 3; i++ {
+		data.Vertices[i].Stop.Feed = 1
+	}
+
+	ms := uint64(time.Date(2023, 12, 12, 13, 0, 0, 0, time.UTC).UnixMilli())
+
+	for name, local := range map[string]time.Time{
+		"stop without stop_timezone": data.GetTimeAt(ms, 0).Time,
+		"trip at a street vertex":    data.getTimeOfTrip(ms, data.Trips[0], 3).Time,
+		"street vertex next to stop": data.getTimeOnPath(ms, 3, data.pathTimezone([]uint64{3, 0})).Time,
+	} {
+		if local.Location().String() != "America/New_York" || local.Hour() != 8 {
+			t.Fatalf("expected the %s at 8:00 in New York, got %v", name, local)
+		}
+	}
+
+	if local := data.getTimeOnPath(ms, 3, data.pathTimezone([]uint64{3})).Time; local.Location().String() != "Europe/Berlin" {
+		t.Fatalf("expected a street leg without stops in the timezone of the first feed, got %v", local)
+	}
+}
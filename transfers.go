@@ -0,0 +1,396 @@
+package bifrost
+
+// transferContext describes the trip on the other side of a transfer. In forward searches, it is the trip that was
+// left before, in reverse searches the trip that is entered next.
+type transferContext struct {
+	Stop uint64 // stop at which the trip is left or entered
+	Trip uint32 // trip key or TripIdOrigin if there is no such trip
+	Time uint64 // arrival of the trip at Stop or departure of the trip from Stop
+}
+
+// previousTrip follows the labels of a forward search back from a stop to the trip that was left last.
+func (b *Bifrost) previousTrip(rounds *Rounds, current int, stop uint64) transferContext {
+	position := stop
+
+	for i := current; i >= 0; {
+		sa, ok := rounds.Rounds[i].Get(position)
+		if !ok {
+			break
+		}
+
+		switch sa.Trip {
+		case TripIdNoChange:
+			i--
+		case TripIdOrigin:
+			return transferContext{Trip: TripIdOrigin}
+		case TripIdWalk, TripIdCycle, TripIdCar, TripIdShared:
+			position = sa.EnterKey
+		default:
+			return transferContext{
+				Stop: position,
+				Trip: sa.Trip,
+				Time: sa.Arrival,
+			}
+		}
+	}
+
+	return transferContext{Trip: TripIdOrigin}
+}
+
+// nextTrip follows the labels of a reverse search from a stop to the trip that is entered next.
+func (b *Bifrost) nextTrip(rounds *Rounds, current int, stop uint64) transferContext {
+	position := stop
+
+	for i := current; i >= 0; {
+		sa, ok := rounds.Rounds[i].Get(position)
+		if !ok {
+			break
+		}
+
+		switch sa.Trip {
+		case TripIdNoChange:
+			i--
+		case TripIdOrigin:
+			return transferContext{Trip: TripIdOrigin}
+		case TripIdWalk, TripIdCycle, TripIdCar:
+			position = sa.EnterKey
+		default:
+			trip := b.Data.tripAt(sa.Trip, uint32(sa.Departure))
+			return transferContext{
+				Stop: position,
+				Trip: sa.Trip,
+				Time: trip.StopTimes[sa.EnterKey].DepartureAt(b.Data.dayStart(trip, sa.Departure)),
+			}
+		}
+	}
+
+	return transferContext{Trip: TripIdOrigin}
+}
+
+// tripGtfsRoute returns the gtfs route index of a trip.
+func (r *RoutingData) tripGtfsRoute(tripKey uint32) uint32 {
+	return r.GtfsRouteIndex[r.tripRoute(tripKey)]
+}
+
+// findTransferRule returns the most specific transfer rule matching the transfer. Passing TransferAny as trip only
+// matches rules that do not name a specific trip.
+func (r *RoutingData) findTransferRule(fromStop uint64, toStop uint64, fromTrip uint32, fromRoute uint32, toTrip uint32, toRoute uint32) *TransferRule {
+	rules := r.Transfers[toStop]
+
+	var best *TransferRule
+	bestSpecificity := -1
+
+	for i := range rules {
+		rule := &rules[i]
+
+		if rule.FromStop != fromStop {
+			continue
+		}
+
+		if !matchesTransferKey(rule.FromTrip, fromTrip) || !matchesTransferKey(rule.ToTrip, toTrip) {
+			continue
+		}
+
+		if !matchesTransferKey(rule.FromRoute, fromRoute) || !matchesTransferKey(rule.ToRoute, toRoute) {
+			continue
+		}
+
+		specificity := rule.specificity()
+		if specificity > bestSpecificity {
+			best = rule
+			bestSpecificity = specificity
+		}
+	}
+
+	return best
+}
+
+func matchesTransferKey(ruleKey uint32, key uint32) bool {
+	return ruleKey == TransferAny || ruleKey == key
+}
+
+// specificity ranks rules naming trips above rules naming routes above rules only naming stops.
+func (t *TransferRule) specificity() int {
+	specificity := 0
+
+	if t.FromTrip != TransferAny {
+		specificity += 4
+	}
+
+	if t.ToTrip != TransferAny {
+		specificity += 4
+	}
+
+	if t.FromRoute != TransferAny {
+		specificity += 2
+	}
+
+	if t.ToRoute != TransferAny {
+		specificity += 2
+	}
+
+	return specificity
+}
+
+// transferMinDeparture returns the earliest departure at which a trip can be entered after arriving at the stop at
+// arrival. prevArrival is the arrival of the trip left before. Returns false, if the transfer is forbidden.
+func (b *Bifrost) transferMinDeparture(rule *TransferRule, arrival uint64, prevArrival uint64) (uint64, bool) {
+	if rule == nil {
+		return arrival + b.TransferPaddingMs, true
+	}
+
+	switch rule.Type {
+	case TransferTypeTimed:
+		return arrival, true
+	case TransferTypeMinTime:
+		minDeparture := prevArrival + uint64(rule.MinTimeMs)
+		if arrival > minDeparture {
+			return arrival, true
+		}
+		return minDeparture, true
+	case TransferTypeForbidden:
+		return 0, false
+	default:
+		return arrival + b.TransferPaddingMs, true
+	}
+}
+
+// transferMaxArrival is the reverse search counterpart of transferMinDeparture. departure is the label of the stop,
+// which already includes the transfer padding, nextDeparture the departure of the trip entered next.
+func (b *Bifrost) transferMaxArrival(rule *TransferRule, departure uint64, nextDeparture uint64) (uint64, bool) {
+	if rule == nil {
+		return departure, true
+	}
+
+	switch rule.Type {
+	case TransferTypeTimed:
+		return departure + b.TransferPaddingMs, true
+	case TransferTypeMinTime:
+		maxArrival := departure + b.TransferPaddingMs
+		if nextDeparture < uint64(rule.MinTimeMs) {
+			return 0, false
+		}
+		if limit := nextDeparture - uint64(rule.MinTimeMs); limit < maxArrival {
+			maxArrival = limit
+		}
+		return maxArrival, true
+	case TransferTypeForbidden:
+		return 0, false
+	default:
+		return departure, true
+	}
+}
+
+// earliestTripAfterTransfer finds the earliest trip of a route, that can be entered at stopSeqKey after arriving at
+// the stop at arrival. It respects the transfer rules of the stop regarding the trip the traveller arrived with.
+func (b *Bifrost) earliestTripAfterTransfer(rounds *Rounds, current int, routeKey uint32, stopSeqKey uint32, stopKey uint64, arrival uint64) (*Trip, uint32, uint32) {
+	if len(b.Data.Transfers[stopKey]) == 0 {
+		return b.earliestEnterableTrip(routeKey, stopSeqKey, arrival+b.TransferPaddingMs)
+	}
+
+	prev := b.previousTrip(rounds, current, stopKey)
+	if prev.Trip == TripIdOrigin {
+		return b.earliestEnterableTrip(routeKey, stopSeqKey, arrival+b.TransferPaddingMs)
+	}
+
+	fromRoute := b.Data.tripGtfsRoute(prev.Trip)
+	toRoute := b.Data.GtfsRouteIndex[routeKey]
+
+	var trip *Trip
+	tripKey := uint32(0)
+	day := uint32(0)
+
+	rule := b.Data.findTransferRule(prev.Stop, stopKey, prev.Trip, fromRoute, TransferAny, toRoute)
+	minDeparture, allowed := b.transferMinDeparture(rule, arrival, prev.Time)
+
+	if allowed {
+		route := b.Data.Routes[routeKey]
+
+		// rules for the specific trip may forbid the transfer or require more time
+		trip, tripKey, day = b.Data.earliestTrip(routeKey, stopSeqKey, minDeparture, func(trip *Trip, tripKey uint32, day uint32) bool {
+			if !b.canEnter(route, trip, tripKey, day, stopSeqKey) {
+				return false
+			}
+
+			tripRule := b.Data.findTransferRule(prev.Stop, stopKey, prev.Trip, fromRoute, tripKey, toRoute)
+			if tripRule == nil || tripRule.ToTrip == TransferAny {
+				return true
+			}
+
+			tripMin, tripAllowed := b.transferMinDeparture(tripRule, arrival, prev.Time)
+			return tripAllowed && trip.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(trip, uint64(day))) >= tripMin
+		})
+	}
+
+	// rules for specific trips, like guaranteed connections, may allow entering a trip departing before minDeparture
+	for _, candidate := range b.Data.Transfers[stopKey] {
+		if candidate.ToTrip == TransferAny || b.Data.TripToRoute[candidate.ToTrip] != routeKey {
+			continue
+		}
+
+		tripRule := b.Data.findTransferRule(prev.Stop, stopKey, prev.Trip, fromRoute, candidate.ToTrip, toRoute)
+		if tripRule == nil || tripRule.ToTrip == TransferAny {
+			continue
+		}
+
+		tripMin, tripAllowed := b.transferMinDeparture(tripRule, arrival, prev.Time)
+		if !tripAllowed {
+			continue
+		}
+
+		candidateDay, ok := b.Data.earliestDayOfTrip(candidate.ToTrip, stopSeqKey, tripMin)
+		if !ok {
+			continue
+		}
+
+		candidateTrip := b.Data.tripAt(candidate.ToTrip, candidateDay)
+		if !b.canEnter(b.Data.Routes[routeKey], candidateTrip, candidate.ToTrip, candidateDay, stopSeqKey) {
+			continue
+		}
+
+		if trip != nil && candidateTrip.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(candidateTrip, uint64(candidateDay))) >= trip.StopTimes[stopSeqKey].DepartureAt(b.Data.dayStart(trip, uint64(day))) {
+			continue
+		}
+
+		trip = candidateTrip
+		tripKey = candidate.ToTrip
+		day = candidateDay
+	}
+
+	return trip, tripKey, day
+}
+
+// latestTripBeforeTransfer is the reverse search counterpart of earliestTripAfterTransfer. It finds the latest trip
+// of a route, that can be left at stopSeqKey to leave the stop again at departure.
+func (b *Bifrost) latestTripBeforeTransfer(rounds *Rounds, current int, routeKey uint32, stopSeqKey uint32, stopKey uint64, departure uint64) (*Trip, uint32, uint32) {
+	if len(b.Data.Transfers) == 0 {
+		return b.latestLeavableTrip(routeKey, stopSeqKey, departure)
+	}
+
+	next := b.nextTrip(rounds, current, stopKey)
+	if next.Trip == TripIdOrigin || len(b.Data.Transfers[next.Stop]) == 0 {
+		return b.latestLeavableTrip(routeKey, stopSeqKey, departure)
+	}
+
+	fromRoute := b.Data.GtfsRouteIndex[routeKey]
+	toRoute := b.Data.tripGtfsRoute(next.Trip)
+
+	var trip *Trip
+	tripKey := uint32(0)
+	day := uint32(0)
+
+	rule := b.Data.findTransferRule(stopKey, next.Stop, TransferAny, fromRoute, next.Trip, toRoute)
+	maxArrival, allowed := b.transferMaxArrival(rule, departure, next.Time)
+
+	if allowed {
+		route := b.Data.Routes[routeKey]
+
+		// rules for the specific trip may forbid the transfer or require more time
+		trip, tripKey, day = b.Data.latestTrip(routeKey, stopSeqKey, maxArrival, func(trip *Trip, tripKey uint32, day uint32) bool {
+			if !b.canLeave(route, trip, tripKey, day, stopSeqKey) {
+				return false
+			}
+
+			tripRule := b.Data.findTransferRule(stopKey, next.Stop, tripKey, fromRoute, next.Trip, toRoute)
+			if tripRule == nil || tripRule.FromTrip == TransferAny {
+				return true
+			}
+
+			tripMax, tripAllowed := b.transferMaxArrival(tripRule, departure, next.Time)
+			return tripAllowed && trip.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(trip, uint64(day))) <= tripMax
+		})
+	}
+
+	// rules for specific trips, like guaranteed connections, may allow leaving a trip arriving after maxArrival
+	for _, candidate := range b.Data.Transfers[next.Stop] {
+		if candidate.FromTrip == TransferAny || candidate.FromStop != stopKey || b.Data.TripToRoute[candidate.FromTrip] != routeKey {
+			continue
+		}
+
+		tripRule := b.Data.findTransferRule(stopKey, next.Stop, candidate.FromTrip, fromRoute, next.Trip, toRoute)
+		if tripRule == nil || tripRule.FromTrip == TransferAny {
+			continue
+		}
+
+		tripMax, tripAllowed := b.transferMaxArrival(tripRule, departure, next.Time)
+		if !tripAllowed {
+			continue
+		}
+
+		candidateDay, ok := b.Data.latestDayOfTrip(candidate.FromTrip, stopSeqKey, tripMax)
+		if !ok {
+			continue
+		}
+
+		candidateTrip := b.Data.tripAt(candidate.FromTrip, candidateDay)
+		if !b.canLeave(b.Data.Routes[routeKey], candidateTrip, candidate.FromTrip, candidateDay, stopSeqKey) {
+			continue
+		}
+
+		if trip != nil && candidateTrip.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(candidateTrip, uint64(candidateDay))) <= trip.StopTimes[stopSeqKey].ArrivalAt(b.Data.dayStart(trip, uint64(day))) {
+			continue
+		}
+
+		trip = candidateTrip
+		tripKey = candidate.FromTrip
+		day = candidateDay
+	}
+
+	return trip, tripKey, day
+}
+
+// earliestEnterableTrip is like RoutingData.earliestTrip, but skips trips that may not be entered at the stop.
+func (b *Bifrost) earliestEnterableTrip(routeKey uint32, stopSeqKey uint32, minDeparture uint64) (*Trip, uint32, uint32) {
+	route := b.Data.Routes[routeKey]
+
+	return b.Data.earliestTrip(routeKey, stopSeqKey, minDeparture, func(trip *Trip, tripKey uint32, day uint32) bool {
+		return b.canEnter(route, trip, tripKey, day, stopSeqKey)
+	})
+}
+
+// latestLeavableTrip is like RoutingData.latestTrip, but skips trips that may not be left at the stop.
+func (b *Bifrost) latestLeavableTrip(routeKey uint32, stopSeqKey uint32, maxArrival uint64) (*Trip, uint32, uint32) {
+	route := b.Data.Routes[routeKey]
+
+	return b.Data.latestTrip(routeKey, stopSeqKey, maxArrival, func(trip *Trip, tripKey uint32, day uint32) bool {
+		return b.canLeave(route, trip, tripKey, day, stopSeqKey)
+	})
+}
+
+// earliestDayOfTrip returns the first day on which the trip runs and departs at stopSeqKey not before minDeparture.
+func (r *RoutingData) earliestDayOfTrip(tripKey uint32, stopSeqKey uint32, minDeparture uint64) (uint32, bool) {
+	// service days start up to a day apart from utc midnight, depending on the timezone
+	lastDay := uint32(minDeparture/uint64(DayInMs)) + 1
+	firstDay := uint32(0)
+	if lastDay > r.MaxTripDayLength+2 {
+		firstDay = lastDay - r.MaxTripDayLength - 2
+	}
+
+	for day := firstDay; day <= lastDay; day++ {
+		trip := r.tripOnDay(tripKey, day)
+		if trip != nil && trip.StopTimes[stopSeqKey].DepartureAt(r.dayStart(trip, uint64(day))) >= minDeparture {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
+
+// latestDayOfTrip returns the last day on which the trip runs and arrives at stopSeqKey not after maxArrival.
+func (r *RoutingData) latestDayOfTrip(tripKey uint32, stopSeqKey uint32, maxArrival uint64) (uint32, bool) {
+	// service days start up to a day apart from utc midnight, depending on the timezone
+	lastDay := uint32(maxArrival/uint64(DayInMs)) + 1
+	firstDay := uint32(0)
+	if lastDay > r.MaxTripDayLength+2 {
+		firstDay = lastDay - r.MaxTripDayLength - 2
+	}
+
+	for day := int64(lastDay); day >= int64(firstDay); day-- {
+		trip := r.tripOnDay(tripKey, uint32(day))
+		if trip != nil && trip.StopTimes[stopSeqKey].ArrivalAt(r.dayStart(trip, uint64(day))) <= maxArrival {
+			return uint32(day), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,136 @@
+package bifrost
+
+import "testing"
+
+func TestFindTransferRule(t *testing.T) {
+	data := &RoutingData{
+		Transfers: map[uint64][]TransferRule{
+			2: {
+				{FromStop: 1, FromRoute: TransferAny, ToRoute: TransferAny, FromTrip: TransferAny, ToTrip: TransferAny, Type: TransferTypeMinTime, MinTimeMs: 120000},
+				{FromStop: 1, FromRoute: 5, ToRoute: TransferAny, FromTrip: TransferAny, ToTrip: TransferAny, Type: TransferTypeTimed},
+				{FromStop: 1, FromRoute: TransferAny, ToRoute: TransferAny, FromTrip: 7, ToTrip: 8, Type: TransferTypeForbidden},
+			},
+		},
+	}
+
+	rule := data.findTransferRule(1, 2, 3, 4, TransferAny, 6)
+	if rule == nil || rule.Type != TransferTypeMinTime {
+		t.Fatalf("expected stop rule, got %+v", rule)
+	}
+
+	rule = data.findTransferRule(1, 2, 3, 5, TransferAny, 6)
+	if rule == nil || rule.Type != TransferTypeTimed {
+		t.Fatalf("expected route rule, got %+v", rule)
+	}
+
+	rule = data.findTransferRule(1, 2, 7, 5, 8, 6)
+	if rule == nil || rule.Type != TransferTypeForbidden {
+		t.Fatalf("expected trip rule, got %+v", rule)
+	}
+
+	rule = data.findTransferRule(0, 2, 7, 5, 8, 6)
+	if rule != nil {
+		t.Fatalf("expected no rule for other stop, got %+v", rule)
+	}
+}
+
+func TestTransferMinDeparture(t *testing.T) {
+	b := &Bifrost{TransferPaddingMs: 3000}
+
+	dep, ok := b.transferMinDeparture(nil, 10000, 5000)
+	if !ok || dep != 13000 {
+		t.Fatalf("expected padded departure, got %d", dep)
+	}
+
+	dep, ok = b.transferMinDeparture(&TransferRule{Type: TransferTypeMinTime, MinTimeMs: 60000}, 10000, 5000)
+	if !ok || dep != 65000 {
+		t.Fatalf("expected minimum transfer time, got %d", dep)
+	}
+
+	_, ok = b.transferMinDeparture(&TransferRule{Type: TransferTypeForbidden}, 10000, 5000)
+	if ok {
+		t.Fatal("expected forbidden transfer")
+	}
+}
+
+func TestEarliestEnterableTrip(t *testing.T) {
+	b := &Bifrost{
+		Data: &RoutingData{
+			Services: []*Service{{Weekdays: 0x7f, StartDay: 0, EndDay: 100}},
+			Routes:   []*Route{{Stops: []uint64{0, 1}, Trips: []uint32{0, 1, 2}}},
+			Trips: []*Trip{
+				{StopTimes: []Stopover{{Departure: 1000, Pickup: StopTypeNone}, {Arrival: 2000}}},
+				{StopTimes: []Stopover{{Departure: 3000, Pickup: StopTypePhoneAgency}, {Arrival: 4000}}},
+				{StopTimes: []Stopover{{Departure: 5000}, {Arrival: 6000}}},
+			},
+		},
+	}
+
+	_, tripKey, _ := b.earliestEnterableTrip(0, 0, 0)
+	if tripKey != 2 {
+		t.Fatalf("expected trip 2, got %d", tripKey)
+	}
+
+	b.AllowPhoneAgencyStops = true
+
+	_, tripKey, _ = b.earliestEnterableTrip(0, 0, 0)
+	if tripKey != 1 {
+		t.Fatalf("expected trip 1, got %d", tripKey)
+	}
+}
+
+// newFilteredRoute returns a route with a trip departing at each of the departures from its first stop and arriving a
+// second later at its second stop. Only the trip with the key valid may be entered or left.
+func newFilteredRoute(departures []uint32, valid int) *Bifrost {
+	route := &Route{Stops: []uint64{0, 1}}
+	data := &RoutingData{
+		Services: []*Service{{Weekdays: 0x7f, StartDay: 0, EndDay: 100}},
+		Routes:   []*Route{route},
+	}
+
+	for i, departure := range departures {
+		stopType := StopTypeNone
+		if i == valid {
+			stopType = StopTypeRegular
+		}
+
+		route.Trips = append(route.Trips, uint32(i))
+		data.Trips = append(data.Trips, &Trip{StopTimes: []Stopover{
+			{Arrival: departure, Departure: departure, Pickup: stopType, DropOff: stopType},
+			{Arrival: departure + 1000, Departure: departure + 1000, Pickup: stopType, DropOff: stopType},
+		}})
+	}
+
+	return &Bifrost{Data: data}
+}
+
+func TestEnterableTripAfterManyFilteredTrips(t *testing.T) {
+	const filtered = 15
+
+	// the valid trip departs last, together with a filtered trip
+	departures := make([]uint32, 0, filtered+1)
+	for i := 0; i < filtered; i++ {
+		departures = append(departures, uint32(i+1)*1000)
+	}
+	departures = append(departures, filtered*1000)
+
+	b := newFilteredRoute(departures, filtered)
+
+	trip, tripKey, _ := b.earliestEnterableTrip(0, 0, 0)
+	if trip == nil || tripKey != filtered {
+		t.Fatalf("expected trip %d, got %d", filtered, tripKey)
+	}
+
+	// the valid trip arrives first, together with a filtered trip
+	departures = []uint32{1000}
+	for i := 0; i < filtered; i++ {
+		departures = append(departures, uint32(i+1)*1000)
+	}
+
+	b = newFilteredRoute(departures, 0)
+
+	trip, tripKey, _ = b.latestLeavableTrip(0, 1, 100000)
+	if trip == nil || tripKey != 0 {
+		t.Fatalf("expected trip 0, got %d", tripKey)
+	}
+}
@@ -0,0 +1,79 @@
+package bifrost
+
+import (
+	"github.com/LdDl/osm2ch"
+	"github.com/paulmach/osm"
+	"math"
+	"testing"
+)
+
+func TestParseIncline(t *testing.T) {
+	cases := map[string]float64{
+		"5%":   5,
+		"-12%": -12,
+		"3":    3,
+		"45°":  100,
+	}
+
+	for value, expected := range cases {
+		incline, ok := parseIncline(value)
+		if !ok || math.Abs(incline-expected) > 0.001 {
+			t.Fatalf("expected %s to be %f%%, got %f", value, expected, incline)
+		}
+	}
+
+	if _, ok := parseIncline("up"); ok {
+		t.Fatal("expected up to be ignored")
+	}
+}
+
+func TestIsWheelchairInaccessible(t *testing.T) {
+	edge := func(tags ...osm.Tag) *osm2ch.ExpandedEdgeComponent {
+		return &osm2ch.ExpandedEdgeComponent{Tags: tags}
+	}
+
+	if isWheelchairInaccessible(edge(), "footway") {
+		t.Fatal("expected plain footway to be accessible")
+	}
+
+	if !isWheelchairInaccessible(edge(), "steps") {
+		t.Fatal("expected steps to be inaccessible")
+	}
+
+	if !isWheelchairInaccessible(edge(osm.Tag{Key: "incline", Value: "-8%"}), "footway") {
+		t.Fatal("expected steep incline to be inaccessible")
+	}
+
+	if !isWheelchairInaccessible(edge(osm.Tag{Key: "kerb", Value: "raised"}), "footway") {
+		t.Fatal("expected raised kerb to be inaccessible")
+	}
+
+	if isWheelchairInaccessible(edge(osm.Tag{Key: "wheelchair", Value: "yes"}), "steps") {
+		t.Fatal("expected wheelchair=yes to override steps")
+	}
+}
+
+func TestWheelchairAccessible(t *testing.T) {
+	b := &Bifrost{
+		Data: &RoutingData{
+			Vertices: []Vertex{
+				{Stop: &StopContext{Wheelchair: AccessibilityYes}},
+				{Stop: &StopContext{Wheelchair: AccessibilityNo}},
+			},
+		},
+	}
+
+	route := &Route{Stops: []uint64{0, 1}}
+
+	if !b.wheelchairAccessible(route, &Trip{}, 0) {
+		t.Fatal("expected accessible stop and unknown trip to be accessible")
+	}
+
+	if b.wheelchairAccessible(route, &Trip{}, 1) {
+		t.Fatal("expected inaccessible stop")
+	}
+
+	if b.wheelchairAccessible(route, &Trip{Wheelchair: AccessibilityNo}, 0) {
+		t.Fatal("expected inaccessible trip")
+	}
+}